@@ -1,15 +1,37 @@
 package config
 
 import (
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"time"
 )
 
 // global configs
 var (
-	Port                string
-	Address             string
-	CouchbaseConnection string
+	Port                          string
+	Address                       string
+	CouchbaseConnection           string
+	DisableApplicationHeaderToken bool
+	AccessTokenTTL                time.Duration
+	RefreshTokenTTL               time.Duration
+	Issuer                        string
+	MasterKey                     []byte
+	KeyRotationInterval           time.Duration
+	KeyRotationOverlap            time.Duration
+	DeviceCodeTTL                 time.Duration
+	DeviceVerificationURI         string
+	SAMLLoginURL                  string
+	AuthorizationLoginURL         string
+	TLSCertFile                   string
+	TLSKeyFile                    string
+	TLSClientCAs                  *x509.CertPool
+	ImpersonationTTL              time.Duration
+	OpenClientRegistration        bool
+	MaxSignedRequestBody          int64
 )
 
 // ServiceName ...
@@ -19,6 +41,23 @@ const ServiceName = "authentication"
 func Parse() {
 	Port = os.Getenv("AUTHENTICATION_PORT")
 	CouchbaseConnection = os.Getenv("AUTHENTICATION_CB_CONNECTION")
+	DisableApplicationHeaderToken = os.Getenv("AUTHENTICATION_DISABLE_APP_HEADER_TOKEN") == "true"
+	AccessTokenTTL = parseDuration("AUTHENTICATION_ACCESS_TOKEN_TTL", time.Hour)
+	RefreshTokenTTL = parseDuration("AUTHENTICATION_REFRESH_TOKEN_TTL", time.Hour*336)
+	Issuer = os.Getenv("AUTHENTICATION_ISSUER")
+	MasterKey = parseKey("AUTHENTICATION_MASTER_KEY")
+	KeyRotationInterval = parseDuration("AUTHENTICATION_KEY_ROTATION_INTERVAL", time.Hour*720)
+	KeyRotationOverlap = parseDuration("AUTHENTICATION_KEY_ROTATION_OVERLAP", time.Hour*24)
+	DeviceCodeTTL = parseDuration("AUTHENTICATION_DEVICE_CODE_TTL", time.Minute*10)
+	DeviceVerificationURI = os.Getenv("AUTHENTICATION_DEVICE_VERIFICATION_URI")
+	SAMLLoginURL = os.Getenv("AUTHENTICATION_SAML_LOGIN_URL")
+	AuthorizationLoginURL = os.Getenv("AUTHENTICATION_AUTHORIZATION_LOGIN_URL")
+	TLSCertFile = os.Getenv("AUTHENTICATION_TLS_CERT_FILE")
+	TLSKeyFile = os.Getenv("AUTHENTICATION_TLS_KEY_FILE")
+	TLSClientCAs = parseCertPool("AUTHENTICATION_TLS_CLIENT_CA_FILE")
+	ImpersonationTTL = parseDuration("AUTHENTICATION_IMPERSONATION_TTL", time.Minute*15)
+	OpenClientRegistration = os.Getenv("AUTHENTICATION_OPEN_CLIENT_REGISTRATION") == "true"
+	MaxSignedRequestBody = parseSize("AUTHENTICATION_MAX_SIGNED_REQUEST_BODY", 1<<20)
 
 	if Port == "" {
 		panic("Port missing")
@@ -28,5 +67,78 @@ func Parse() {
 		panic("Couchbase connection string missing")
 	}
 
+	if MasterKey == nil {
+		panic("Master key missing")
+	}
+
+	if (TLSCertFile == "") != (TLSKeyFile == "") {
+		panic("TLS certificate and key must both be set")
+	}
+
 	Address = fmt.Sprintf(":%s", Port)
 }
+
+// parseDuration reads a duration such as "15m" from the environment, using the default when it is not set
+func parseDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		panic(fmt.Sprintf("Invalid duration for %s", key))
+	}
+
+	return d
+}
+
+// parseSize reads a number of bytes from the environment, using the default when it is not set
+func parseSize(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		panic(fmt.Sprintf("Invalid size for %s", key))
+	}
+
+	return n
+}
+
+// parseKey reads a base64 encoded 256 bit key from the environment
+func parseKey(key string) []byte {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(b) != 32 {
+		panic(fmt.Sprintf("Invalid key for %s, expected 32 base64 encoded bytes", key))
+	}
+
+	return b
+}
+
+// parseCertPool reads a file of PEM encoded CA certificates named by the environment variable
+func parseCertPool(key string) *x509.CertPool {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(value)
+	if err != nil {
+		panic(fmt.Sprintf("Unable to read %s: %v", key, err))
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		panic(fmt.Sprintf("No certificates found for %s", key))
+	}
+
+	return pool
+}
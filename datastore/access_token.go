@@ -15,7 +15,7 @@ func (s *Store) GetAccessToken(token string) (*models.AccessToken, error) {
 
 	var accessToken models.AccessToken
 
-	_, err := s.bucket.GetAndTouch(key, accessTokenExpiration, &accessToken)
+	_, err := s.bucket.Get(key, &accessToken)
 	if err == gocb.ErrKeyNotFound {
 		return nil, nil
 	}
@@ -29,8 +29,22 @@ func (s *Store) GetAccessToken(token string) (*models.AccessToken, error) {
 // UpsertAccessToken upserts the AccessToken object to the document store
 func (s *Store) UpsertAccessToken(accessToken *models.AccessToken) error {
 	key := s.GetAccessTokenKey(accessToken.Token)
-	_, err := s.bucket.Upsert(key, accessToken, accessTokenExpiration)
-	return err
+	_, err := s.bucket.Upsert(key, accessToken, s.GetAccessTokenExpiration())
+	if err != nil || len(accessToken.UserID) == 0 {
+		return err
+	}
+
+	return s.addToUserTokens(accessToken.UserID, "access_tokens", accessToken.Token)
+}
+
+// IndexJWTAccessToken records a JWT access token in the user's token index. JWT access tokens are
+// not stored, so this is only needed to revoke them with the rest of the user's tokens.
+func (s *Store) IndexJWTAccessToken(accessToken *models.AccessToken) error {
+	if len(accessToken.UserID) == 0 {
+		return nil
+	}
+
+	return s.addToUserTokens(accessToken.UserID, "jwt_ids", jwtIndexEntry(accessToken.JWTID, accessToken.DateExpires))
 }
 
 // DeleteAccessToken deletes the AccessToken represented by the token
@@ -47,6 +61,61 @@ func (s *Store) DeleteAccessToken(token string) error {
 	return err
 }
 
+// tokenRevoker deletes the documents of a token type by the value of one of their fields
+type tokenRevoker struct {
+	docType string
+	field   string
+	revoke  func(string) error
+}
+
+// revokeTokensBy deletes every refresh token family, AccessToken and, when authCodes is set, AuthCode
+// whose field matches the id. It is used to revoke the tokens of a deleted Application or Site.
+func (s *Store) revokeTokensBy(field, id string, authCodes bool) error {
+	revokers := []tokenRevoker{
+		{"refresh_token_family", "id", s.RevokeRefreshTokenFamily},
+		{"access_token", "token", s.DeleteAccessToken},
+	}
+	if authCodes {
+		revokers = append(revokers, tokenRevoker{"auth_code", "code", s.DeleteAuthCode})
+	}
+
+	params := map[string]interface{}{
+		"id": id,
+	}
+	for _, r := range revokers {
+		query := fmt.Sprintf("SELECT RAW b.%s FROM $bucket b WHERE b.__type = '%s' AND b.%s = $id", r.field, r.docType, field)
+		rows, err := s.ExecuteQuery(query, params)
+		if err != nil {
+			return err
+		}
+
+		values := []string{}
+		var value string
+		for rows.Next(&value) {
+			values = append(values, value)
+		}
+		err = rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			err = r.revoke(value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetAccessTokenExpiration returns the number of seconds an AccessToken is valid for. Access tokens
+// have an absolute expiry and are not extended when they are used.
+func (s *Store) GetAccessTokenExpiration() uint32 {
+	return uint32(config.AccessTokenTTL.Seconds())
+}
+
 // GetAccessTokenDetailedFromCache returns the AccessTokenReponse defined by the token
 func (s *Store) GetAccessTokenDetailedFromCache(token string) (*models.AccessTokenDetailed, error) {
 	key := s.GetAccessTokenDetailedKey(token)
@@ -2,6 +2,7 @@ package datastore
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/couchbase/gocb"
 	cache "github.com/patrickmn/go-cache"
@@ -11,7 +12,9 @@ import (
 )
 
 const (
-	n1qlGetApplications = "SELECT b.* FROM $bucket b WHERE b.__type = 'application' ORDER BY b.name"
+	n1qlGetApplications              = "SELECT b.* FROM $bucket b WHERE b.__type = 'application' ORDER BY b.name"
+	n1qlGetApplicationBySAMLEntityID = "SELECT b.* FROM $bucket b WHERE b.__type = 'application' AND b.saml.entity_id = $entity_id LIMIT 1"
+	n1qlSearchApplications           = "SELECT b.* FROM $bucket b WHERE b.__type = 'application' AND IFMISSINGORNULL(b.tenant_id, '') = $tenant_id AND ($search = '' OR CONTAINS(LOWER(b.name), $search) OR b.id = $search) ORDER BY b.name, b.id LIMIT $limit OFFSET $offset"
 )
 
 // GetApplicationsList returns a list of Applications
@@ -30,6 +33,33 @@ func (s *Store) GetApplicationsList() ([]*models.Application, error) {
 	return apps, err
 }
 
+// SearchApplications returns a page of the tenant's Applications ordered by name. When search is set
+// only the applications whose name contains it or whose id matches it are returned.
+func (s *Store) SearchApplications(tenantID, search string, offset, limit int) ([]*models.Application, error) {
+	params := map[string]interface{}{
+		"tenant_id": tenantID,
+		"search":    strings.ToLower(search),
+		"offset":    offset,
+		"limit":     limit,
+	}
+	rows, err := s.ExecuteQuery(n1qlSearchApplications, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := []*models.Application{}
+	for {
+		var app models.Application
+		if !rows.Next(&app) {
+			break
+		}
+		apps = append(apps, &app)
+	}
+
+	return apps, nil
+}
+
 // GetApplication returns the application defined by the id
 func (s *Store) GetApplication(id string) (*models.Application, error) {
 	key := s.GetApplicationKey(id)
@@ -51,16 +81,43 @@ func (s *Store) GetApplication(id string) (*models.Application, error) {
 	return &app, nil
 }
 
+// GetApplicationBySAMLEntityID returns the Application registered for the SAML service provider
+func (s *Store) GetApplicationBySAMLEntityID(entityID string) (*models.Application, error) {
+	params := map[string]interface{}{
+		"entity_id": entityID,
+	}
+	rows, err := s.ExecuteQuery(n1qlGetApplicationBySAMLEntityID, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var app *models.Application
+	if !rows.Next(&app) {
+		return nil, rows.Close()
+	}
+
+	return app, nil
+}
+
 // UpsertApplication upserts the Application
 func (s *Store) UpsertApplication(app *models.Application) error {
 	key := s.GetApplicationKey(app.ID)
 	_, err := s.bucket.Upsert(key, app, 0)
-	return err
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
 }
 
 // DeleteApplication deletes the Application represented by the id
 func (s *Store) DeleteApplication(id string) error {
 	key := s.GetApplicationKey(id)
+
+	s.cache.Delete(key)
+
 	_, err := s.bucket.Remove(key, 0)
 	if err == gocb.ErrKeyNotFound {
 		return nil
@@ -69,6 +126,17 @@ func (s *Store) DeleteApplication(id string) error {
 	return err
 }
 
+// RevokeApplicationTokens deletes every AuthCode, AccessToken and RefreshToken issued to the application
+// and puts its JWT access tokens on the revocation list
+func (s *Store) RevokeApplicationTokens(id string) error {
+	err := s.revokeTokensBy("application_id", id, true)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeApplicationJWTs(id)
+}
+
 // GetApplicationKey created a document key for an Application document
 func (s *Store) GetApplicationKey(id string) string {
 	return fmt.Sprintf("%s:application:%s", config.ServiceName, id)
@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetApplicationSecrets returns the client secrets for the application defined by the id
+func (s *Store) GetApplicationSecrets(id string) (*models.ApplicationSecrets, error) {
+	key := s.GetApplicationSecretsKey(id)
+
+	var secrets models.ApplicationSecrets
+
+	_, err := s.bucket.Get(key, &secrets)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &secrets, nil
+}
+
+// UpsertApplicationSecrets upserts the ApplicationSecrets object to the document store
+func (s *Store) UpsertApplicationSecrets(secrets *models.ApplicationSecrets) error {
+	key := s.GetApplicationSecretsKey(secrets.ApplicationID)
+	_, err := s.bucket.Upsert(key, secrets, 0)
+	return err
+}
+
+// DeleteApplicationSecrets deletes all of the client secrets for the application defined by the id
+func (s *Store) DeleteApplicationSecrets(id string) error {
+	key := s.GetApplicationSecretsKey(id)
+	_, err := s.bucket.Remove(key, 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetApplicationSecretsKey created a document key for an ApplicationSecrets document
+func (s *Store) GetApplicationSecretsKey(id string) string {
+	return fmt.Sprintf("%s:application_secrets:%s", config.ServiceName, id)
+}
@@ -0,0 +1,69 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetApplicationSigningKeys returns the request signing keys for the application defined by the id
+func (s *Store) GetApplicationSigningKeys(id string) (*models.ApplicationSigningKeys, error) {
+	key := s.GetApplicationSigningKeysKey(id)
+
+	if cacheKeys, found := s.cache.Get(key); found {
+		return cacheKeys.(*models.ApplicationSigningKeys), nil
+	}
+
+	var keys models.ApplicationSigningKeys
+
+	_, err := s.bucket.Get(key, &keys)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, &keys, cacheExpiration)
+	return &keys, nil
+}
+
+// UpsertApplicationSigningKeys upserts the ApplicationSigningKeys object to the document store
+func (s *Store) UpsertApplicationSigningKeys(keys *models.ApplicationSigningKeys) error {
+	key := s.GetApplicationSigningKeysKey(keys.ApplicationID)
+	_, err := s.bucket.Upsert(key, keys, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
+}
+
+// UseRequestNonce records the nonce of a signed request. The return value is false if the nonce has
+// already been used by the application, which means the request is a replay.
+func (s *Store) UseRequestNonce(applicationID, nonce string) (bool, error) {
+	key := s.GetRequestNonceKey(applicationID, nonce)
+	_, err := s.bucket.Insert(key, true, requestNonceExpiration)
+	if err == gocb.ErrKeyExists {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetApplicationSigningKeysKey created a document key for an ApplicationSigningKeys document
+func (s *Store) GetApplicationSigningKeysKey(id string) string {
+	return fmt.Sprintf("%s:application_signing_keys:%s", config.ServiceName, id)
+}
+
+// GetRequestNonceKey created a document key for a used request nonce
+func (s *Store) GetRequestNonceKey(applicationID, nonce string) string {
+	return fmt.Sprintf("%s:request_nonce:%s:%s", config.ServiceName, applicationID, nonce)
+}
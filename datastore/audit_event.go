@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetAuditEvents = "SELECT b.* FROM $bucket b WHERE b.__type = 'audit_event' AND ($tenant_id = '' OR b.tenant_id = $tenant_id) AND ($user_id = '' OR b.user_id = $user_id OR b.admin_id = $user_id) ORDER BY b.date_created DESC LIMIT $limit"
+)
+
+// InsertAuditEvent saves the AuditEvent. Audit events never expire.
+func (s *Store) InsertAuditEvent(event *models.AuditEvent) error {
+	key := s.GetAuditEventKey(event.ID)
+	_, err := s.bucket.Insert(key, event, 0)
+	return err
+}
+
+// GetAuditEvents returns the most recent AuditEvents, newest first. When tenantID is set only the
+// events of that tenant are returned, and when userID is set only the events by or about that user.
+func (s *Store) GetAuditEvents(tenantID, userID string, limit int) ([]*models.AuditEvent, error) {
+	params := map[string]interface{}{
+		"tenant_id": tenantID,
+		"user_id":   userID,
+		"limit":     limit,
+	}
+	rows, err := s.ExecuteQuery(n1qlGetAuditEvents, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for {
+		var event models.AuditEvent
+		if !rows.Next(&event) {
+			break
+		}
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// GetAuditEventKey created a document key for an AuditEvent document
+func (s *Store) GetAuditEventKey(id string) string {
+	return fmt.Sprintf("%s:audit_event:%s", config.ServiceName, id)
+}
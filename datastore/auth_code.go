@@ -31,7 +31,11 @@ func (s *Store) GetAuthCode(code string) (*models.AuthCode, error) {
 func (s *Store) UpsertAuthCode(authCode *models.AuthCode) error {
 	key := s.GetAuthCodeKey(authCode.Code)
 	_, err := s.bucket.Upsert(key, authCode, s.getAuthCodeExpiry(authCode.AuthType))
-	return err
+	if err != nil || len(authCode.UserID) == 0 {
+		return err
+	}
+
+	return s.addToUserTokens(authCode.UserID, "auth_codes", authCode.Code)
 }
 
 // DeleteAuthCode deletes the AuthCode represented by the code
@@ -90,11 +94,12 @@ func (s *Store) GetAuthCodeDetailedKey(id string) string {
 }
 
 func (s *Store) getAuthCodeExpiry(authType models.AuthTypeValue) uint32 {
-	if authType == models.AuthTypeUser {
+	if authType.IsUser() {
 		return authCodeExpiration
 	}
 
-	if authType == models.AuthTypeApplication {
+	// impersonation tokens are short lived, so the AuthCode only needs to outlive them
+	if authType == models.AuthTypeApplication || authType == models.AuthTypeImpersonation {
 		return applicationTokenExpiration
 	}
 
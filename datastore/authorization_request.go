@@ -0,0 +1,93 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetAuthorizationRequest returns the AuthorizationRequest defined by the id
+func (s *Store) GetAuthorizationRequest(id string) (*models.AuthorizationRequest, error) {
+	key := s.GetAuthorizationRequestKey(id)
+
+	var request models.AuthorizationRequest
+
+	_, err := s.bucket.Get(key, &request)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// InsertAuthorizationRequest saves a new AuthorizationRequest
+func (s *Store) InsertAuthorizationRequest(request *models.AuthorizationRequest) error {
+	key := s.GetAuthorizationRequestKey(request.ID)
+	_, err := s.bucket.Insert(key, request, authorizationRequestExpiration)
+	return err
+}
+
+// DeleteAuthorizationRequest deletes the AuthorizationRequest. The return value is false if it had
+// already been deleted, which makes sure only one code is issued for each request.
+func (s *Store) DeleteAuthorizationRequest(id string) (bool, error) {
+	key := s.GetAuthorizationRequestKey(id)
+	_, err := s.bucket.Remove(key, 0)
+	if err == gocb.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// InsertAuthorizationCode saves a new AuthorizationCode
+func (s *Store) InsertAuthorizationCode(code *models.AuthorizationCode) error {
+	key := s.GetAuthorizationCodeKey(code.Code)
+	_, err := s.bucket.Insert(key, code, authorizationCodeExpiration)
+	return err
+}
+
+// UseAuthorizationCode returns the AuthorizationCode defined by the code and deletes it. Nil is returned
+// if it does not exist or has already been used, so each code can only be exchanged once.
+func (s *Store) UseAuthorizationCode(code string) (*models.AuthorizationCode, error) {
+	key := s.GetAuthorizationCodeKey(code)
+
+	var authorizationCode models.AuthorizationCode
+
+	cas, err := s.bucket.Get(key, &authorizationCode)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the cas makes sure a concurrent exchange of the same code cannot also succeed
+	_, err = s.bucket.Remove(key, cas)
+	if err == gocb.ErrKeyNotFound || err == gocb.ErrKeyExists {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorizationCode, nil
+}
+
+// GetAuthorizationRequestKey created a document key for an AuthorizationRequest document
+func (s *Store) GetAuthorizationRequestKey(id string) string {
+	return fmt.Sprintf("%s:authorization_request:%s", config.ServiceName, id)
+}
+
+// GetAuthorizationCodeKey created a document key for an AuthorizationCode document
+func (s *Store) GetAuthorizationCodeKey(code string) string {
+	return fmt.Sprintf("%s:authorization_code:%s", config.ServiceName, code)
+}
@@ -0,0 +1,36 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+)
+
+// UseClientAssertion records the jti of a client assertion until it expires. The return value is
+// false if the assertion has already been used.
+func (s *Store) UseClientAssertion(applicationID, jwtID string, expires time.Time) (bool, error) {
+	key := s.GetClientAssertionKey(applicationID, jwtID)
+
+	expiry := uint32(1)
+	if remaining := time.Until(expires); remaining > time.Second {
+		expiry = uint32(remaining.Seconds()) + 1
+	}
+
+	_, err := s.bucket.Insert(key, true, expiry)
+	if err == gocb.ErrKeyExists {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetClientAssertionKey created a document key for a used client assertion
+func (s *Store) GetClientAssertionKey(applicationID, jwtID string) string {
+	return fmt.Sprintf("%s:client_assertion:%s:%s", config.ServiceName, applicationID, jwtID)
+}
@@ -0,0 +1,89 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetClientRegistration returns the ClientRegistration of the application defined by the id
+func (s *Store) GetClientRegistration(id string) (*models.ClientRegistration, error) {
+	key := s.GetClientRegistrationKey(id)
+
+	var registration models.ClientRegistration
+
+	_, err := s.bucket.Get(key, &registration)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &registration, nil
+}
+
+// UpsertClientRegistration upserts the ClientRegistration object to the document store
+func (s *Store) UpsertClientRegistration(registration *models.ClientRegistration) error {
+	key := s.GetClientRegistrationKey(registration.ApplicationID)
+	_, err := s.bucket.Upsert(key, registration, 0)
+	return err
+}
+
+// DeleteClientRegistration deletes the ClientRegistration of the application defined by the id
+func (s *Store) DeleteClientRegistration(id string) error {
+	key := s.GetClientRegistrationKey(id)
+	_, err := s.bucket.Remove(key, 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetInitialAccessToken returns the unexpired InitialAccessToken defined by the hash of the token
+func (s *Store) GetInitialAccessToken(hash string) (*models.InitialAccessToken, error) {
+	key := s.GetInitialAccessTokenKey(hash)
+
+	var token models.InitialAccessToken
+
+	_, err := s.bucket.Get(key, &token)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.DateExpires != nil && token.DateExpires.Before(time.Now().UTC()) {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+// InsertInitialAccessToken saves the InitialAccessToken until it expires
+func (s *Store) InsertInitialAccessToken(token *models.InitialAccessToken) error {
+	key := s.GetInitialAccessTokenKey(token.Hash)
+
+	expiry := uint32(0)
+	if token.DateExpires != nil {
+		expiry = uint32(time.Until(*token.DateExpires).Seconds()) + 1
+	}
+
+	_, err := s.bucket.Insert(key, token, expiry)
+	return err
+}
+
+// GetClientRegistrationKey created a document key for a ClientRegistration document
+func (s *Store) GetClientRegistrationKey(id string) string {
+	return fmt.Sprintf("%s:client_registration:%s", config.ServiceName, id)
+}
+
+// GetInitialAccessTokenKey created a document key for an InitialAccessToken document
+func (s *Store) GetInitialAccessTokenKey(hash string) string {
+	return fmt.Sprintf("%s:initial_access_token:%s", config.ServiceName, hash)
+}
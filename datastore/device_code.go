@@ -0,0 +1,113 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// deviceCodeRef maps a user code to the device code it was issued with
+type deviceCodeRef struct {
+	DeviceCode string `json:"device_code"`
+}
+
+// GetDeviceCode returns the DeviceCode defined by the device code
+func (s *Store) GetDeviceCode(code string) (*models.DeviceCode, error) {
+	key := s.GetDeviceCodeKey(code)
+
+	var deviceCode models.DeviceCode
+
+	_, err := s.bucket.Get(key, &deviceCode)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &deviceCode, nil
+}
+
+// GetDeviceCodeByUserCode returns the DeviceCode that was issued with the user code
+func (s *Store) GetDeviceCodeByUserCode(userCode string) (*models.DeviceCode, error) {
+	key := s.GetDeviceUserCodeKey(userCode)
+
+	var ref deviceCodeRef
+
+	_, err := s.bucket.Get(key, &ref)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceCode(ref.DeviceCode)
+}
+
+// InsertDeviceCode saves a new DeviceCode. An error is returned if the user code is already in use.
+func (s *Store) InsertDeviceCode(deviceCode *models.DeviceCode) error {
+	expiry := getDeviceCodeExpiry(deviceCode)
+
+	_, err := s.bucket.Insert(s.GetDeviceUserCodeKey(deviceCode.UserCode), &deviceCodeRef{DeviceCode: deviceCode.DeviceCode}, expiry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.bucket.Insert(s.GetDeviceCodeKey(deviceCode.DeviceCode), deviceCode, expiry)
+	return err
+}
+
+// UpdateDeviceCode replaces the DeviceCode, keeping its original expiry
+func (s *Store) UpdateDeviceCode(deviceCode *models.DeviceCode) error {
+	key := s.GetDeviceCodeKey(deviceCode.DeviceCode)
+	_, err := s.bucket.Replace(key, deviceCode, 0, getDeviceCodeExpiry(deviceCode))
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteDeviceCode deletes the DeviceCode and its user code. The return value is false if the
+// DeviceCode had already been deleted, which makes sure an approved DeviceCode is only exchanged once.
+func (s *Store) DeleteDeviceCode(deviceCode *models.DeviceCode) (bool, error) {
+	_, err := s.bucket.Remove(s.GetDeviceUserCodeKey(deviceCode.UserCode), 0)
+	if err != nil && err != gocb.ErrKeyNotFound {
+		return false, err
+	}
+
+	_, err = s.bucket.Remove(s.GetDeviceCodeKey(deviceCode.DeviceCode), 0)
+	if err == gocb.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetDeviceCodeKey created a document key for a DeviceCode document
+func (s *Store) GetDeviceCodeKey(code string) string {
+	return fmt.Sprintf("%s:device_code:%s", config.ServiceName, code)
+}
+
+// GetDeviceUserCodeKey created a document key for the user code reference of a DeviceCode
+func (s *Store) GetDeviceUserCodeKey(userCode string) string {
+	return fmt.Sprintf("%s:device_user_code:%s", config.ServiceName, userCode)
+}
+
+// getDeviceCodeExpiry returns the number of seconds until the DeviceCode expires
+func getDeviceCodeExpiry(deviceCode *models.DeviceCode) uint32 {
+	remaining := time.Until(deviceCode.DateExpires)
+	if remaining < time.Second {
+		return 1
+	}
+
+	return uint32(remaining.Seconds())
+}
@@ -0,0 +1,74 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetDirectoryByEmailDomain = "SELECT b.* FROM $bucket b WHERE b.__type = 'directory' AND IFMISSINGORNULL(b.tenant_id, '') = $tenant_id AND ANY d IN b.email_domains SATISFIES LOWER(d) = $domain END LIMIT 1"
+)
+
+// GetDirectory returns the Directory defined by the id
+func (s *Store) GetDirectory(id string) (*models.Directory, error) {
+	key := s.GetDirectoryKey(id)
+
+	if cacheDirectory, found := s.cache.Get(key); found {
+		return cacheDirectory.(*models.Directory), nil
+	}
+
+	var directory models.Directory
+	_, err := s.bucket.Get(key, &directory)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, &directory, cacheExpiration)
+	return &directory, nil
+}
+
+// GetDirectoryByEmailDomain returns the Directory that users of the tenant with an email in the domain
+// sign in with. The tenant is empty for users that do not belong to a tenant.
+func (s *Store) GetDirectoryByEmailDomain(tenantID, domain string) (*models.Directory, error) {
+	params := map[string]interface{}{
+		"tenant_id": tenantID,
+		"domain":    strings.ToLower(domain),
+	}
+	rows, err := s.ExecuteQuery(n1qlGetDirectoryByEmailDomain, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var directory *models.Directory
+	if !rows.Next(&directory) {
+		return nil, rows.Close()
+	}
+
+	return directory, nil
+}
+
+// UpsertDirectory upserts the Directory
+func (s *Store) UpsertDirectory(directory *models.Directory) error {
+	key := s.GetDirectoryKey(directory.ID)
+	_, err := s.bucket.Upsert(key, directory, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
+}
+
+// GetDirectoryKey created a document key for a Directory document
+func (s *Store) GetDirectoryKey(id string) string {
+	return fmt.Sprintf("%s:directory:%s", config.ServiceName, id)
+}
@@ -0,0 +1,116 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetFederationByEmailDomain = "SELECT b.* FROM $bucket b WHERE b.__type = 'federation' AND ANY d IN b.email_domains SATISFIES LOWER(d) = $domain END LIMIT 1"
+)
+
+// GetFederation returns the Federation defined by the id
+func (s *Store) GetFederation(id string) (*models.Federation, error) {
+	key := s.GetFederationKey(id)
+
+	if cacheFederation, found := s.cache.Get(key); found {
+		return cacheFederation.(*models.Federation), nil
+	}
+
+	var federation models.Federation
+	_, err := s.bucket.Get(key, &federation)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, &federation, cacheExpiration)
+	return &federation, nil
+}
+
+// GetFederationByEmailDomain returns the Federation that users with an email in the domain sign in through
+func (s *Store) GetFederationByEmailDomain(domain string) (*models.Federation, error) {
+	params := map[string]interface{}{
+		"domain": strings.ToLower(domain),
+	}
+	rows, err := s.ExecuteQuery(n1qlGetFederationByEmailDomain, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var federation *models.Federation
+	if !rows.Next(&federation) {
+		return nil, rows.Close()
+	}
+
+	return federation, nil
+}
+
+// UpsertFederation upserts the Federation
+func (s *Store) UpsertFederation(federation *models.Federation) error {
+	key := s.GetFederationKey(federation.ID)
+	_, err := s.bucket.Upsert(key, federation, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
+}
+
+// GetFederationRequest returns the FederationRequest defined by the state
+func (s *Store) GetFederationRequest(state string) (*models.FederationRequest, error) {
+	key := s.GetFederationRequestKey(state)
+
+	var request models.FederationRequest
+
+	_, err := s.bucket.Get(key, &request)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// InsertFederationRequest saves a new FederationRequest
+func (s *Store) InsertFederationRequest(request *models.FederationRequest) error {
+	key := s.GetFederationRequestKey(request.State)
+	_, err := s.bucket.Insert(key, request, federationRequestExpiration)
+	return err
+}
+
+// DeleteFederationRequest deletes the FederationRequest. The return value is false if it had already
+// been deleted, which makes sure each state is only used once.
+func (s *Store) DeleteFederationRequest(state string) (bool, error) {
+	key := s.GetFederationRequestKey(state)
+	_, err := s.bucket.Remove(key, 0)
+	if err == gocb.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetFederationKey created a document key for a Federation document
+func (s *Store) GetFederationKey(id string) string {
+	return fmt.Sprintf("%s:federation:%s", config.ServiceName, id)
+}
+
+// GetFederationRequestKey created a document key for a FederationRequest document
+func (s *Store) GetFederationRequestKey(state string) string {
+	return fmt.Sprintf("%s:federation_request:%s", config.ServiceName, state)
+}
@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetGroupMembers = "SELECT b.* FROM $bucket b WHERE b.__type = 'user' AND ANY g IN b.`groups` SATISFIES g = $group_id END ORDER BY b.email"
+)
+
+// GetGroup returns the Group defined by the id
+func (s *Store) GetGroup(id string) (*models.Group, error) {
+	key := s.GetGroupKey(id)
+
+	if cacheGroup, found := s.cache.Get(key); found {
+		return cacheGroup.(*models.Group), nil
+	}
+
+	var group models.Group
+	_, err := s.bucket.Get(key, &group)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, &group, cache.DefaultExpiration)
+	return &group, nil
+}
+
+// UpsertGroup upserts the Group
+func (s *Store) UpsertGroup(group *models.Group) error {
+	key := s.GetGroupKey(group.ID)
+	_, err := s.bucket.Upsert(key, group, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
+}
+
+// DeleteGroup deletes the Group represented by the id. Members are not updated.
+func (s *Store) DeleteGroup(id string) error {
+	key := s.GetGroupKey(id)
+
+	s.cache.Delete(key)
+
+	_, err := s.bucket.Remove(key, 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetGroupMembers returns the users in the Group defined by the id
+func (s *Store) GetGroupMembers(id string) ([]*models.User, error) {
+	params := map[string]interface{}{
+		"group_id": id,
+	}
+	rows, err := s.ExecuteQuery(n1qlGetGroupMembers, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for {
+		var user models.User
+		if !rows.Next(&user) {
+			break
+		}
+		users = append(users, &user)
+	}
+
+	return users, nil
+}
+
+// SetUserGroups replaces the groups of the user without rewriting the rest of the user document
+func (s *Store) SetUserGroups(userID string, groups []string) error {
+	_, err := s.bucket.MutateIn(s.GetUserKey(userID), 0, 0).Upsert("groups", groups, true).Execute()
+	return err
+}
+
+// GetGroupKey created a document key for a Group document
+func (s *Store) GetGroupKey(id string) string {
+	return fmt.Sprintf("%s:group:%s", config.ServiceName, id)
+}
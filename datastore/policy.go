@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetPolicy returns the current version of the application's Policy
+func (s *Store) GetPolicy(applicationID string) (*models.Policy, error) {
+	key := s.GetPolicyKey(applicationID)
+
+	if cachePolicy, found := s.cache.Get(key); found {
+		return cachePolicy.(*models.Policy), nil
+	}
+
+	var policy models.Policy
+	_, err := s.bucket.Get(key, &policy)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, &policy, cache.DefaultExpiration)
+	return &policy, nil
+}
+
+// GetPolicyVersion returns a version of the application's Policy
+func (s *Store) GetPolicyVersion(applicationID string, version int) (*models.Policy, error) {
+	key := s.GetPolicyVersionKey(applicationID, version)
+
+	var policy models.Policy
+
+	_, err := s.bucket.Get(key, &policy)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// InsertPolicy saves a new version of the Policy and makes it the current version. gocb.ErrKeyExists
+// is returned if the version has already been saved.
+func (s *Store) InsertPolicy(policy *models.Policy) error {
+	_, err := s.bucket.Insert(s.GetPolicyVersionKey(policy.ApplicationID, policy.Version), policy, 0)
+	if err != nil {
+		return err
+	}
+
+	key := s.GetPolicyKey(policy.ApplicationID)
+	_, err = s.bucket.Upsert(key, policy, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
+}
+
+// GetPolicyKey created a document key for the current Policy document of an application
+func (s *Store) GetPolicyKey(applicationID string) string {
+	return fmt.Sprintf("%s:policy:%s", config.ServiceName, applicationID)
+}
+
+// GetPolicyVersionKey created a document key for a version of an application's Policy
+func (s *Store) GetPolicyVersionKey(applicationID string, version int) string {
+	return fmt.Sprintf("%s:policy:%s:%d", config.ServiceName, applicationID, version)
+}
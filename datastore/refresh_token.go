@@ -0,0 +1,176 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetRefreshToken returns the RefreshToken defined by the token
+func (s *Store) GetRefreshToken(token string) (*models.RefreshToken, error) {
+	key := s.GetRefreshTokenKey(token)
+
+	var refreshToken models.RefreshToken
+
+	_, err := s.bucket.Get(key, &refreshToken)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &refreshToken, nil
+}
+
+// InsertRefreshToken saves a new RefreshToken and adds it to its RefreshTokenFamily
+func (s *Store) InsertRefreshToken(refreshToken *models.RefreshToken) error {
+	key := s.GetRefreshTokenKey(refreshToken.Token)
+	_, err := s.bucket.Insert(key, refreshToken, s.GetRefreshTokenExpiration())
+	if err != nil {
+		return err
+	}
+
+	familyKey := s.GetRefreshTokenFamilyKey(refreshToken.FamilyID)
+	_, err = s.bucket.MutateIn(familyKey, 0, s.GetRefreshTokenExpiration()).
+		ArrayAppend("refresh_tokens", refreshToken.Token, true).
+		Execute()
+
+	return err
+}
+
+// UseRefreshToken marks the RefreshToken as used. The second return value is false if the token
+// had already been used, including by a concurrent request that used it first.
+func (s *Store) UseRefreshToken(token string) (*models.RefreshToken, bool, error) {
+	key := s.GetRefreshTokenKey(token)
+
+	var refreshToken models.RefreshToken
+
+	cas, err := s.bucket.Get(key, &refreshToken)
+	if err == gocb.ErrKeyNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if refreshToken.IsUsed {
+		return &refreshToken, false, nil
+	}
+
+	now := time.Now().UTC()
+	refreshToken.IsUsed = true
+	refreshToken.DateUsed = &now
+
+	// the used token is kept until it expires so that any reuse of it can be detected
+	_, err = s.bucket.Replace(key, &refreshToken, cas, s.GetRefreshTokenExpiration())
+	if err == gocb.ErrKeyExists {
+		return &refreshToken, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &refreshToken, true, nil
+}
+
+// GetRefreshTokenFamily returns the RefreshTokenFamily defined by the id
+func (s *Store) GetRefreshTokenFamily(id string) (*models.RefreshTokenFamily, error) {
+	key := s.GetRefreshTokenFamilyKey(id)
+
+	var family models.RefreshTokenFamily
+
+	_, err := s.bucket.Get(key, &family)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &family, nil
+}
+
+// UpsertRefreshTokenFamily upserts the RefreshTokenFamily object to the document store
+func (s *Store) UpsertRefreshTokenFamily(family *models.RefreshTokenFamily) error {
+	key := s.GetRefreshTokenFamilyKey(family.ID)
+	_, err := s.bucket.Upsert(key, family, s.GetRefreshTokenExpiration())
+	if err != nil || len(family.UserID) == 0 {
+		return err
+	}
+
+	return s.addToUserTokens(family.UserID, "refresh_token_families", family.ID)
+}
+
+// AddAccessTokenToRefreshTokenFamily records an AccessToken issued from the RefreshTokenFamily
+func (s *Store) AddAccessTokenToRefreshTokenFamily(id, token string) error {
+	key := s.GetRefreshTokenFamilyKey(id)
+	_, err := s.bucket.MutateIn(key, 0, s.GetRefreshTokenExpiration()).
+		ArrayAppend("access_tokens", token, true).
+		Execute()
+	return err
+}
+
+// AddJWTIDToRefreshTokenFamily records a JWT access token issued from the RefreshTokenFamily
+func (s *Store) AddJWTIDToRefreshTokenFamily(id, jwtID string) error {
+	key := s.GetRefreshTokenFamilyKey(id)
+	_, err := s.bucket.MutateIn(key, 0, s.GetRefreshTokenExpiration()).
+		ArrayAppend("jwt_ids", jwtID, true).
+		Execute()
+	return err
+}
+
+// RevokeRefreshTokenFamily deletes every AccessToken and RefreshToken issued from the family
+func (s *Store) RevokeRefreshTokenFamily(id string) error {
+	family, err := s.GetRefreshTokenFamily(id)
+	if err != nil {
+		return err
+	}
+	if family == nil {
+		return nil
+	}
+
+	for _, token := range family.AccessTokens {
+		err = s.DeleteAccessToken(token)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.revokeJWTIDs(family.JWTIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range family.RefreshTokens {
+		_, err = s.bucket.Remove(s.GetRefreshTokenKey(token), 0)
+		if err != nil && err != gocb.ErrKeyNotFound {
+			return err
+		}
+	}
+
+	_, err = s.bucket.Remove(s.GetRefreshTokenFamilyKey(id), 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetRefreshTokenExpiration returns the number of seconds a RefreshToken is valid for
+func (s *Store) GetRefreshTokenExpiration() uint32 {
+	return uint32(config.RefreshTokenTTL.Seconds())
+}
+
+// GetRefreshTokenKey created a document key for a RefreshToken document
+func (s *Store) GetRefreshTokenKey(token string) string {
+	return fmt.Sprintf("%s:refresh_token:%s", config.ServiceName, token)
+}
+
+// GetRefreshTokenFamilyKey created a document key for a RefreshTokenFamily document
+func (s *Store) GetRefreshTokenFamilyKey(id string) string {
+	return fmt.Sprintf("%s:refresh_token_family:%s", config.ServiceName, id)
+}
@@ -0,0 +1,197 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetRevokedTokens = "SELECT b.* FROM $bucket b WHERE b.__type = 'revoked_token' AND b.date_expires > $now"
+)
+
+// revocationList is the in-memory copy of the revoked tokens, so JWT access tokens can be checked
+// without a datastore lookup
+type revocationList struct {
+	mutex        sync.RWMutex
+	jwtIDs       map[string]*models.RevokedToken
+	applications map[string]*models.RevokedToken
+	sites        map[string]*models.RevokedToken
+}
+
+func newRevocationList() *revocationList {
+	l := &revocationList{}
+	l.replace(nil)
+	return l
+}
+
+func (l *revocationList) add(token *models.RevokedToken) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.set(token)
+}
+
+// replace swaps the entries of the list for the tokens
+func (l *revocationList) replace(tokens []*models.RevokedToken) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.jwtIDs = map[string]*models.RevokedToken{}
+	l.applications = map[string]*models.RevokedToken{}
+	l.sites = map[string]*models.RevokedToken{}
+	for _, token := range tokens {
+		l.set(token)
+	}
+}
+
+func (l *revocationList) set(token *models.RevokedToken) {
+	switch {
+	case len(token.JWTID) > 0:
+		l.jwtIDs[token.JWTID] = token
+	case len(token.ApplicationID) > 0:
+		l.applications[token.ApplicationID] = token
+	case len(token.SiteID) > 0:
+		l.sites[token.SiteID] = token
+	}
+}
+
+func (l *revocationList) contains(jwtID, applicationID, siteID string, issued time.Time) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	now := time.Now().UTC()
+	for _, entry := range []struct {
+		tokens map[string]*models.RevokedToken
+		id     string
+	}{
+		{l.jwtIDs, jwtID},
+		{l.applications, applicationID},
+		{l.sites, siteID},
+	} {
+		if len(entry.id) == 0 {
+			continue
+		}
+
+		token, found := entry.tokens[entry.id]
+		if !found || !token.DateExpires.After(now) {
+			continue
+		}
+		// tokens issued after an application or site was revoked are not affected
+		if token.DateRevoked == nil || !issued.After(*token.DateRevoked) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RevokeJWTID adds the id of a JWT access token to the revocation list until the token expires
+func (s *Store) RevokeJWTID(id string, expires time.Time) error {
+	return s.insertRevokedToken(s.GetRevokedTokenKey(id), &models.RevokedToken{
+		JWTID:       id,
+		DateExpires: expires,
+	})
+}
+
+// IsJWTRevoked returns true if the JWT access token, or the application or site it was issued to,
+// is on the revocation list. The list is kept in memory and updated by RefreshRevocationList.
+func (s *Store) IsJWTRevoked(jwtID, applicationID, siteID string, issued time.Time) bool {
+	return s.revoked.contains(jwtID, applicationID, siteID, issued)
+}
+
+// RefreshRevocationList replaces the in-memory revocation list with the revoked tokens in the
+// datastore, picking up the ones revoked by other instances
+func (s *Store) RefreshRevocationList() error {
+	tokens, err := s.GetRevokedTokens()
+	if err != nil {
+		return err
+	}
+
+	s.revoked.replace(tokens)
+	return nil
+}
+
+// GetRevokedTokens returns every revoked JWT access token that has not yet expired
+func (s *Store) GetRevokedTokens() ([]*models.RevokedToken, error) {
+	params := map[string]interface{}{
+		"now": time.Now().UTC(),
+	}
+	rows, err := s.ExecuteQuery(n1qlGetRevokedTokens, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.RevokedToken{}
+	for {
+		var token models.RevokedToken
+		if !rows.Next(&token) {
+			break
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+// revokeJWTIDs revokes the JWT access tokens. Their expiry is not known so each stays on the
+// revocation list for the full access token lifetime.
+func (s *Store) revokeJWTIDs(ids []string) error {
+	expires := time.Now().UTC().Add(config.AccessTokenTTL)
+	for _, id := range ids {
+		err := s.RevokeJWTID(id, expires)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeApplicationJWTs revokes every JWT access token issued to the application so far, for the
+// full access token lifetime, since those tokens are not stored
+func (s *Store) revokeApplicationJWTs(id string) error {
+	now := time.Now().UTC()
+	return s.insertRevokedToken(s.GetRevokedTokenKey("application:"+id), &models.RevokedToken{
+		ApplicationID: id,
+		DateRevoked:   &now,
+		DateExpires:   now.Add(config.AccessTokenTTL),
+	})
+}
+
+// revokeSiteJWTs revokes every JWT access token issued for the site so far, for the full access
+// token lifetime
+func (s *Store) revokeSiteJWTs(id string) error {
+	now := time.Now().UTC()
+	return s.insertRevokedToken(s.GetRevokedTokenKey("site:"+id), &models.RevokedToken{
+		SiteID:      id,
+		DateRevoked: &now,
+		DateExpires: now.Add(config.AccessTokenTTL),
+	})
+}
+
+// insertRevokedToken saves the revoked token until it expires and adds it to this instance's
+// revocation list straight away
+func (s *Store) insertRevokedToken(key string, token *models.RevokedToken) error {
+	ttl := token.DateExpires.Sub(time.Now().UTC())
+	if ttl <= 0 {
+		return nil
+	}
+
+	_, err := s.bucket.Upsert(key, token, uint32(ttl.Seconds())+1)
+	if err != nil {
+		return err
+	}
+
+	s.revoked.add(token)
+	return nil
+}
+
+// GetRevokedTokenKey created a document key for a RevokedToken document
+func (s *Store) GetRevokedTokenKey(id string) string {
+	return fmt.Sprintf("%s:revoked_token:%s", config.ServiceName, id)
+}
@@ -0,0 +1,54 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/models"
+)
+
+func TestRevocationListContains(t *testing.T) {
+	now := time.Now().UTC()
+	revoked := now.Add(-time.Minute)
+
+	l := newRevocationList()
+	l.replace([]*models.RevokedToken{
+		{JWTID: "revoked", DateExpires: now.Add(time.Hour)},
+		{JWTID: "expired", DateExpires: now.Add(-time.Second)},
+		{ApplicationID: "application", DateRevoked: &revoked, DateExpires: now.Add(time.Hour)},
+		{SiteID: "site", DateRevoked: &revoked, DateExpires: now.Add(time.Hour)},
+	})
+
+	tests := []struct {
+		name          string
+		jwtID         string
+		applicationID string
+		siteID        string
+		issued        time.Time
+		expected      bool
+	}{
+		{"token not revoked", "other", "other", "other", now.Add(-time.Hour), false},
+		{"revoked token", "revoked", "other", "other", now.Add(-time.Hour), true},
+		{"revocation has expired", "expired", "other", "other", now.Add(-time.Hour), false},
+		{"issued before the application was revoked", "other", "application", "other", now.Add(-time.Hour), true},
+		{"issued when the application was revoked", "other", "application", "other", revoked, true},
+		{"issued after the application was revoked", "other", "application", "other", now, false},
+		{"issued before the site was revoked", "other", "other", "site", now.Add(-time.Hour), true},
+		{"issued after the site was revoked", "other", "other", "site", now, false},
+		{"token without a site", "other", "other", "", now.Add(-time.Hour), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := l.contains(test.jwtID, test.applicationID, test.siteID, test.issued); actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+
+	// replacing the list drops the entries that are no longer revoked
+	l.replace(nil)
+	if l.contains("revoked", "application", "site", now.Add(-time.Hour)) {
+		t.Error("expected an empty list after it was replaced")
+	}
+}
@@ -0,0 +1,40 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetRoleAssignments returns the roles assigned to the user defined by the id
+func (s *Store) GetRoleAssignments(userID string) (*models.RoleAssignments, error) {
+	key := s.GetRoleAssignmentsKey(userID)
+
+	var assignments models.RoleAssignments
+
+	_, err := s.bucket.Get(key, &assignments)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &assignments, nil
+}
+
+// UpsertRoleAssignments upserts the RoleAssignments object to the document store
+func (s *Store) UpsertRoleAssignments(assignments *models.RoleAssignments) error {
+	key := s.GetRoleAssignmentsKey(assignments.UserID)
+	_, err := s.bucket.Upsert(key, assignments, 0)
+	return err
+}
+
+// GetRoleAssignmentsKey created a document key for a RoleAssignments document
+func (s *Store) GetRoleAssignmentsKey(userID string) string {
+	return fmt.Sprintf("%s:role_assignments:%s", config.ServiceName, strings.ToLower(userID))
+}
@@ -0,0 +1,54 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetSAMLRequest returns the SAMLRequest defined by the id
+func (s *Store) GetSAMLRequest(id string) (*models.SAMLRequest, error) {
+	key := s.GetSAMLRequestKey(id)
+
+	var request models.SAMLRequest
+
+	_, err := s.bucket.Get(key, &request)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// InsertSAMLRequest saves a new SAMLRequest
+func (s *Store) InsertSAMLRequest(request *models.SAMLRequest) error {
+	key := s.GetSAMLRequestKey(request.ID)
+	_, err := s.bucket.Insert(key, request, samlRequestExpiration)
+	return err
+}
+
+// DeleteSAMLRequest deletes the SAMLRequest. The return value is false if it had already been
+// deleted, which makes sure only one response is issued for each request.
+func (s *Store) DeleteSAMLRequest(id string) (bool, error) {
+	key := s.GetSAMLRequestKey(id)
+	_, err := s.bucket.Remove(key, 0)
+	if err == gocb.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetSAMLRequestKey created a document key for a SAMLRequest document
+func (s *Store) GetSAMLRequestKey(id string) string {
+	return fmt.Sprintf("%s:saml_request:%s", config.ServiceName, id)
+}
@@ -0,0 +1,76 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetServiceAccounts = "SELECT b.* FROM $bucket b WHERE b.__type = 'service_account' AND IFMISSINGORNULL(b.tenant_id, '') = $tenant_id ORDER BY b.name"
+)
+
+// GetServiceAccount returns the ServiceAccount defined by the id. Service accounts are not cached so
+// a deleted account or replaced key stops working straight away.
+func (s *Store) GetServiceAccount(id string) (*models.ServiceAccount, error) {
+	key := s.GetServiceAccountKey(id)
+
+	var account models.ServiceAccount
+
+	_, err := s.bucket.Get(key, &account)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// GetServiceAccounts returns the ServiceAccounts of the tenant ordered by name
+func (s *Store) GetServiceAccounts(tenantID string) ([]*models.ServiceAccount, error) {
+	params := map[string]interface{}{
+		"tenant_id": tenantID,
+	}
+	rows, err := s.ExecuteQuery(n1qlGetServiceAccounts, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []*models.ServiceAccount{}
+	for {
+		var account models.ServiceAccount
+		if !rows.Next(&account) {
+			break
+		}
+		accounts = append(accounts, &account)
+	}
+
+	return accounts, nil
+}
+
+// UpsertServiceAccount upserts the ServiceAccount
+func (s *Store) UpsertServiceAccount(account *models.ServiceAccount) error {
+	_, err := s.bucket.Upsert(s.GetServiceAccountKey(account.ID), account, 0)
+	return err
+}
+
+// DeleteServiceAccount deletes the ServiceAccount represented by the id
+func (s *Store) DeleteServiceAccount(id string) error {
+	_, err := s.bucket.Remove(s.GetServiceAccountKey(id), 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetServiceAccountKey created a document key for a ServiceAccount document
+func (s *Store) GetServiceAccountKey(id string) string {
+	return fmt.Sprintf("%s:service_account:%s", config.ServiceName, id)
+}
@@ -0,0 +1,106 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	n1qlGetSigningKeys = "SELECT b.* FROM $bucket b WHERE b.__type = 'signing_key' ORDER BY b.date_created"
+)
+
+// GetSigningKeys returns every published SigningKey, oldest first
+func (s *Store) GetSigningKeys() ([]*models.SigningKey, error) {
+	cacheKey := s.GetSigningKeysCacheKey()
+	if cacheKeys, found := s.cache.Get(cacheKey); found {
+		return cacheKeys.([]*models.SigningKey), nil
+	}
+
+	rows, err := s.ExecuteQuery(n1qlGetSigningKeys, nil, func(q *gocb.N1qlQuery) {
+		q.Consistency(gocb.RequestPlus)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.SigningKey{}
+	for {
+		var key models.SigningKey
+		if !rows.Next(&key) {
+			break
+		}
+		keys = append(keys, &key)
+	}
+
+	s.cache.Set(cacheKey, keys, cacheExpiration)
+	return keys, nil
+}
+
+// UpsertSigningKey upserts the SigningKey object to the document store
+func (s *Store) UpsertSigningKey(key *models.SigningKey) error {
+	_, err := s.bucket.Upsert(s.GetSigningKeyKey(key.ID), key, 0)
+	s.cache.Delete(s.GetSigningKeysCacheKey())
+	return err
+}
+
+// DeleteSigningKey deletes the SigningKey represented by the id
+func (s *Store) DeleteSigningKey(id string) error {
+	_, err := s.bucket.Remove(s.GetSigningKeyKey(id), 0)
+	s.cache.Delete(s.GetSigningKeysCacheKey())
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteSigningKeysFromCache removes the list of SigningKeys from the cache
+func (s *Store) DeleteSigningKeysFromCache() error {
+	s.cache.Delete(s.GetSigningKeysCacheKey())
+
+	return nil
+}
+
+// LockSigningKeyRotation takes a short lived lock so that only one instance rotates keys at a time.
+// Returns false if another instance holds the lock.
+func (s *Store) LockSigningKeyRotation() (bool, error) {
+	_, err := s.bucket.Insert(s.GetSigningKeyLockKey(), true, lockExpiration)
+	if err == gocb.ErrKeyExists {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UnlockSigningKeyRotation releases the lock taken by LockSigningKeyRotation
+func (s *Store) UnlockSigningKeyRotation() error {
+	_, err := s.bucket.Remove(s.GetSigningKeyLockKey(), 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetSigningKeyKey created a document key for a SigningKey document
+func (s *Store) GetSigningKeyKey(id string) string {
+	return fmt.Sprintf("%s:signing_key:%s", config.ServiceName, id)
+}
+
+// GetSigningKeyLockKey created a document key for the signing key rotation lock
+func (s *Store) GetSigningKeyLockKey() string {
+	return fmt.Sprintf("%s:signing_key_lock", config.ServiceName)
+}
+
+// GetSigningKeysCacheKey created a cache key for the list of SigningKeys
+func (s *Store) GetSigningKeysCacheKey() string {
+	return fmt.Sprintf("%s:signing_keys", config.ServiceName)
+}
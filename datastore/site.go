@@ -4,44 +4,163 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/pemiller/authentication/config"
 	"github.com/pemiller/authentication/models"
 
 	"github.com/couchbase/gocb"
+	cache "github.com/patrickmn/go-cache"
 )
 
 const (
-	n1qlGetSiteByURL = "SELECT b.* FROM $bucket b WHERE b.__type = 'site' AND b.site_url = $url"
+	n1qlGetSiteByURL    = "SELECT b.* FROM $bucket b WHERE b.__type = 'site' AND b.site_url = $url AND IFMISSINGORNULL(b.tenant_id, '') = $tenant_id LIMIT 1"
+	n1qlGetSiteByNumber = "SELECT b.* FROM $bucket b WHERE b.__type = 'site' AND b.site_number = $number AND IFMISSINGORNULL(b.tenant_id, '') = $tenant_id LIMIT 1"
+	n1qlSearchSites     = "SELECT b.* FROM $bucket b WHERE b.__type = 'site' AND IFMISSINGORNULL(b.tenant_id, '') = $tenant_id AND ($search = '' OR CONTAINS(LOWER(b.site_name), $search) OR CONTAINS(LOWER(b.site_url), $search) OR b.site_number = $search) ORDER BY b.site_name, b.site_id LIMIT $limit OFFSET $offset"
 )
 
-// GetSite returns the site by ID
+// GetSite returns the site by ID. Sites saved before keys were namespaced are read from their old key.
 func (s *Store) GetSite(id string) (*models.Site, error) {
+	if cacheSite, found := s.cache.Get(s.GetSiteKey(id)); found {
+		return cacheSite.(*models.Site), nil
+	}
+
+	return s.GetCurrentSite(id)
+}
+
+// GetCurrentSite returns the site by ID read from the bucket instead of the cache, so a site deactivated
+// on another instance is seen at once. It is used wherever the site's availability is checked.
+func (s *Store) GetCurrentSite(id string) (*models.Site, error) {
 	key := s.GetSiteKey(id)
 
-	var site models.Site
+	site, err := s.getSiteByKey(key)
+	if err == nil && site == nil {
+		site, err = s.getSiteByKey(s.getLegacySiteKey(id))
+	}
+	if err != nil || site == nil {
+		return nil, err
+	}
 
-	_, err := s.bucket.Get(key, &site)
-	if err == gocb.ErrKeyNotFound {
-		return nil, nil
+	s.cache.Set(key, site, cache.DefaultExpiration)
+	return site, nil
+}
+
+// GetSiteByURL returns the site of the tenant by URL. The tenant is empty for sites that do not
+// belong to a tenant.
+func (s *Store) GetSiteByURL(tenantID, url string) (*models.Site, error) {
+	params := map[string]interface{}{
+		"url":       url,
+		"tenant_id": tenantID,
+	}
+	rows, err := s.ExecuteQuery(n1qlGetSiteByURL, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var site *models.Site
+	if !rows.Next(&site) {
+		return nil, rows.Close()
 	}
+
+	return site, nil
+}
+
+// SearchSites returns a page of the tenant's Sites ordered by name. When search is set only the sites
+// whose name, number or url contains it are returned.
+func (s *Store) SearchSites(tenantID, search string, offset, limit int) ([]*models.Site, error) {
+	params := map[string]interface{}{
+		"tenant_id": tenantID,
+		"search":    strings.ToLower(search),
+		"offset":    offset,
+		"limit":     limit,
+	}
+	rows, err := s.ExecuteQuery(n1qlSearchSites, params)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &site, nil
+	sites := []*models.Site{}
+	for {
+		var site models.Site
+		if !rows.Next(&site) {
+			break
+		}
+		sites = append(sites, &site)
+	}
+
+	return sites, nil
 }
 
-// GetSiteByURL returns the site by URL
-func (s *Store) GetSiteByURL(url string) (*models.Site, error) {
+// GetSiteByNumber returns the site of the tenant by its site number
+func (s *Store) GetSiteByNumber(tenantID, number string) (*models.Site, error) {
 	params := map[string]interface{}{
-		"url": url,
+		"number":    number,
+		"tenant_id": tenantID,
 	}
-	rows, err := s.ExecuteQuery(n1qlGetSiteByURL, params)
+	rows, err := s.ExecuteQuery(n1qlGetSiteByNumber, params)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
+	var site *models.Site
+	if !rows.Next(&site) {
+		return nil, rows.Close()
+	}
+
+	return site, nil
+}
+
+// UpsertSite upserts the Site. A copy saved under the old key is removed so the site is not listed twice.
+func (s *Store) UpsertSite(site *models.Site) error {
+	key := s.GetSiteKey(site.SiteID)
+	_, err := s.bucket.Upsert(key, site, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+
+	_, err = s.bucket.Remove(s.getLegacySiteKey(site.SiteID), 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteSite deletes the Site represented by the id
+func (s *Store) DeleteSite(id string) error {
+	s.cache.Delete(s.GetSiteKey(id))
+
+	for _, key := range []string{s.GetSiteKey(id), s.getLegacySiteKey(id)} {
+		_, err := s.bucket.Remove(key, 0)
+		if err != nil && err != gocb.ErrKeyNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeSiteTokens deletes every AccessToken and RefreshToken issued for the site and puts its JWT
+// access tokens on the revocation list
+func (s *Store) RevokeSiteTokens(id string) error {
+	err := s.revokeTokensBy("site_id", id, false)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSiteJWTs(id)
+}
+
+func (s *Store) getSiteByKey(key string) (*models.Site, error) {
 	var site models.Site
-	err = rows.One(&site)
+
+	_, err := s.bucket.Get(key, &site)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -51,5 +170,10 @@ func (s *Store) GetSiteByURL(url string) (*models.Site, error) {
 
 // GetSiteKey created a document key for a Site document
 func (s *Store) GetSiteKey(id string) string {
+	return fmt.Sprintf("%s:site:%s", config.ServiceName, strings.ToLower(id))
+}
+
+// getLegacySiteKey returns the key Site documents were saved under before it included the service name
+func (s *Store) getLegacySiteKey(id string) string {
 	return fmt.Sprintf("site:%s", strings.ToLower(id))
 }
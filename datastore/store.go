@@ -16,18 +16,39 @@ import (
 const ContextKey = "datastore"
 
 var (
-	authCodeExpiration         = uint32((time.Hour * 336).Seconds()) // 2 weeks
-	applicationTokenExpiration = uint32((time.Hour * 24).Seconds())  // 1 day
-	accessTokenExpiration      = uint32((time.Hour * 24).Seconds())  // 1 day
-	failCountExpiration        = uint32((time.Minute * 5).Seconds()) // 5 minutes
-	cacheExpiration            = time.Duration(20 * time.Second)     // 20 seconds
+	authCodeExpiration             = uint32((time.Hour * 336).Seconds())  // 2 weeks
+	applicationTokenExpiration     = uint32((time.Hour * 24).Seconds())   // 1 day
+	failCountExpiration            = uint32((time.Minute * 5).Seconds())  // 5 minutes
+	lockExpiration                 = uint32((time.Minute * 1).Seconds())  // 1 minute
+	samlRequestExpiration          = uint32((time.Minute * 10).Seconds()) // 10 minutes
+	federationRequestExpiration    = uint32((time.Minute * 10).Seconds()) // 10 minutes
+	requestNonceExpiration         = uint32((time.Minute * 10).Seconds()) // 10 minutes
+	authorizationRequestExpiration = uint32((time.Minute * 10).Seconds()) // 10 minutes
+	authorizationCodeExpiration    = uint32((time.Minute * 1).Seconds())  // 1 minute
+	cacheExpiration                = time.Duration(20 * time.Second)      // 20 seconds
 )
 
+// Bucket is the part of a couchbase bucket used by Store, so tests can stand in for the document store
+type Bucket interface {
+	Get(key string, valuePtr interface{}) (gocb.Cas, error)
+	Touch(key string, cas gocb.Cas, expiry uint32) (gocb.Cas, error)
+	Remove(key string, cas gocb.Cas) (gocb.Cas, error)
+	Upsert(key string, value interface{}, expiry uint32) (gocb.Cas, error)
+	Insert(key string, value interface{}, expiry uint32) (gocb.Cas, error)
+	Replace(key string, value interface{}, cas gocb.Cas, expiry uint32) (gocb.Cas, error)
+	Counter(key string, delta, initial int64, expiry uint32) (uint64, gocb.Cas, error)
+	ExecuteN1qlQuery(q *gocb.N1qlQuery, params interface{}) (gocb.QueryResults, error)
+	LookupIn(key string) *gocb.LookupInBuilder
+	MutateIn(key string, cas gocb.Cas, expiry uint32) *gocb.MutateInBuilder
+	MutateInEx(key string, flags gocb.SubdocDocFlag, cas gocb.Cas, expiry uint32) *gocb.MutateInBuilder
+}
+
 // Store is an object that contains connections to data stores.
 type Store struct {
 	cluster    *gocb.Cluster
-	bucket     *gocb.Bucket
+	bucket     Bucket
 	cache      *cache.Cache
+	revoked    *revocationList
 	bucketName string
 }
 
@@ -76,12 +97,20 @@ func NewStore(cache *cache.Cache, service, source string) (*Store, error) {
 	}
 	bucket.SetTranscoder(transcoder)
 
+	store := NewStoreWithBucket(cache, bucket, parsedURL.Path[1:])
+	store.cluster = cluster
+	return store, nil
+}
+
+// NewStoreWithBucket initializes a Store with an open bucket and cache. The store is shared by every
+// request, since it holds the in-memory revocation list.
+func NewStoreWithBucket(cache *cache.Cache, bucket Bucket, bucketName string) *Store {
 	return &Store{
-		cluster:    cluster,
 		bucket:     bucket,
 		cache:      cache,
-		bucketName: parsedURL.Path[1:],
-	}, nil
+		revoked:    newRevocationList(),
+		bucketName: bucketName,
+	}
 }
 
 // GetFromContext returns the Store associated with the context
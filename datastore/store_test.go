@@ -0,0 +1,42 @@
+package datastore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/couchbase/gocb"
+	cache "github.com/patrickmn/go-cache"
+)
+
+// testBucket keeps documents in memory as JSON. Methods the tests do not use are left to the embedded
+// interface and panic.
+type testBucket struct {
+	Bucket
+	documents map[string][]byte
+}
+
+func newTestStore(documents map[string]interface{}) (*Store, *testBucket) {
+	bucket := &testBucket{documents: map[string][]byte{}}
+	for key, value := range documents {
+		bucket.Upsert(key, value, 0)
+	}
+
+	return NewStoreWithBucket(cache.New(time.Minute, time.Minute), bucket, "test"), bucket
+}
+
+func (b *testBucket) Get(key string, valuePtr interface{}) (gocb.Cas, error) {
+	data, found := b.documents[key]
+	if !found {
+		return 0, gocb.ErrKeyNotFound
+	}
+	return 1, json.Unmarshal(data, valuePtr)
+}
+
+func (b *testBucket) Upsert(key string, value interface{}, expiry uint32) (gocb.Cas, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	b.documents[key] = data
+	return 1, nil
+}
@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couchbase/gocb"
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetTenant returns the Tenant defined by the id
+func (s *Store) GetTenant(id string) (*models.Tenant, error) {
+	key := s.GetTenantKey(id)
+
+	if cacheTenant, found := s.cache.Get(key); found {
+		return cacheTenant.(*models.Tenant), nil
+	}
+
+	var tenant models.Tenant
+	_, err := s.bucket.Get(key, &tenant)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, &tenant, cache.DefaultExpiration)
+	return &tenant, nil
+}
+
+// UpsertTenant upserts the Tenant
+func (s *Store) UpsertTenant(tenant *models.Tenant) error {
+	key := s.GetTenantKey(tenant.ID)
+	_, err := s.bucket.Upsert(key, tenant, 0)
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(key)
+	return nil
+}
+
+// GetTenantKey created a document key for a Tenant document
+func (s *Store) GetTenantKey(id string) string {
+	return fmt.Sprintf("%s:tenant:%s", config.ServiceName, strings.ToLower(id))
+}
@@ -33,9 +33,10 @@ func (s *Store) GetUserByKey(key string) (*models.User, error) {
 	return &user, err
 }
 
-// GetUserByEmail returns the user by email
-func (s *Store) GetUserByEmail(email string) (*models.User, error) {
-	userRef, err := s.GetUserRef(email)
+// GetUserByEmail returns the user of the tenant by email. The tenant is empty for users that do not
+// belong to a tenant.
+func (s *Store) GetUserByEmail(tenantID, email string) (*models.User, error) {
+	userRef, err := s.GetUserRef(tenantID, email)
 	if err != nil {
 		return nil, err
 	}
@@ -56,9 +57,9 @@ func (s *Store) GetUserByEmail(email string) (*models.User, error) {
 	return &user, err
 }
 
-// GetUserRef returns the UserRef document for the email
-func (s *Store) GetUserRef(email string) (*models.UserRef, error) {
-	key := s.GetUserRefKey(email)
+// GetUserRef returns the UserRef document for the email in the tenant
+func (s *Store) GetUserRef(tenantID, email string) (*models.UserRef, error) {
+	key := s.GetUserRefKey(tenantID, email)
 
 	var userRef models.UserRef
 
@@ -73,9 +74,36 @@ func (s *Store) GetUserRef(email string) (*models.UserRef, error) {
 	return &userRef, err
 }
 
+// InsertUser saves a new User and the UserRef for its email. An error is returned if the email is
+// already in use in the user's tenant.
+func (s *Store) InsertUser(user *models.User) error {
+	_, err := s.bucket.Insert(s.GetUserRefKey(user.TenantID, user.Email), &models.UserRef{UserRef: s.GetUserKey(user.ID)}, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.bucket.Insert(s.GetUserKey(user.ID), user, 0)
+	return err
+}
+
+// UpsertUser upserts the User
+func (s *Store) UpsertUser(user *models.User) error {
+	_, err := s.bucket.Upsert(s.GetUserKey(user.ID), user, 0)
+	return err
+}
+
+// SetUserAdmin sets the admin flag and admin permissions of the user without rewriting the rest of the user document
+func (s *Store) SetUserAdmin(userID string, isAdmin bool, permissions []string) error {
+	_, err := s.bucket.MutateIn(s.GetUserKey(userID), 0, 0).
+		Upsert("is_admin", isAdmin, true).
+		Upsert("admin_permissions", permissions, true).
+		Execute()
+	return err
+}
+
 // UserIsLocked returns true if account is locked
-func (s *Store) UserIsLocked(email string) (bool, error) {
-	key := s.GetLockedKey(email)
+func (s *Store) UserIsLocked(tenantID, email string) (bool, error) {
+	key := s.GetLockedKey(tenantID, email)
 
 	var locked bool
 
@@ -91,8 +119,8 @@ func (s *Store) UserIsLocked(email string) (bool, error) {
 }
 
 // IncrLoginFailCount increments the fail count of a user and locks account when failed 5 times. Returns if locked
-func (s *Store) IncrLoginFailCount(email string) (bool, error) {
-	key := s.GetFailCountKey(email)
+func (s *Store) IncrLoginFailCount(tenantID, email string) (bool, error) {
+	key := s.GetFailCountKey(tenantID, email)
 
 	i, _, err := s.bucket.Counter(key, 1, 1, failCountExpiration)
 	if err != nil {
@@ -100,7 +128,7 @@ func (s *Store) IncrLoginFailCount(email string) (bool, error) {
 	}
 
 	if i >= 5 {
-		key = s.GetLockedKey(email)
+		key = s.GetLockedKey(tenantID, email)
 
 		_, err := s.bucket.Upsert(key, true, failCountExpiration)
 		if err != nil {
@@ -112,8 +140,8 @@ func (s *Store) IncrLoginFailCount(email string) (bool, error) {
 }
 
 // ClearLoginFailCount clears failcount entry for the email
-func (s *Store) ClearLoginFailCount(email string) error {
-	key := s.GetFailCountKey(email)
+func (s *Store) ClearLoginFailCount(tenantID, email string) error {
+	key := s.GetFailCountKey(tenantID, email)
 
 	_, err := s.bucket.Remove(key, 0)
 	if err == gocb.ErrKeyNotFound {
@@ -123,7 +151,7 @@ func (s *Store) ClearLoginFailCount(email string) error {
 		return err
 	}
 
-	key = s.GetLockedKey(email)
+	key = s.GetLockedKey(tenantID, email)
 
 	_, err = s.bucket.Remove(key, 0)
 	if err == gocb.ErrKeyNotFound {
@@ -150,18 +178,27 @@ func (s *Store) GetUserKey(id string) string {
 }
 
 // GetUserRefKey created a document key for a UserRef document
-func (s *Store) GetUserRefKey(email string) string {
-	return fmt.Sprintf("%s:user_ref:%s", config.ServiceName, strings.ToLower(email))
+func (s *Store) GetUserRefKey(tenantID, email string) string {
+	return fmt.Sprintf("%s:user_ref:%s", config.ServiceName, tenantEmail(tenantID, email))
 }
 
 // GetLockedKey created a document key for a Locked document
-func (s *Store) GetLockedKey(email string) string {
-	return fmt.Sprintf("%s:locked:%s", config.ServiceName, strings.ToLower(email))
+func (s *Store) GetLockedKey(tenantID, email string) string {
+	return fmt.Sprintf("%s:locked:%s", config.ServiceName, tenantEmail(tenantID, email))
 }
 
 // GetFailCountKey created a document key for a FailCount document
-func (s *Store) GetFailCountKey(email string) string {
-	return fmt.Sprintf("%s:fail_count:%s", config.ServiceName, strings.ToLower(email))
+func (s *Store) GetFailCountKey(tenantID, email string) string {
+	return fmt.Sprintf("%s:fail_count:%s", config.ServiceName, tenantEmail(tenantID, email))
+}
+
+// tenantEmail prefixes the email with the tenant so the same email can be used in each tenant. Users
+// without a tenant keep the keys they had before tenants were added.
+func tenantEmail(tenantID, email string) string {
+	if len(tenantID) == 0 {
+		return strings.ToLower(email)
+	}
+	return fmt.Sprintf("%s:%s", strings.ToLower(tenantID), strings.ToLower(email))
 }
 
 func (s *Store) updateLoginDate(id, path string, authType models.AuthTypeValue, ip string) error {
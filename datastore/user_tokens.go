@@ -0,0 +1,210 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// userTokensLimit is the number of entries a list in a user's token index can hold before it is trimmed
+const userTokensLimit = 100
+
+// userTokensLive reports whether the token of an entry in a list of the user's token index may still
+// be used, by list
+var userTokensLive = map[string]func(s *Store, value string) (bool, error){
+	"auth_codes":             userTokenDocumentExists((*Store).GetAuthCodeKey),
+	"access_tokens":          userTokenDocumentExists((*Store).GetAccessTokenKey),
+	"refresh_token_families": userTokenDocumentExists((*Store).GetRefreshTokenFamilyKey),
+	"jwt_ids": func(s *Store, value string) (bool, error) {
+		_, expires := parseJWTIndexEntry(value)
+		return expires.After(time.Now().UTC()), nil
+	},
+}
+
+// userTokenDocumentExists returns a check that the document of the token has not expired or been deleted
+func userTokenDocumentExists(key func(s *Store, value string) string) func(s *Store, value string) (bool, error) {
+	return func(s *Store, value string) (bool, error) {
+		var doc interface{}
+		_, err := s.bucket.Get(key(s, value), &doc)
+		if err == gocb.ErrKeyNotFound {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+// jwtIndexEntry returns the entry of a JWT access token in the user's token index. JWT access tokens
+// are not stored, so the entry keeps the expiry the index is trimmed by.
+func jwtIndexEntry(id string, expires time.Time) string {
+	return fmt.Sprintf("%s@%d", id, expires.Unix())
+}
+
+// parseJWTIndexEntry returns the id and expiry of a JWT access token in the user's token index.
+// Entries indexed without an expiry are treated as living the full access token lifetime from now.
+func parseJWTIndexEntry(value string) (string, time.Time) {
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		if seconds, err := strconv.ParseInt(value[i+1:], 10, 64); err == nil {
+			return value[:i], time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	return value, time.Now().UTC().Add(config.AccessTokenTTL)
+}
+
+// GetUserTokens returns the index of tokens issued to the user
+func (s *Store) GetUserTokens(userID string) (*models.UserTokens, error) {
+	key := s.GetUserTokensKey(userID)
+
+	var userTokens models.UserTokens
+
+	_, err := s.bucket.Get(key, &userTokens)
+	if err == gocb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &userTokens, nil
+}
+
+// RevokeUserTokens deletes every AuthCode, AccessToken and RefreshToken issued to the user
+func (s *Store) RevokeUserTokens(userID string) error {
+	userTokens, err := s.GetUserTokens(userID)
+	if err != nil {
+		return err
+	}
+	if userTokens == nil {
+		return nil
+	}
+
+	for _, id := range userTokens.RefreshTokenFamilies {
+		err = s.RevokeRefreshTokenFamily(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, token := range userTokens.AccessTokens {
+		err = s.DeleteAccessToken(token)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, value := range userTokens.JWTIDs {
+		err = s.RevokeJWTID(parseJWTIndexEntry(value))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, code := range userTokens.AuthCodes {
+		err = s.DeleteAuthCode(code)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.bucket.Remove(s.GetUserTokensKey(userID), 0)
+	if err == gocb.ErrKeyNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteUserAuthCodesDetailedFromCache removes the cached AuthCodeDetailed of every AuthCode issued to the
+// user, so that changes to the sites they can access are seen straight away
+func (s *Store) DeleteUserAuthCodesDetailedFromCache(userID string) error {
+	userTokens, err := s.GetUserTokens(userID)
+	if err != nil || userTokens == nil {
+		return err
+	}
+
+	for _, code := range userTokens.AuthCodes {
+		s.DeleteAuthCodeDetailedFromCache(code)
+	}
+	return nil
+}
+
+// GetUserTokensKey created a document key for a UserTokens document
+func (s *Store) GetUserTokensKey(userID string) string {
+	return fmt.Sprintf("%s:user_tokens:%s", config.ServiceName, strings.ToLower(userID))
+}
+
+// addToUserTokens appends the value to a list in the user's token index, creating the document
+// if needed. The index lives as long as the longest lived token it can contain, so the list is
+// trimmed once it grows past userTokensLimit, and again for every half of the limit it grows by while
+// the tokens in it are still live.
+func (s *Store) addToUserTokens(userID, path, value string) error {
+	key := s.GetUserTokensKey(userID)
+	_, err := s.bucket.MutateInEx(key, gocb.SubdocDocFlagMkDoc, 0, s.getUserTokensExpiry()).
+		ArrayAppend(path, value, true).
+		Execute()
+	if err != nil {
+		return err
+	}
+
+	frag, err := s.bucket.LookupIn(key).Get(path).Execute()
+	if err != nil {
+		return err
+	}
+	var values []string
+	err = frag.Content(path, &values)
+	if err != nil || len(values) <= userTokensLimit || (len(values)-userTokensLimit-1)%(userTokensLimit/2) != 0 {
+		return err
+	}
+
+	return s.trimUserTokens(key, frag.Cas(), path, values)
+}
+
+// trimUserTokens removes the tokens that have expired or been deleted from a list in the user's token
+// index. Tokens that may still be used are never revoked to keep the index small. Nothing is saved if
+// another token was added to the index in the meantime, as a later append trims it instead.
+func (s *Store) trimUserTokens(key string, cas gocb.Cas, path string, values []string) error {
+	kept, err := s.liveUserTokens(path, values)
+	if err != nil || len(kept) == len(values) {
+		return err
+	}
+
+	_, err = s.bucket.MutateIn(key, cas, s.getUserTokensExpiry()).
+		Replace(path, kept).
+		Execute()
+	if err == gocb.ErrKeyExists {
+		return nil
+	}
+	return err
+}
+
+// liveUserTokens returns the entries of a list in the user's token index whose tokens may still be used
+func (s *Store) liveUserTokens(path string, values []string) ([]string, error) {
+	live := userTokensLive[path]
+
+	kept := []string{}
+	for _, value := range values {
+		ok, err := live(s, value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, value)
+		}
+	}
+
+	return kept, nil
+}
+
+func (s *Store) getUserTokensExpiry() uint32 {
+	if s.GetRefreshTokenExpiration() > authCodeExpiration {
+		return s.GetRefreshTokenExpiration()
+	}
+
+	return authCodeExpiration
+}
@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+)
+
+func TestLiveUserTokens(t *testing.T) {
+	config.AccessTokenTTL = time.Hour
+
+	keys := &Store{}
+	store, _ := newTestStore(map[string]interface{}{
+		keys.GetAuthCodeKey("live-code"):                map[string]string{},
+		keys.GetAccessTokenKey("live-token"):            map[string]string{},
+		keys.GetRefreshTokenFamilyKey("live-family"):    map[string]string{},
+		keys.GetRefreshTokenFamilyKey("another-family"): map[string]string{},
+	})
+
+	now := time.Now().UTC()
+	live := jwtIndexEntry("live-jwt", now.Add(time.Hour))
+	expired := jwtIndexEntry("expired-jwt", now.Add(-time.Second))
+
+	tests := []struct {
+		name     string
+		path     string
+		values   []string
+		expected []string
+	}{
+		{
+			name:     "expired and deleted auth codes",
+			path:     "auth_codes",
+			values:   []string{"deleted-code", "live-code"},
+			expected: []string{"live-code"},
+		},
+		{
+			name:     "expired and deleted access tokens",
+			path:     "access_tokens",
+			values:   []string{"live-token", "deleted-token"},
+			expected: []string{"live-token"},
+		},
+		{
+			name:     "live refresh token families are kept however many there are",
+			path:     "refresh_token_families",
+			values:   []string{"live-family", "another-family", "revoked-family"},
+			expected: []string{"live-family", "another-family"},
+		},
+		{
+			name:     "expired JWT access tokens",
+			path:     "jwt_ids",
+			values:   []string{expired, live},
+			expected: []string{live},
+		},
+		{
+			name:     "JWT access tokens indexed without an expiry",
+			path:     "jwt_ids",
+			values:   []string{"legacy-jwt"},
+			expected: []string{"legacy-jwt"},
+		},
+		{
+			name:     "nothing live",
+			path:     "auth_codes",
+			values:   []string{"deleted-code"},
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kept, err := store.liveUserTokens(test.path, test.values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(kept, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, kept)
+			}
+		})
+	}
+}
+
+func TestParseJWTIndexEntry(t *testing.T) {
+	config.AccessTokenTTL = time.Hour
+	expires := time.Date(2026, 11, 1, 2, 0, 0, 0, time.UTC)
+
+	id, actual := parseJWTIndexEntry(jwtIndexEntry("jwt-id", expires))
+	if id != "jwt-id" || !actual.Equal(expires) {
+		t.Errorf("expected jwt-id expiring %s, got %s expiring %s", expires, id, actual)
+	}
+
+	id, actual = parseJWTIndexEntry("legacy-jwt")
+	if id != "legacy-jwt" || actual.Before(time.Now().UTC().Add(config.AccessTokenTTL-time.Minute)) {
+		t.Errorf("expected an entry without expiry to live the full access token lifetime, got %s expiring %s", id, actual)
+	}
+}
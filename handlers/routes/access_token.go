@@ -27,6 +27,11 @@ func CreateAccessToken(c *gin.Context) {
 		return
 	}
 
+	if authCode.PasswordChangeRequired {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.PasswordChangeRequiredMessage, nil))
+		return
+	}
+
 	// get user document from couchbase datastore
 	user, err := datastore.GetFromContext(c).GetUser(authCode.UserID)
 	if err != nil {
@@ -48,41 +53,328 @@ func CreateAccessToken(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Site not found", nil))
 		return
 	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteUnavailableMessage, nil))
+		return
+	}
+
+	// the user must have access to the site directly or through one of their groups
+	sites, err := getEffectiveSites(c, user)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return
+	}
+	if !helpers.HasScope(sites, site.SiteID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("User does not have access to the site", nil))
+		return
+	}
 
 	app := middleware.GetApplication(c)
+	allowed, err := isApplicationSite(c, app, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteNotAllowedMessage, nil))
+		return
+	}
+
+	// the scopes of the AuthCode can be narrowed for the new AccessToken
+	form := &models.CreateAccessTokenRequest{}
+	if c.Request.Body != http.NoBody {
+		err = c.BindJSON(form)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+			return
+		}
+	}
+	scopes, ok := helpers.NarrowScopes(authCode.Scopes, helpers.ParseScope(form.Scope))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Scope was not granted to the AuthCode", nil))
+		return
+	}
+
+	decision, err := checkTokenPolicy(c, app, authCode, user, site, scopes)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to evaluate policy", err))
+		return
+	}
+	if !decision.Allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(policyDeniedMessage(decision), nil))
+		return
+	}
+
+	model, err := createUserAccessToken(c, app, authCode, user, site, scopes, "")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AccessToken", err))
+		return
+	}
+
+	c.Header(middleware.AccessTokenHeaderKey, model.Token)
+	c.Header(middleware.SiteHeaderKey, site.SiteURL)
+	c.JSON(http.StatusCreated, model)
+}
+
+// RefreshAccessToken exchanges the refresh token in the body for a new AccessToken and RefreshToken
+func RefreshAccessToken(c *gin.Context) {
+	form := &models.RefreshTokenRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+	if len(form.RefreshToken) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing refresh_token", nil))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	model, gErr := refreshUserAccessToken(c, app, form.RefreshToken, form.Scope)
+	if gErr != nil {
+		c.AbortWithStatusJSON(gErr.Status, helpers.PrepareErrorResponse(gErr.Message, gErr.Err))
+		return
+	}
+
+	c.Header(middleware.AccessTokenHeaderKey, model.Token)
+	c.Header(middleware.SiteHeaderKey, model.Site.SiteURL)
+	c.JSON(http.StatusCreated, model)
+}
+
+// createUserAccessToken saves a new AccessToken and RefreshToken for the user with the scopes. A new
+// RefreshTokenFamily is started when familyID is empty, otherwise the tokens are added to the existing family.
+func createUserAccessToken(c *gin.Context, app *models.Application, authCode *models.AuthCode, user *models.User, site *models.Site, scopes []string, familyID string) (*models.AccessTokenDetailed, error) {
+	now := time.Now().UTC()
+
+	roles, err := getUserRoles(c, user.ID, app.ID, site.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := getAccessTokenTTL(c, app.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(familyID) == 0 {
+		family := &models.RefreshTokenFamily{
+			ID:            uuid.New().String(),
+			UserID:        user.ID,
+			ApplicationID: app.ID,
+			AuthCode:      authCode.Code,
+			SiteID:        site.SiteID,
+			RefreshTokens: []string{},
+			AccessTokens:  []string{},
+			DateCreated:   now,
+		}
+
+		err = datastore.GetFromContext(c).UpsertRefreshTokenFamily(family)
+		if err != nil {
+			return nil, err
+		}
+		familyID = family.ID
+	}
+
 	accessToken := &models.AccessToken{
 		Token:         helpers.GenerateAccessToken(authCode.Code),
 		Type:          models.AccessTokenTypeUser,
 		ApplicationID: app.ID,
+		UserID:        user.ID,
 		AuthCode:      authCode.Code,
 		SiteID:        site.SiteID,
-		DateCreated:   time.Now().UTC(),
+		FamilyID:      familyID,
+		Scopes:        scopes,
+		Roles:         roles,
+		DateCreated:   now,
+		DateExpires:   now.Add(ttl),
 	}
 
-	// save AccessToken to data store
-	err = datastore.GetFromContext(c).UpsertAccessToken(accessToken)
+	err = saveAccessToken(c, app, accessToken, authCode)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AccessToken", err))
-		return
+		return nil, err
+	}
+
+	if len(accessToken.JWTID) > 0 {
+		err = datastore.GetFromContext(c).AddJWTIDToRefreshTokenFamily(familyID, accessToken.JWTID)
+	} else {
+		err = datastore.GetFromContext(c).AddAccessTokenToRefreshTokenFamily(familyID, accessToken.Token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := helpers.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := &models.RefreshToken{
+		Token:         token,
+		FamilyID:      familyID,
+		ApplicationID: app.ID,
+		AuthCode:      authCode.Code,
+		SiteID:        site.SiteID,
+		Scopes:        scopes,
+		DateCreated:   now,
+	}
+
+	// save RefreshToken to data store
+	err = datastore.GetFromContext(c).InsertRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
 	}
 
 	model := &models.AccessTokenDetailed{
 		Token:               accessToken.Token,
+		DateExpires:         accessToken.DateExpires,
 		UserID:              user.ID,
 		Email:               user.Email,
 		IsValidated:         user.IsValidated,
 		DatePasswordExpires: user.DateExpires,
 		Site:                site,
-		Status:              helpers.GetLoginStatus(user.IsValidated, user.DateExpires),
+		Status:              getLoginStatus(user, authCode),
 		AuthType:            authCode.AuthType,
 		Application:         app,
+		Scopes:              helpers.GetAccessTokenScopes(accessToken, authCode),
+		Roles:               roles,
 	}
 
+	// the refresh and ID tokens are only returned to the caller that created them, never from the cache
 	datastore.GetFromContext(c).UpsertAccessTokenDetailedToCache(model)
 	datastore.GetFromContext(c).UpdateLoginDateForSite(user.ID, site.SiteID, authCode.AuthType, authCode.IP)
-	c.Header(middleware.AccessTokenHeaderKey, accessToken.Token)
-	c.Header(middleware.SiteHeaderKey, site.SiteURL)
-	c.JSON(http.StatusCreated, model)
+
+	response := *model
+	response.RefreshToken = refreshToken.Token
+	if helpers.HasScope(authCode.Scopes, models.ScopeOpenID) {
+		response.IDToken, err = createIDToken(c, app, authCode, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &response, nil
+}
+
+// saveAccessToken saves the AccessToken to the data store. When the application uses JWT access tokens
+// nothing is saved and the token is replaced with a signed JWT.
+func saveAccessToken(c *gin.Context, app *models.Application, accessToken *models.AccessToken, authCode *models.AuthCode) error {
+	if app.AccessTokenFormat != models.AccessTokenFormatJWT {
+		return datastore.GetFromContext(c).UpsertAccessToken(accessToken)
+	}
+
+	accessToken.JWTID = uuid.New().String()
+	token, err := helpers.CreateAccessTokenJWT(c, app, accessToken, authCode)
+	if err != nil {
+		return err
+	}
+	accessToken.Token = token
+
+	return datastore.GetFromContext(c).IndexJWTAccessToken(accessToken)
+}
+
+// refreshUserAccessToken uses the refresh token to create a new AccessToken and RefreshToken in the same
+// family. If the refresh token has already been used, the whole family is revoked. The scope can only
+// narrow the scopes of the refresh token.
+func refreshUserAccessToken(c *gin.Context, app *models.Application, token, scope string) (*models.AccessTokenDetailed, *grantError) {
+	refreshToken, ok, err := datastore.GetFromContext(c).UseRefreshToken(token)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to use refresh token", err)
+	}
+	if refreshToken == nil {
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "Refresh token not found", nil)
+	}
+
+	// a reused token, or one presented by another application, is treated as stolen
+	if !ok || refreshToken.ApplicationID != app.ID {
+		err = datastore.GetFromContext(c).RevokeRefreshTokenFamily(refreshToken.FamilyID)
+		if err != nil {
+			return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to revoke refresh token family", err)
+		}
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "Refresh token has already been used", nil)
+	}
+
+	// the tenant may give refresh tokens a shorter lifetime than the deployment stores them for
+	expires, err := getRefreshTokenExpiry(c, refreshToken)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get tenant", err)
+	}
+	if expires.Before(time.Now().UTC()) {
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "Refresh token has expired", nil)
+	}
+
+	family, err := datastore.GetFromContext(c).GetRefreshTokenFamily(refreshToken.FamilyID)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get refresh token family", err)
+	}
+	if family == nil {
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "Refresh token has been revoked", nil)
+	}
+
+	authCode, err := datastore.GetFromContext(c).GetAuthCode(refreshToken.AuthCode)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get AuthCode", err)
+	}
+	if authCode == nil {
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "Cannot find AuthCode", nil)
+	}
+
+	user, err := datastore.GetFromContext(c).GetUser(authCode.UserID)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get user", err)
+	}
+	if user == nil {
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "User not found", nil)
+	}
+
+	site, err := datastore.GetFromContext(c).GetCurrentSite(refreshToken.SiteID)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get site", err)
+	}
+	if site == nil {
+		return nil, newGrantError(http.StatusUnauthorized, helpers.OAuthErrorInvalidGrant, "Site not found", nil)
+	}
+	if !site.IsAvailable() {
+		return nil, newGrantError(http.StatusForbidden, helpers.OAuthErrorAccessDenied, helpers.SiteUnavailableMessage, nil)
+	}
+
+	// access removed since the refresh token was issued, including through a group, ends the session
+	allowed, err := hasSiteAccess(c, user.ID, site.SiteID)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get list of sites", err)
+	}
+	if !allowed {
+		return nil, newGrantError(http.StatusForbidden, helpers.OAuthErrorAccessDenied, "User does not have access to the site", nil)
+	}
+	allowed, err = isApplicationSite(c, app, site.SiteID)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to get tenant", err)
+	}
+	if !allowed {
+		return nil, newGrantError(http.StatusForbidden, helpers.OAuthErrorAccessDenied, helpers.SiteNotAllowedMessage, nil)
+	}
+
+	granted := refreshToken.Scopes
+	if granted == nil {
+		granted = authCode.Scopes
+	}
+	scopes, ok := helpers.NarrowScopes(granted, helpers.ParseScope(scope))
+	if !ok {
+		return nil, newGrantError(http.StatusBadRequest, helpers.OAuthErrorInvalidScope, "Scope was not granted to the refresh token", nil)
+	}
+
+	decision, err := checkTokenPolicy(c, app, authCode, user, site, scopes)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to evaluate policy", err)
+	}
+	if !decision.Allowed {
+		return nil, newGrantError(http.StatusForbidden, helpers.OAuthErrorAccessDenied, policyDeniedMessage(decision), nil)
+	}
+
+	model, err := createUserAccessToken(c, app, authCode, user, site, scopes, refreshToken.FamilyID)
+	if err != nil {
+		return nil, newGrantError(http.StatusInternalServerError, helpers.OAuthErrorServerError, "Unable to create AccessToken", err)
+	}
+
+	return model, nil
 }
 
 // CreateApplicationAccessToken creates a new access token for an Application and Site in the request header
@@ -104,6 +396,21 @@ func CreateApplicationAccessToken(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Site not found", nil))
 		return
 	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteUnavailableMessage, nil))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	allowed, err := isApplicationSite(c, app, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteNotAllowedMessage, nil))
+		return
+	}
 
 	// get the ip address from the body if it was provided
 	form := &models.CreateAuthCodeRequest{}
@@ -115,52 +422,75 @@ func CreateApplicationAccessToken(c *gin.Context) {
 		}
 	}
 
-	app := middleware.GetApplication(c)
+	scopes, ok := helpers.NarrowScopes(app.Scopes, helpers.ParseScope(form.Scope))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Scope is not allowed for the application", nil))
+		return
+	}
+
+	model, err := createApplicationAccessToken(c, app, site, scopes, form.IP)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AccessToken", err))
+		return
+	}
+
+	c.Header(middleware.AccessTokenHeaderKey, model.Token)
+	c.Header(middleware.SiteHeaderKey, site.SiteURL)
+	c.JSON(http.StatusCreated, model)
+}
+
+// createApplicationAccessToken saves a new AuthCode and AccessToken with the scopes for the Application and Site
+func createApplicationAccessToken(c *gin.Context, app *models.Application, site *models.Site, scopes []string, ip string) (*models.AccessTokenDetailed, error) {
 	authCode := &models.AuthCode{
 		Code:          helpers.GenerateAuthCode(),
 		ApplicationID: app.ID,
 		AuthType:      models.AuthTypeApplication,
 		Sites:         []string{},
-		IP:            form.IP,
+		IP:            ip,
 		DateCreated:   time.Now().UTC(),
 	}
 
+	ttl, err := getAccessTokenTTL(c, app.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
 	// save AuthCode to data store
 	err = datastore.GetFromContext(c).UpsertAuthCode(authCode)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AuthCode", err))
-		return
+		return nil, err
 	}
 
+	now := time.Now().UTC()
 	accessToken := &models.AccessToken{
 		Token:         helpers.GenerateAccessToken(authCode.Code),
 		Type:          models.AccessTokenTypeApplication,
 		ApplicationID: app.ID,
 		AuthCode:      authCode.Code,
 		SiteID:        site.SiteID,
-		DateCreated:   time.Now().UTC(),
+		Scopes:        scopes,
+		DateCreated:   now,
+		DateExpires:   now.Add(ttl),
 	}
 
-	// save AccessToken to data store
-	err = datastore.GetFromContext(c).UpsertAccessToken(accessToken)
+	err = saveAccessToken(c, app, accessToken, authCode)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AccessToken", err))
-		return
+		return nil, err
 	}
 
 	model := &models.AccessTokenDetailed{
 		Token:       accessToken.Token,
+		DateExpires: accessToken.DateExpires,
 		IsValidated: true,
 		Site:        site,
 		Status:      helpers.GetLoginStatus(true, nil),
 		AuthType:    authCode.AuthType,
 		Application: app,
+		Scopes:      scopes,
 	}
 
 	datastore.GetFromContext(c).UpsertAccessTokenDetailedToCache(model)
-	c.Header(middleware.AccessTokenHeaderKey, accessToken.Token)
-	c.Header(middleware.SiteHeaderKey, site.SiteURL)
-	c.JSON(http.StatusCreated, model)
+	return model, nil
 }
 
 // GetAccessToken returns data related to the access token
@@ -179,8 +509,28 @@ func GetAccessToken(c *gin.Context) {
 		app := middleware.GetApplication(c)
 		authCode := middleware.GetAuthCode(c)
 
+		// get site from couchbase datastore
+		site, err := datastore.GetFromContext(c).GetSite(accessToken.SiteID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+			return
+		}
+		if site == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Site not found", nil))
+			return
+		}
+
 		if accessToken.Type == models.AccessTokenTypeApplication {
-			// NYI
+			response = &models.AccessTokenDetailed{
+				Token:       accessToken.Token,
+				DateExpires: accessToken.DateExpires,
+				IsValidated: true,
+				Site:        site,
+				Status:      helpers.GetLoginStatus(true, nil),
+				AuthType:    authCode.AuthType,
+				Application: app,
+				Scopes:      helpers.GetAccessTokenScopes(accessToken, authCode),
+			}
 		} else {
 			// get user document from couchbase datastore
 			user, err := datastore.GetFromContext(c).GetUser(authCode.UserID)
@@ -193,27 +543,20 @@ func GetAccessToken(c *gin.Context) {
 				return
 			}
 
-			// get site from couchbase datastore
-			site, err := datastore.GetFromContext(c).GetSite(accessToken.SiteID)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
-				return
-			}
-			if site == nil {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Site not found", nil))
-				return
-			}
-
 			response = &models.AccessTokenDetailed{
 				Token:               accessToken.Token,
+				DateExpires:         accessToken.DateExpires,
 				UserID:              user.ID,
 				Email:               user.Email,
 				IsValidated:         user.IsValidated,
 				DatePasswordExpires: user.DateExpires,
 				Site:                site,
-				Status:              helpers.GetLoginStatus(user.IsValidated, user.DateExpires),
+				Status:              getLoginStatus(user, authCode),
 				AuthType:            authCode.AuthType,
 				Application:         app,
+				Scopes:              helpers.GetAccessTokenScopes(accessToken, authCode),
+				Roles:               accessToken.Roles,
+				ImpersonatorID:      accessToken.ImpersonatorID,
 			}
 		}
 
@@ -224,28 +567,42 @@ func GetAccessToken(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// DeleteAccessToken deletes the access token
+// DeleteAccessToken deletes the access token along with any tokens refreshed from the same grant
 func DeleteAccessToken(c *gin.Context) {
 	accessToken := middleware.GetAccessToken(c)
-	datastore.GetFromContext(c).DeleteAccessToken(accessToken.Token)
+	if len(accessToken.FamilyID) > 0 {
+		datastore.GetFromContext(c).RevokeRefreshTokenFamily(accessToken.FamilyID)
+	}
+	if len(accessToken.JWTID) > 0 {
+		datastore.GetFromContext(c).RevokeJWTID(accessToken.JWTID, accessToken.DateExpires)
+	} else {
+		datastore.GetFromContext(c).DeleteAccessToken(accessToken.Token)
+	}
 	c.Status(http.StatusNoContent)
 }
 
-func getSite(c context.Context, siteID string) (*models.Site, error) {
+// getSite returns the site defined by the id or url if it belongs to the tenant of the application in the context
+func getSite(c *gin.Context, siteID string) (*models.Site, error) {
+	return getTenantSite(c, getTenantID(c), siteID)
+}
+
+// getTenantSite returns the site defined by the id or url if it belongs to the tenant. Sites of other
+// tenants are treated as not found.
+func getTenantSite(c context.Context, tenantID, siteID string) (*models.Site, error) {
 	var err error
 	var site *models.Site
 
 	_, err = uuid.Parse(siteID)
 	if err == nil {
-		site, err = datastore.GetFromContext(c).GetSite(siteID)
+		site, err = datastore.GetFromContext(c).GetCurrentSite(siteID)
 	} else {
-		site, err = datastore.GetFromContext(c).GetSiteByURL(siteID)
+		site, err = datastore.GetFromContext(c).GetSiteByURL(tenantID, siteID)
 	}
 
 	if err != nil {
 		return nil, err
 	}
-	if site == nil {
+	if site == nil || site.TenantID != tenantID {
 		return nil, nil
 	}
 
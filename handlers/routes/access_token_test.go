@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+func TestCreateAccessTokenPasswordChangeRequired(t *testing.T) {
+	tests := []struct {
+		name                   string
+		passwordChangeRequired bool
+		expected               int
+	}{
+		// the user is missing from the test store, so a code that passes the check stops there
+		{"password meets the policy", false, http.StatusNotFound},
+		{"password must be changed", true, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authCode := &models.AuthCode{Code: "code", UserID: "user", PasswordChangeRequired: test.passwordChangeRequired}
+			r, _ := newTestRouter(http.MethodPost, "/token", func(c *gin.Context) {
+				middleware.SetAuthCode(c, authCode)
+				CreateAccessToken(c)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/token", nil)
+			request.Header.Set(middleware.SiteHeaderKey, "site")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			if w.Code != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, w.Code)
+			}
+		})
+	}
+}
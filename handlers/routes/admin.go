@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// UpdateUserAdmin grants or removes the admin access of the user defined by the id. Admins cannot
+// change their own access, grant permissions they do not have or change admins with more permissions.
+func UpdateUserAdmin(c *gin.Context) {
+	form := &models.UpdateAdminRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	admin := middleware.GetAdmin(c)
+	if c.Param("id") == admin.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Cannot change your own admin access", nil))
+		return
+	}
+
+	user, ok := loadAdminUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if user.IsAdmin {
+		if message := helpers.ValidateAdminPermissions(admin, user.AdminPermissions); len(message) > 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Cannot change an admin with more permissions", nil))
+			return
+		}
+	}
+
+	// an admin without permissions cannot do anything until they are granted, "*" grants every permission
+	permissions := form.Permissions
+	if message := helpers.ValidateAdminPermissions(admin, permissions); len(message) > 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(message, nil))
+		return
+	}
+	if !form.IsAdmin || permissions == nil {
+		permissions = []string{}
+	}
+
+	err = datastore.GetFromContext(c).SetUserAdmin(user.ID, form.IsAdmin, permissions)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save user", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// Page sizes of the admin lists when the request does not set a limit, and the largest allowed
+const (
+	adminPageLimit    = 50
+	adminPageLimitMax = 100
+)
+
+// ListApplications returns a page of the tenant's Applications, optionally only those matching the search
+// in the query. Super admins can list another tenant with the tenant_id query.
+func ListApplications(c *gin.Context) {
+	tenantID, ok := getAdminTenantQuery(c)
+	if !ok {
+		return
+	}
+	offset, limit, ok := getAdminPage(c)
+	if !ok {
+		return
+	}
+
+	apps, err := datastore.GetFromContext(c).SearchApplications(tenantID, c.Query("search"), offset, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get applications", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, apps)
+}
+
+// CreateApplication saves a new Application from the body. A client secret is created and returned
+// if the application authenticates with one.
+func CreateApplication(c *gin.Context) {
+	app := &models.Application{}
+	err := c.BindJSON(app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	tenantID := app.TenantID
+	app.ID = uuid.New().String()
+	app.TenantID = middleware.GetAdmin(c).TenantID
+	if !bindAdminTenantID(c, &app.TenantID, tenantID, true) || !validateApplication(c, app) {
+		return
+	}
+
+	saveApplication(c, app, http.StatusCreated)
+}
+
+// GetApplication returns the Application defined by the id
+func GetApplication(c *gin.Context) {
+	app, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// UpdateApplication replaces the Application defined by the id with the body. A client secret is created
+// and returned if the application changes to a secret authentication method without one.
+func UpdateApplication(c *gin.Context) {
+	existing, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+
+	app := &models.Application{}
+	err := c.BindJSON(app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	tenantID := app.TenantID
+	app.ID = existing.ID
+	app.TenantID = existing.TenantID
+	if !bindAdminTenantID(c, &app.TenantID, tenantID, false) || !validateApplication(c, app) {
+		return
+	}
+
+	saveApplication(c, app, http.StatusOK)
+}
+
+// DeleteApplication revokes every token issued to the Application defined by the id and deletes it
+func DeleteApplication(c *gin.Context) {
+	app, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+	if current := middleware.GetApplication(c); current != nil && current.ID == app.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Cannot delete the application making the request", nil))
+		return
+	}
+
+	err := deleteApplication(c, app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete application", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// saveApplication creates the first client secret of the Application if it needs one, saves it and
+// writes the response with the status
+func saveApplication(c *gin.Context, app *models.Application, status int) {
+	clientSecret, err := createRegisteredClientSecret(c, app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create client secret", err))
+		return
+	}
+
+	err = datastore.GetFromContext(c).UpsertApplication(app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save application", err))
+		return
+	}
+
+	if len(clientSecret) > 0 {
+		c.Header("Cache-Control", "no-store")
+		c.Header("Pragma", "no-cache")
+	}
+	c.JSON(status, &models.ApplicationResponse{
+		Application:  app,
+		ClientSecret: clientSecret,
+	})
+}
+
+// deleteApplication revokes every token issued to the application and deletes it with its client
+// secrets and client registration
+func deleteApplication(c *gin.Context, id string) error {
+	store := datastore.GetFromContext(c)
+
+	// the application is deleted last so the tokens cannot be used while they are revoked
+	err := store.RevokeApplicationTokens(id)
+	if err == nil {
+		err = store.DeleteApplicationSecrets(id)
+	}
+	if err == nil {
+		err = store.DeleteClientRegistration(id)
+	}
+	if err == nil {
+		err = store.DeleteApplication(id)
+	}
+	return err
+}
+
+// validateApplication checks the Application can be saved. The request is aborted and false is returned
+// if it is not valid, allows a site of another tenant or its SAML entity id is used by another application.
+func validateApplication(c *gin.Context, app *models.Application) bool {
+	if message := helpers.ValidateApplication(app); len(message) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse(message, nil))
+		return false
+	}
+
+	if !validateSites(c, app.TenantID, app.AllowedSites) {
+		return false
+	}
+
+	if app.SAML != nil {
+		existing, err := datastore.GetFromContext(c).GetApplicationBySAMLEntityID(app.SAML.EntityID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+			return false
+		}
+		if existing != nil && existing.ID != app.ID {
+			c.AbortWithStatusJSON(http.StatusConflict, helpers.PrepareErrorResponse("SAML entity_id is used by another application", nil))
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadApplication gets the Application defined by the id if the admin in the context may manage it. The
+// request is aborted and false is returned if it cannot be found.
+func loadApplication(c *gin.Context) (*models.Application, bool) {
+	app, err := datastore.GetFromContext(c).GetApplication(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return nil, false
+	}
+	if app == nil || !middleware.CanAdminTenant(c, app.TenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Application not found", nil))
+		return nil, false
+	}
+
+	return app, true
+}
+
+// getAdminPage returns the offset and limit in the query of an admin list. The request is aborted and
+// false is returned if either is not valid.
+func getAdminPage(c *gin.Context) (int, int, bool) {
+	offset := 0
+	if value := c.Query("offset"); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid offset", err))
+			return 0, 0, false
+		}
+		offset = n
+	}
+
+	limit := adminPageLimit
+	if value := c.Query("limit"); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > adminPageLimitMax {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid limit", err))
+			return 0, 0, false
+		}
+		limit = n
+	}
+
+	return offset, limit, true
+}
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// CreateApplicationSecret creates a new client secret for the application. Existing secrets remain
+// active so that the secret can be rotated without downtime.
+func CreateApplicationSecret(c *gin.Context) {
+	createApplicationSecret(c, middleware.GetApplication(c))
+}
+
+// CreateAdminApplicationSecret creates a new client secret for the Application defined by the id. This
+// is how an application is given its first secret.
+func CreateAdminApplicationSecret(c *gin.Context) {
+	app, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+
+	createApplicationSecret(c, app)
+}
+
+// createApplicationSecret creates a new client secret for the application from the body and writes the
+// response with its value
+func createApplicationSecret(c *gin.Context, app *models.Application) {
+	form := &models.CreateApplicationSecretRequest{}
+	if c.Request.Body != http.NoBody {
+		err := c.BindJSON(form)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+			return
+		}
+	}
+
+	secrets, err := datastore.GetFromContext(c).GetApplicationSecrets(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get client secrets", err))
+		return
+	}
+	if secrets == nil {
+		secrets = &models.ApplicationSecrets{ApplicationID: app.ID}
+	}
+
+	value, err := helpers.GenerateClientSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to generate client secret", err))
+		return
+	}
+
+	secret := &models.ApplicationSecret{
+		ID:          uuid.New().String(),
+		Hash:        helpers.HashClientSecret(value),
+		Description: form.Description,
+		DateCreated: time.Now().UTC(),
+	}
+	if form.ExpiresIn > 0 {
+		expires := secret.DateCreated.Add(time.Duration(form.ExpiresIn) * time.Second)
+		secret.DateExpires = &expires
+	}
+
+	// drop expired secrets while the document is being rewritten
+	secrets.Secrets = append(helpers.ActiveClientSecrets(secrets), secret)
+
+	err = datastore.GetFromContext(c).UpsertApplicationSecrets(secrets)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save client secret", err))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusCreated, &models.ApplicationSecretResponse{
+		ID:          secret.ID,
+		Secret:      value,
+		Description: secret.Description,
+		DateCreated: secret.DateCreated,
+		DateExpires: secret.DateExpires,
+	})
+}
+
+// GetApplicationSecrets returns the active client secrets for the application without their values
+func GetApplicationSecrets(c *gin.Context) {
+	app := middleware.GetApplication(c)
+	secrets, err := datastore.GetFromContext(c).GetApplicationSecrets(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get client secrets", err))
+		return
+	}
+
+	response := []*models.ApplicationSecretResponse{}
+	for _, secret := range helpers.ActiveClientSecrets(secrets) {
+		response = append(response, &models.ApplicationSecretResponse{
+			ID:          secret.ID,
+			Description: secret.Description,
+			DateCreated: secret.DateCreated,
+			DateExpires: secret.DateExpires,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteApplicationSecret removes the client secret defined by the id from the application
+func DeleteApplicationSecret(c *gin.Context) {
+	app := middleware.GetApplication(c)
+	secrets, err := datastore.GetFromContext(c).GetApplicationSecrets(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get client secrets", err))
+		return
+	}
+	if secrets == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Client secret not found", nil))
+		return
+	}
+
+	id := c.Param("id")
+	remaining := []*models.ApplicationSecret{}
+	for _, secret := range secrets.Secrets {
+		if secret.ID != id {
+			remaining = append(remaining, secret)
+		}
+	}
+	if len(remaining) == len(secrets.Secrets) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Client secret not found", nil))
+		return
+	}
+
+	secrets.Secrets = remaining
+	err = datastore.GetFromContext(c).UpsertApplicationSecrets(secrets)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save client secrets", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// CreateApplicationSigningKey creates a new request signing secret for the application. Existing keys
+// remain usable so that the secret can be rotated without downtime.
+func CreateApplicationSigningKey(c *gin.Context) {
+	createApplicationSigningKey(c, middleware.GetApplication(c))
+}
+
+// CreateAdminApplicationSigningKey creates a new request signing secret for the Application defined by
+// the id
+func CreateAdminApplicationSigningKey(c *gin.Context) {
+	app, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+
+	createApplicationSigningKey(c, app)
+}
+
+// createApplicationSigningKey creates a new request signing secret for the application from the body and
+// writes the response with its value
+func createApplicationSigningKey(c *gin.Context, app *models.Application) {
+	form := &models.CreateApplicationSecretRequest{}
+	if c.Request.Body != http.NoBody {
+		err := c.BindJSON(form)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+			return
+		}
+	}
+
+	keys, err := datastore.GetFromContext(c).GetApplicationSigningKeys(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing keys", err))
+		return
+	}
+	if keys == nil {
+		keys = &models.ApplicationSigningKeys{ApplicationID: app.ID}
+	}
+
+	value, err := helpers.GenerateClientSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to generate signing key", err))
+		return
+	}
+
+	encrypted, err := helpers.Encrypt([]byte(value))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to encrypt signing key", err))
+		return
+	}
+
+	key := &models.ApplicationSigningKey{
+		ID:              uuid.New().String(),
+		EncryptedSecret: encrypted,
+		Description:     form.Description,
+		DateCreated:     time.Now().UTC(),
+	}
+	keys.Keys = append(keys.Keys, key)
+
+	err = datastore.GetFromContext(c).UpsertApplicationSigningKeys(keys)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save signing key", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, &models.ApplicationSecretResponse{
+		ID:          key.ID,
+		Secret:      value,
+		Description: key.Description,
+		DateCreated: key.DateCreated,
+	})
+}
+
+// GetApplicationSigningKeys returns the request signing keys for the application without their values
+func GetApplicationSigningKeys(c *gin.Context) {
+	app := middleware.GetApplication(c)
+	keys, err := datastore.GetFromContext(c).GetApplicationSigningKeys(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing keys", err))
+		return
+	}
+
+	response := []*models.ApplicationSecretResponse{}
+	if keys != nil {
+		for _, key := range keys.Keys {
+			response = append(response, &models.ApplicationSecretResponse{
+				ID:          key.ID,
+				Description: key.Description,
+				DateCreated: key.DateCreated,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteApplicationSigningKey removes the request signing key defined by the id from the application
+func DeleteApplicationSigningKey(c *gin.Context) {
+	app := middleware.GetApplication(c)
+	keys, err := datastore.GetFromContext(c).GetApplicationSigningKeys(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing keys", err))
+		return
+	}
+	if keys == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Signing key not found", nil))
+		return
+	}
+
+	id := c.Param("id")
+	remaining := []*models.ApplicationSigningKey{}
+	for _, key := range keys.Keys {
+		if key.ID != id {
+			remaining = append(remaining, key)
+		}
+	}
+	if len(remaining) == len(keys.Keys) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Signing key not found", nil))
+		return
+	}
+
+	keys.Keys = remaining
+	err = datastore.GetFromContext(c).UpsertApplicationSigningKeys(keys)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save signing keys", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+)
+
+// auditEventsLimit is the number of AuditEvents returned when the request does not set a limit
+const auditEventsLimit = 100
+
+// GetAuditEvents returns the most recent AuditEvents, optionally only those by or about the user_id in the query.
+// Tenant admins only see the events of their tenant.
+func GetAuditEvents(c *gin.Context) {
+	limit := auditEventsLimit
+	if value := c.Query("limit"); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > auditEventsLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid limit", err))
+			return
+		}
+		limit = n
+	}
+
+	events, err := datastore.GetFromContext(c).GetAuditEvents(middleware.GetAdmin(c).TenantID, c.Query("user_id"), limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get audit events", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
@@ -2,9 +2,13 @@ package routes
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/couchbase/gocb"
+	"github.com/google/uuid"
+
 	"github.com/pemiller/authentication/datastore"
 	"github.com/pemiller/authentication/helpers"
 	"github.com/pemiller/authentication/middleware"
@@ -39,24 +43,56 @@ func CreateAuthCode(c *gin.Context) {
 		}
 	}
 
+	app := middleware.GetApplication(c)
+	if scope := helpers.GetUndeclaredScope(app, helpers.ParseScope(form.Scope)); len(scope) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse(fmt.Sprintf("Scope is not allowed for the application (%s)", scope), nil))
+		return
+	}
+
+	// users of a federated site or email domain are sent to their upstream provider instead
+	if startFederation(c, username, form) {
+		return
+	}
+
 	// check the credentials provided in the header and get the user object from the data store
 	ok, user := checkAuth(c, username, password, form.IP)
 	if !ok {
 		return
 	}
 
-	app := middleware.GetApplication(c)
+	sites, err := getEffectiveSites(c, user)
+	if err == nil {
+		sites, err = filterApplicationSites(c, app, sites)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return
+	}
+
+	settings, err := getTenantSettings(c, app.TenantID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+		return
+	}
+
 	authCode := &models.AuthCode{
 		Code:          helpers.GenerateAuthCode(),
 		UserID:        user.ID,
 		Email:         user.Email,
 		ApplicationID: app.ID,
 		AuthType:      models.AuthTypeUser,
-		Sites:         user.SiteRefs,
+		Sites:         sites,
+		Scopes:        helpers.ParseScope(form.Scope),
+		Nonce:         form.Nonce,
 		IP:            form.IP,
 		DateCreated:   time.Now().UTC(),
 	}
 
+	// passwords kept by a directory are not subject to the tenant's password policy
+	if settings != nil && len(user.DirectoryID) == 0 {
+		authCode.PasswordChangeRequired = helpers.ValidatePassword(settings.PasswordPolicy, password) != nil
+	}
+
 	// save AuthCode to data store
 	err = datastore.GetFromContext(c).UpsertAuthCode(authCode)
 	if err != nil {
@@ -67,14 +103,16 @@ func CreateAuthCode(c *gin.Context) {
 	model := &models.AuthCodeDetailed{
 		Code:        authCode.Code,
 		AuthType:    models.AuthTypeUser,
-		Status:      helpers.GetLoginStatus(user.IsValidated, user.DateExpires),
+		Status:      getLoginStatus(user, authCode),
 		Application: app,
+		PromptMFA:   settings != nil && settings.PromptMFA,
 	}
-	model.Sites, err = getSites(c, authCode.Sites)
+	userSites, err := getSites(c, app.TenantID, authCode.Sites)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
 		return
 	}
+	model.Sites, model.Status = getAvailableSites(userSites, model.Status)
 
 	datastore.GetFromContext(c).UpsertAuthCodeDetailedToCache(model)
 	c.Header(middleware.AuthCodeHeaderKey, authCode.Code)
@@ -82,8 +120,11 @@ func CreateAuthCode(c *gin.Context) {
 }
 
 func checkAuth(c *gin.Context, email, pass, ip string) (bool, *models.User) {
+	// users sign in to the applications of their own tenant
+	tenantID := getTenantID(c)
+
 	// check if there is a locking document for the email, preventing access
-	if locked, err := datastore.GetFromContext(c).UserIsLocked(email); err != nil {
+	if locked, err := datastore.GetFromContext(c).UserIsLocked(tenantID, email); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to check if user is locked", err))
 		return false, nil
 	} else if locked {
@@ -92,24 +133,48 @@ func checkAuth(c *gin.Context, email, pass, ip string) (bool, *models.User) {
 	}
 
 	// get user document from couchbase datastore
-	user, err := datastore.GetFromContext(c).GetUserByEmail(email)
+	user, err := datastore.GetFromContext(c).GetUserByEmail(tenantID, email)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user", err))
 		return false, nil
 	}
-	if user == nil {
+
+	// the site is optional when signing in, but if it is sent it may select the directory
+	var site *models.Site
+	if siteID := c.Request.Header.Get(middleware.SiteHeaderKey); len(siteID) > 0 {
+		site, err = getSite(c, siteID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+			return false, nil
+		}
+	}
+
+	authenticator, directory, err := helpers.GetAuthenticator(c, user, tenantID, email, site)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get directory", err))
+		return false, nil
+	}
+	if authenticator == nil {
 		c.Status(http.StatusNotFound)
 		return false, nil
 	}
 
-	// check if the provided password matches the stored one
-	match := helpers.TestPassword(c, user, pass)
+	// check if the provided password matches the stored one or the directory
+	identity, match := helpers.TestPassword(c, authenticator, tenantID, email, pass)
 	if !match {
 		return false, nil
 	}
 
+	if directory != nil {
+		user, err = provisionDirectoryUser(c, user, tenantID, directory, identity)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to provision user", err))
+			return false, nil
+		}
+	}
+
 	// clear any login failures if they exist
-	err = datastore.GetFromContext(c).ClearLoginFailCount(email)
+	err = datastore.GetFromContext(c).ClearLoginFailCount(tenantID, email)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to clear failed logins", err))
 		return false, nil
@@ -125,6 +190,54 @@ func checkAuth(c *gin.Context, email, pass, ip string) (bool, *models.User) {
 	return true, user
 }
 
+// provisionDirectoryUser creates the User in the tenant the first time they sign in with a directory. On
+// every sign in their names and sites are updated from the directory that provisioned them.
+func provisionDirectoryUser(c *gin.Context, user *models.User, tenantID string, directory *models.Directory, identity *models.DirectoryIdentity) (*models.User, error) {
+	store := datastore.GetFromContext(c)
+
+	if user == nil {
+		user = newDirectoryUser(tenantID, directory, identity)
+
+		err := store.InsertUser(user)
+		if err == gocb.ErrKeyExists {
+			// a concurrent sign in provisioned the user first
+			return store.GetUserByEmail(tenantID, identity.Email)
+		}
+		return user, err
+	}
+
+	updateDirectoryUser(user, directory, identity)
+	return user, store.UpsertUser(user)
+}
+
+// newDirectoryUser builds the User created the first time they sign in with a directory. Their email
+// was checked by the directory so it is already validated.
+func newDirectoryUser(tenantID string, directory *models.Directory, identity *models.DirectoryIdentity) *models.User {
+	user := &models.User{
+		ID:          uuid.New().String(),
+		Email:       identity.Email,
+		IsValidated: true,
+		DirectoryID: directory.ID,
+		TenantID:    tenantID,
+	}
+	updateDirectoryUser(user, directory, identity)
+
+	return user
+}
+
+// updateDirectoryUser copies the names and sites the directory knows about to a User it provisioned.
+// Users of other directories or without one are left unchanged.
+func updateDirectoryUser(user *models.User, directory *models.Directory, identity *models.DirectoryIdentity) {
+	if user.DirectoryID != directory.ID {
+		return
+	}
+
+	user.Name = identity.Name
+	user.GivenName = identity.GivenName
+	user.FamilyName = identity.FamilyName
+	user.SiteRefs = identity.Sites
+}
+
 // GetAuthCode returns an AuthCodeDetailed based on the context
 func GetAuthCode(c *gin.Context) {
 	authCode := middleware.GetAuthCode(c)
@@ -138,13 +251,6 @@ func GetAuthCode(c *gin.Context) {
 
 	// if the response was not in the cache then build it from the AuthCode
 	if response == nil {
-		// build list of site models
-		sites, err := getSites(c, authCode.Sites)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
-			return
-		}
-
 		// get user model
 		user, err := datastore.GetFromContext(c).GetUser(authCode.UserID)
 		if err != nil {
@@ -156,14 +262,35 @@ func GetAuthCode(c *gin.Context) {
 			return
 		}
 
+		// build list of site models from the user's current sites, so group changes apply straight away
 		app := middleware.GetApplication(c)
+		siteIDs, err := getEffectiveSites(c, user)
+		if err == nil {
+			siteIDs, err = filterApplicationSites(c, app, siteIDs)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+			return
+		}
+		sites, err := getSites(c, app.TenantID, siteIDs)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+			return
+		}
+
+		settings, err := getTenantSettings(c, app.TenantID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+			return
+		}
+
 		response = &models.AuthCodeDetailed{
 			Code:        authCode.Code,
 			AuthType:    authCode.AuthType,
-			Status:      helpers.GetLoginStatus(user.IsValidated, user.DateExpires),
 			Application: app,
-			Sites:       sites,
+			PromptMFA:   settings != nil && settings.PromptMFA,
 		}
+		response.Sites, response.Status = getAvailableSites(sites, getLoginStatus(user, authCode))
 		datastore.GetFromContext(c).UpsertAuthCodeDetailedToCache(response)
 	}
 	c.Header(middleware.AuthCodeHeaderKey, authCode.Code)
@@ -177,28 +304,38 @@ func DeleteAuthCode(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// getSites returns a list of site models from a list of site ids
-func getSites(c context.Context, sites []string) ([]*models.Site, error) {
-	siteChan := make(chan *models.Site)
-	errChan := make(chan error)
+// getLoginStatus returns the LoginStatus of the user, asking them to change a password that does not meet
+// the tenant's policy once nothing else is wrong
+func getLoginStatus(user *models.User, authCode *models.AuthCode) models.LoginStatus {
+	status := helpers.GetLoginStatus(user.IsValidated, user.DateExpires)
+	if status == models.LoginStatusOK && authCode.PasswordChangeRequired {
+		return models.LoginStatusPasswordChangeRequired
+	}
+	return status
+}
+
+// getSites returns a list of site models from a list of site ids, leaving out any that are missing or
+// belong to another tenant
+func getSites(c context.Context, tenantID string, sites []string) ([]*models.Site, error) {
+	siteChan := make(chan *models.Site, len(sites))
+	errChan := make(chan error, len(sites))
 	result := []*models.Site{}
 
 	for _, siteID := range sites {
 		go func(s string) {
-			site, err := datastore.GetFromContext(c).GetSite(s)
+			site, err := datastore.GetFromContext(c).GetCurrentSite(s)
 			if err != nil {
 				errChan <- err
+				return
 			}
-			if site != nil {
-				siteChan <- site
-			}
+			siteChan <- site
 		}(siteID)
 	}
 
 	for range sites {
 		select {
 		case s := <-siteChan:
-			if s != nil {
+			if s != nil && s.TenantID == tenantID {
 				result = append(result, s)
 			}
 		case e := <-errChan:
@@ -208,3 +345,19 @@ func getSites(c context.Context, sites []string) ([]*models.Site, error) {
 
 	return result, nil
 }
+
+// getAvailableSites returns the sites that are active and not in a maintenance window. The status changes
+// to SiteUnavailable when the user has sites but none of them are available.
+func getAvailableSites(sites []*models.Site, status models.LoginStatus) ([]*models.Site, models.LoginStatus) {
+	available := []*models.Site{}
+	for _, site := range sites {
+		if site.IsAvailable() {
+			available = append(available, site)
+		}
+	}
+
+	if status == models.LoginStatusOK && len(sites) > 0 && len(available) == 0 {
+		status = models.LoginStatusSiteUnavailable
+	}
+	return available, status
+}
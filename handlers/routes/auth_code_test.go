@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/models"
+)
+
+func TestNewDirectoryUser(t *testing.T) {
+	directory := &models.Directory{ID: "directory"}
+	identity := &models.DirectoryIdentity{
+		Email:      "jane@example.com",
+		Name:       "Jane Doe",
+		GivenName:  "Jane",
+		FamilyName: "Doe",
+		Sites:      []string{"site-1", "site-2"},
+	}
+
+	user := newDirectoryUser("tenant", directory, identity)
+	if len(user.ID) == 0 {
+		t.Error("expected the user to have an id")
+	}
+
+	expected := &models.User{
+		ID:          user.ID,
+		Email:       "jane@example.com",
+		Name:        "Jane Doe",
+		GivenName:   "Jane",
+		FamilyName:  "Doe",
+		IsValidated: true,
+		SiteRefs:    []string{"site-1", "site-2"},
+		DirectoryID: "directory",
+		TenantID:    "tenant",
+	}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("expected %+v, got %+v", expected, user)
+	}
+
+	other := newDirectoryUser("tenant", directory, identity)
+	if other.ID == user.ID {
+		t.Error("expected each user to get a new id")
+	}
+}
+
+func TestUpdateDirectoryUser(t *testing.T) {
+	identity := &models.DirectoryIdentity{
+		Email:      "Jane@Example.com",
+		Name:       "Jane Doe",
+		GivenName:  "Jane",
+		FamilyName: "Doe",
+		Sites:      []string{"site-2", "site-3"},
+	}
+	newUser := func(directoryID string) *models.User {
+		return &models.User{
+			ID:          "user",
+			Email:       "jane@example.com",
+			Password:    "hash",
+			Name:        "Jane Smith",
+			IsValidated: true,
+			IsAdmin:     true,
+			SiteRefs:    []string{"site-1", "site-2"},
+			DirectoryID: directoryID,
+			TenantID:    "tenant",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		expected *models.User
+	}{
+		{
+			name: "user provisioned by the directory",
+			user: newUser("directory"),
+			expected: &models.User{
+				ID:          "user",
+				Email:       "jane@example.com",
+				Password:    "hash",
+				Name:        "Jane Doe",
+				GivenName:   "Jane",
+				FamilyName:  "Doe",
+				IsValidated: true,
+				IsAdmin:     true,
+				SiteRefs:    []string{"site-2", "site-3"},
+				DirectoryID: "directory",
+				TenantID:    "tenant",
+			},
+		},
+		{
+			name:     "user with a password",
+			user:     newUser(""),
+			expected: newUser(""),
+		},
+		{
+			name:     "user of another directory",
+			user:     newUser("other-directory"),
+			expected: newUser("other-directory"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updateDirectoryUser(test.user, &models.Directory{ID: "directory"}, identity)
+			if !reflect.DeepEqual(test.user, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, test.user)
+			}
+		})
+	}
+}
+
+func TestGetLoginStatus(t *testing.T) {
+	expired := time.Now().UTC().Add(-time.Hour)
+
+	tests := []struct {
+		name                   string
+		user                   *models.User
+		passwordChangeRequired bool
+		expected               models.LoginStatus
+	}{
+		{"ok", &models.User{IsValidated: true}, false, models.LoginStatusOK},
+		{"password does not meet the policy", &models.User{IsValidated: true}, true, models.LoginStatusPasswordChangeRequired},
+		{"not validated comes first", &models.User{}, true, models.LoginStatusNotValidated},
+		{"expired comes first", &models.User{IsValidated: true, DateExpires: &expired}, true, models.LoginStatusExpired},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := getLoginStatus(test.user, &models.AuthCode{PasswordChangeRequired: test.passwordChangeRequired})
+			if status != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// StartAuthorization accepts an authorization request from a client (RFC 6749 section 4.1.1), saves it
+// and sends the user to the login page to sign in. Errors are only sent to the redirect uri once it is
+// known to be registered for the client.
+func StartAuthorization(c *gin.Context) {
+	if len(config.AuthorizationLoginURL) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Authorization is not configured"))
+		return
+	}
+
+	form := &models.OAuthAuthorizeRequest{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Unable to read request"))
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	app, err := store.GetApplication(form.ClientID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get application"))
+		return
+	}
+	if app == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Unknown client_id"))
+		return
+	}
+	if !hasRedirectURI(app, form.RedirectURI) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "redirect_uri is not registered for the client"))
+		return
+	}
+
+	request := &models.AuthorizationRequest{
+		ID:            uuid.New().String(),
+		ApplicationID: app.ID,
+		RedirectURI:   form.RedirectURI,
+		State:         form.State,
+		Scopes:        helpers.ParseScope(form.Scope),
+		Nonce:         form.Nonce,
+		CodeChallenge: form.CodeChallenge,
+		DateCreated:   time.Now().UTC(),
+	}
+
+	// PKCE is required of every client, so an intercepted code cannot be exchanged
+	errorCode, description := "", ""
+	switch {
+	case form.ResponseType != "code":
+		errorCode = helpers.OAuthErrorUnsupportedResponseType
+	case len(app.GrantTypes) > 0 && !helpers.HasScope(app.GrantTypes, models.GrantTypeAuthorizationCode):
+		errorCode, description = helpers.OAuthErrorUnauthorizedClient, "Grant type is not registered for the client"
+	case form.CodeChallengeMethod != models.CodeChallengeMethodS256 || !helpers.IsValidCodeChallenge(form.CodeChallenge):
+		errorCode, description = helpers.OAuthErrorInvalidRequest, "A code_challenge with the S256 method is required"
+	case len(helpers.GetUndeclaredScope(app, request.Scopes)) > 0:
+		errorCode, description = helpers.OAuthErrorInvalidScope, "Scope is not allowed for the client"
+	}
+	if len(errorCode) > 0 {
+		values := url.Values{"error": {errorCode}}
+		if len(description) > 0 {
+			values.Set("error_description", description)
+		}
+		redirectAuthorization(c, request, values)
+		return
+	}
+
+	err = store.InsertAuthorizationRequest(request)
+	if err != nil {
+		redirectAuthorization(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+
+	loginURL, err := url.Parse(config.AuthorizationLoginURL)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Invalid authorization login URL"))
+		return
+	}
+	query := loginURL.Query()
+	query.Set("authorization_request", request.ID)
+	loginURL.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, loginURL.String())
+}
+
+// CreateAuthorizationResponse issues an authorization code for a saved AuthorizationRequest to the user
+// of the AuthCode in the context. The login page sends the user to the returned redirect uri.
+func CreateAuthorizationResponse(c *gin.Context) {
+	form := &models.CreateAuthorizationResponseRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	request, err := store.GetAuthorizationRequest(form.AuthorizationRequest)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get AuthorizationRequest", err))
+		return
+	}
+	if request == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("AuthorizationRequest not found", nil))
+		return
+	}
+
+	// users can only authorize the clients of their own tenant
+	app, err := store.GetApplication(request.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return
+	}
+	if app == nil || app.TenantID != getTenantID(c) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("AuthorizationRequest not found", nil))
+		return
+	}
+
+	// only one code is issued for each request
+	ok, err := store.DeleteAuthorizationRequest(request.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete AuthorizationRequest", err))
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("AuthorizationRequest not found", nil))
+		return
+	}
+
+	userAuthCode := middleware.GetAuthCode(c)
+	sites, err := filterApplicationSites(c, app, userAuthCode.Sites)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return
+	}
+
+	// the client gets its own AuthCode for its application so it can be revoked separately
+	authCode := &models.AuthCode{
+		Code:          helpers.GenerateAuthCode(),
+		UserID:        userAuthCode.UserID,
+		Email:         userAuthCode.Email,
+		ApplicationID: app.ID,
+		AuthType:      userAuthCode.AuthType,
+		Sites:         sites,
+		Scopes:        request.Scopes,
+		Nonce:         request.Nonce,
+		IP:            userAuthCode.IP,
+		DateCreated:   time.Now().UTC(),
+	}
+	err = store.UpsertAuthCode(authCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AuthCode", err))
+		return
+	}
+
+	code, err := helpers.GenerateAuthorizationCode()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to generate authorization code", err))
+		return
+	}
+	err = store.InsertAuthorizationCode(&models.AuthorizationCode{
+		Code:          code,
+		AuthCode:      authCode.Code,
+		ApplicationID: app.ID,
+		RedirectURI:   request.RedirectURI,
+		CodeChallenge: request.CodeChallenge,
+		DateCreated:   authCode.DateCreated,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save authorization code", err))
+		return
+	}
+
+	redirectURI, err := buildRedirectURL(request.RedirectURI, request.State, url.Values{"code": {code}})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Invalid redirect_uri", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.AuthorizationResponse{RedirectURI: redirectURI})
+}
+
+// redirectAuthorization sends the user back to the client with the values and its state
+func redirectAuthorization(c *gin.Context, request *models.AuthorizationRequest, values url.Values) {
+	redirectURL, err := buildRedirectURL(request.RedirectURI, request.State, values)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Invalid redirect_uri"))
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirectURL)
+}
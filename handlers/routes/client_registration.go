@@ -0,0 +1,296 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// RegisterClient creates an Application from the client metadata in the body (RFC 7591). Unless open
+// registration is enabled, the request must have an initial access token as a bearer token, and the
+// application belongs to the token's tenant. Registered applications may not use any site until an
+// administrator allows them.
+func RegisterClient(c *gin.Context) {
+	tenantID := ""
+	if !config.OpenClientRegistration {
+		token, _ := helpers.ParseAuthorizationHeader(c.Request, helpers.AuthTypeBearer)
+		if len(token) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidToken, "Missing initial access token"))
+			return
+		}
+
+		initialAccessToken, err := datastore.GetFromContext(c).GetInitialAccessToken(helpers.HashClientSecret(token))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get initial access token"))
+			return
+		}
+		if initialAccessToken == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidToken, "Invalid initial access token"))
+			return
+		}
+		tenantID = initialAccessToken.TenantID
+	}
+
+	metadata := &models.ClientMetadata{}
+	err := c.ShouldBindJSON(metadata)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidClientMetadata, "Unable to read body"))
+		return
+	}
+	if code, description := helpers.ValidateClientMetadata(metadata); len(code) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(code, description))
+		return
+	}
+
+	app := &models.Application{
+		ID:            uuid.New().String(),
+		TenantID:      tenantID,
+		RestrictSites: true,
+	}
+	helpers.ApplyClientMetadata(app, metadata)
+
+	registrationAccessToken, err := helpers.GenerateClientSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to generate registration access token"))
+		return
+	}
+	registration := &models.ClientRegistration{
+		ApplicationID:               app.ID,
+		RegistrationAccessTokenHash: helpers.HashClientSecret(registrationAccessToken),
+		DateCreated:                 time.Now().UTC(),
+	}
+
+	// the registration is saved first so an application is never left without a way to manage it
+	err = datastore.GetFromContext(c).UpsertClientRegistration(registration)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to save registration"))
+		return
+	}
+
+	clientSecret, err := createRegisteredClientSecret(c, app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create client secret"))
+		return
+	}
+
+	err = datastore.GetFromContext(c).UpsertApplication(app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to save application"))
+		return
+	}
+
+	response := newClientRegistrationResponse(c, app, registration)
+	response.ClientSecret = clientSecret
+	response.RegistrationAccessToken = registrationAccessToken
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetClientRegistration returns the metadata of the registered client (RFC 7592 section 2.1)
+func GetClientRegistration(c *gin.Context) {
+	app, registration, ok := loadClientRegistration(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, newClientRegistrationResponse(c, app, registration))
+}
+
+// UpdateClientRegistration replaces the metadata of the registered client (RFC 7592 section 2.2).
+// A client secret is created if the client changes to a secret authentication method without one.
+func UpdateClientRegistration(c *gin.Context) {
+	app, registration, ok := loadClientRegistration(c)
+	if !ok {
+		return
+	}
+
+	form := &models.ClientRegistrationRequest{}
+	err := c.ShouldBindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidClientMetadata, "Unable to read body"))
+		return
+	}
+	if form.ClientID != app.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "client_id does not match"))
+		return
+	}
+	if code, description := helpers.ValidateClientMetadata(&form.ClientMetadata); len(code) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(code, description))
+		return
+	}
+
+	helpers.ApplyClientMetadata(app, &form.ClientMetadata)
+
+	clientSecret, err := createRegisteredClientSecret(c, app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create client secret"))
+		return
+	}
+
+	err = datastore.GetFromContext(c).UpsertApplication(app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to save application"))
+		return
+	}
+
+	response := newClientRegistrationResponse(c, app, registration)
+	response.ClientSecret = clientSecret
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteClientRegistration revokes the tokens of the registered client and deletes it with its client
+// secrets (RFC 7592 section 2.3)
+func DeleteClientRegistration(c *gin.Context) {
+	app, _, ok := loadClientRegistration(c)
+	if !ok {
+		return
+	}
+
+	err := deleteApplication(c, app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to delete application"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateInitialAccessToken creates a token that lets a client register while open registration is disabled.
+// The token can be used until it expires. Clients registered with it belong to the administrator's
+// tenant, or to the tenant_id chosen by a super admin.
+func CreateInitialAccessToken(c *gin.Context) {
+	form := &models.CreateInitialAccessTokenRequest{}
+	if c.Request.Body != http.NoBody {
+		err := c.BindJSON(form)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+			return
+		}
+	}
+
+	value, err := helpers.GenerateClientSecret()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to generate initial access token", err))
+		return
+	}
+
+	token := &models.InitialAccessToken{
+		Hash:        helpers.HashClientSecret(value),
+		Description: form.Description,
+		TenantID:    middleware.GetAdmin(c).TenantID,
+		CreatedBy:   middleware.GetAdmin(c).ID,
+		DateCreated: time.Now().UTC(),
+	}
+	if !bindAdminTenantID(c, &token.TenantID, form.TenantID, true) {
+		return
+	}
+	if form.ExpiresIn > 0 {
+		expires := token.DateCreated.Add(time.Duration(form.ExpiresIn) * time.Second)
+		token.DateExpires = &expires
+	}
+
+	err = datastore.GetFromContext(c).InsertInitialAccessToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save initial access token", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, &models.InitialAccessTokenResponse{
+		Token:       value,
+		Description: token.Description,
+		TenantID:    token.TenantID,
+		DateCreated: token.DateCreated,
+		DateExpires: token.DateExpires,
+	})
+}
+
+// loadClientRegistration gets the Application defined by the client_id and checks the registration
+// access token in the authorization header. The request is aborted and false is returned if the
+// token does not match, without revealing whether the client exists.
+func loadClientRegistration(c *gin.Context) (*models.Application, *models.ClientRegistration, bool) {
+	token, _ := helpers.ParseAuthorizationHeader(c.Request, helpers.AuthTypeBearer)
+
+	registration, err := datastore.GetFromContext(c).GetClientRegistration(c.Param("client_id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get registration"))
+		return nil, nil, false
+	}
+	if !helpers.TestRegistrationAccessToken(registration, token) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidToken, "Invalid registration access token"))
+		return nil, nil, false
+	}
+
+	app, err := datastore.GetFromContext(c).GetApplication(registration.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get application"))
+		return nil, nil, false
+	}
+	if app == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidToken, "Invalid registration access token"))
+		return nil, nil, false
+	}
+
+	// the cached application is shared, so changes are made to a copy
+	copied := *app
+	return &copied, registration, true
+}
+
+// createRegisteredClientSecret creates the first client secret for an application that authenticates
+// with a secret. Nothing is created if the application already has an active secret.
+func createRegisteredClientSecret(c *gin.Context, app *models.Application) (string, error) {
+	if !helpers.UsesClientSecret(app.TokenEndpointAuthMethod) {
+		return "", nil
+	}
+
+	secrets, err := datastore.GetFromContext(c).GetApplicationSecrets(app.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(helpers.ActiveClientSecrets(secrets)) > 0 {
+		return "", nil
+	}
+
+	value, err := helpers.GenerateClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = datastore.GetFromContext(c).UpsertApplicationSecrets(&models.ApplicationSecrets{
+		ApplicationID: app.ID,
+		Secrets: []*models.ApplicationSecret{{
+			ID:          uuid.New().String(),
+			Hash:        helpers.HashClientSecret(value),
+			Description: "Client registration",
+			DateCreated: time.Now().UTC(),
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// newClientRegistrationResponse builds the registration response without the client secret or registration access token
+func newClientRegistrationResponse(c *gin.Context, app *models.Application, registration *models.ClientRegistration) *models.ClientRegistrationResponse {
+	return &models.ClientRegistrationResponse{
+		ClientMetadata:        helpers.GetClientMetadata(app),
+		ClientID:              app.ID,
+		ClientIDIssuedAt:      registration.DateCreated.Unix(),
+		ClientSecretExpiresAt: 0,
+		RegistrationClientURI: helpers.GetIssuer(c.Request) + "/oauth/register/" + app.ID,
+	}
+}
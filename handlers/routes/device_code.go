@@ -0,0 +1,359 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// deviceCodeInterval is the minimum number of seconds a device must wait between polls
+const deviceCodeInterval = 5
+
+// CreateDeviceCode starts a device authorization grant for the authenticated client (RFC 8628 section 3.1)
+func CreateDeviceCode(c *gin.Context) {
+	form := &models.DeviceAuthorizationRequest{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Unable to read form"))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	if scope := helpers.GetUndeclaredScope(app, helpers.ParseScope(form.Scope)); len(scope) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidScope, "Scope is not allowed for the client"))
+		return
+	}
+
+	code, err := helpers.GenerateDeviceCode()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to generate device code"))
+		return
+	}
+
+	now := time.Now().UTC()
+	deviceCode := &models.DeviceCode{
+		DeviceCode:    code,
+		ApplicationID: app.ID,
+		Scopes:        helpers.ParseScope(form.Scope),
+		Status:        models.DeviceCodeStatusPending,
+		Interval:      deviceCodeInterval,
+		DateCreated:   now,
+		DateExpires:   now.Add(config.DeviceCodeTTL),
+	}
+
+	// the user code space is small, so retry a few times if the generated code is already in use
+	for i := 0; i < 3; i++ {
+		deviceCode.UserCode, err = helpers.GenerateUserCode()
+		if err != nil {
+			break
+		}
+		err = datastore.GetFromContext(c).InsertDeviceCode(deviceCode)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create device code"))
+		return
+	}
+
+	verificationURI := config.DeviceVerificationURI
+	if len(verificationURI) == 0 {
+		verificationURI = helpers.GetIssuer(c.Request) + "/device"
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, &models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode.DeviceCode,
+		UserCode:                deviceCode.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(deviceCode.UserCode),
+		ExpiresIn:               int64(config.DeviceCodeTTL.Seconds()),
+		Interval:                deviceCode.Interval,
+	})
+}
+
+// GetDeviceCode returns the application and scopes a device is requesting so they can be shown to the user
+func GetDeviceCode(c *gin.Context) {
+	deviceCode, ok := getPendingDeviceCode(c, c.Query("user_code"))
+	if !ok {
+		return
+	}
+
+	app, err := datastore.GetFromContext(c).GetApplication(deviceCode.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.DeviceCodeDetailed{
+		UserCode:    deviceCode.UserCode,
+		Application: app,
+		Scopes:      deviceCode.Scopes,
+		DateExpires: deviceCode.DateExpires,
+	})
+}
+
+// VerifyDeviceCode approves or denies a device for the user of the AuthCode in the context
+func VerifyDeviceCode(c *gin.Context) {
+	form := &models.DeviceVerificationRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	deviceCode, ok := getPendingDeviceCode(c, form.UserCode)
+	if !ok {
+		return
+	}
+
+	if !form.Approve {
+		deviceCode.Status = models.DeviceCodeStatusDenied
+		err = datastore.GetFromContext(c).UpdateDeviceCode(deviceCode)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to update device code", err))
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	siteID := form.Site
+	if len(siteID) == 0 {
+		siteID = c.Request.Header.Get(middleware.SiteHeaderKey)
+	}
+	if len(siteID) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request is missing site", nil))
+		return
+	}
+
+	site, err := getSite(c, siteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Site not found", nil))
+		return
+	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteUnavailableMessage, nil))
+		return
+	}
+
+	userAuthCode := middleware.GetAuthCode(c)
+	allowed, err := hasSiteAccess(c, userAuthCode.UserID, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("User does not have access to the site", nil))
+		return
+	}
+
+	// the device gets its own AuthCode for its application so it can be revoked separately
+	authCode := &models.AuthCode{
+		Code:          helpers.GenerateAuthCode(),
+		UserID:        userAuthCode.UserID,
+		Email:         userAuthCode.Email,
+		ApplicationID: deviceCode.ApplicationID,
+		AuthType:      models.AuthTypeUser,
+		Sites:         userAuthCode.Sites,
+		Scopes:        deviceCode.Scopes,
+		IP:            userAuthCode.IP,
+		DateCreated:   time.Now().UTC(),
+
+		PasswordChangeRequired: userAuthCode.PasswordChangeRequired,
+	}
+
+	err = datastore.GetFromContext(c).UpsertAuthCode(authCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AuthCode", err))
+		return
+	}
+
+	deviceCode.Status = models.DeviceCodeStatusApproved
+	deviceCode.UserID = authCode.UserID
+	deviceCode.AuthCode = authCode.Code
+	deviceCode.SiteID = site.SiteID
+	err = datastore.GetFromContext(c).UpdateDeviceCode(deviceCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to update device code", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getPendingDeviceCode gets the DeviceCode for the user code. The request is aborted and false is
+// returned if it cannot be found, has already been approved or denied, or the device's application
+// belongs to another tenant.
+func getPendingDeviceCode(c *gin.Context, userCode string) (*models.DeviceCode, bool) {
+	if len(userCode) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request is missing user_code", nil))
+		return nil, false
+	}
+
+	deviceCode, err := datastore.GetFromContext(c).GetDeviceCodeByUserCode(helpers.NormalizeUserCode(userCode))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get device code", err))
+		return nil, false
+	}
+	if deviceCode == nil || deviceCode.Status != models.DeviceCodeStatusPending || time.Now().UTC().After(deviceCode.DateExpires) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Device code not found", nil))
+		return nil, false
+	}
+
+	app, err := datastore.GetFromContext(c).GetApplication(deviceCode.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return nil, false
+	}
+	if app == nil || app.TenantID != getTenantID(c) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Device code not found", nil))
+		return nil, false
+	}
+
+	return deviceCode, true
+}
+
+// createDeviceCodeToken issues a user access token once the user has approved the device (RFC 8628 section 3.4)
+func createDeviceCodeToken(c *gin.Context, form *models.TokenRequest) {
+	if len(form.DeviceCode) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing device_code"))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	store := datastore.GetFromContext(c)
+	deviceCode, err := store.GetDeviceCode(form.DeviceCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get device code"))
+		return
+	}
+	if deviceCode == nil || deviceCode.ApplicationID != app.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Invalid device_code"))
+		return
+	}
+
+	now := time.Now().UTC()
+	if now.After(deviceCode.DateExpires) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorExpiredToken, ""))
+		return
+	}
+
+	switch deviceCode.Status {
+	case models.DeviceCodeStatusDenied:
+		store.DeleteDeviceCode(deviceCode)
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, ""))
+		return
+	case models.DeviceCodeStatusPending:
+		errorCode := helpers.OAuthErrorAuthorizationPending
+		if deviceCode.DateLastPolled != nil && now.Sub(*deviceCode.DateLastPolled) < time.Duration(deviceCode.Interval)*time.Second {
+			errorCode = helpers.OAuthErrorSlowDown
+			deviceCode.Interval += deviceCodeInterval
+		}
+		deviceCode.DateLastPolled = &now
+		err = store.UpdateDeviceCode(deviceCode)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to update device code"))
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(errorCode, ""))
+		return
+	}
+
+	// only the request that deletes the approved DeviceCode may exchange it
+	ok, err := store.DeleteDeviceCode(deviceCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to delete device code"))
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Invalid device_code"))
+		return
+	}
+
+	authCode, err := store.GetAuthCode(deviceCode.AuthCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get AuthCode"))
+		return
+	}
+	if authCode == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Authorization has been revoked"))
+		return
+	}
+	if authCode.PasswordChangeRequired {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.PasswordChangeRequiredMessage))
+		return
+	}
+
+	user, err := store.GetUser(authCode.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get user"))
+		return
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "User not found"))
+		return
+	}
+
+	site, err := store.GetCurrentSite(deviceCode.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get site"))
+		return
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Site not found"))
+		return
+	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.SiteUnavailableMessage))
+		return
+	}
+	allowed, err := isApplicationSite(c, app, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get tenant"))
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.SiteNotAllowedMessage))
+		return
+	}
+
+	decision, err := checkTokenPolicy(c, app, authCode, user, site, authCode.Scopes)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to evaluate policy"))
+		return
+	}
+	if !decision.Allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, policyDeniedMessage(decision)))
+		return
+	}
+
+	model, err := createUserAccessToken(c, app, authCode, user, site, authCode.Scopes, "")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create AccessToken"))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken:  model.Token,
+		TokenType:    models.TokenTypeBearer,
+		ExpiresIn:    getExpiresIn(model.DateExpires),
+		RefreshToken: model.RefreshToken,
+		IDToken:      model.IDToken,
+		SiteID:       site.SiteID,
+		Scope:        helpers.FormatScope(model.Scopes),
+	})
+}
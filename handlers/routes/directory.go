@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+// UpsertDirectory saves the LDAP directory defined by the id in the path
+func UpsertDirectory(c *gin.Context) {
+	form := &models.UpsertDirectoryRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+	if len(form.URL) == 0 || len(form.BaseDN) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing url or base_dn", nil))
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	existing, err := store.GetDirectory(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get directory", err))
+		return
+	}
+
+	// encrypted fields are never read from the body, the bind password is encrypted here or kept
+	directory := &models.Directory{
+		ID:           c.Param("id"),
+		Name:         form.Name,
+		URL:          form.URL,
+		StartTLS:     form.StartTLS,
+		BindDN:       form.BindDN,
+		BaseDN:       form.BaseDN,
+		UserFilter:   form.UserFilter,
+		EmailDomains: form.EmailDomains,
+		GroupSites:   form.GroupSites,
+	}
+	if existing != nil {
+		directory.TenantID = existing.TenantID
+		directory.EncryptedBindPassword = existing.EncryptedBindPassword
+	}
+	if !bindAdminTenantID(c, &directory.TenantID, form.TenantID, existing == nil) {
+		return
+	}
+
+	// keep the stored bind password when a new one is not sent
+	if len(form.BindPassword) > 0 {
+		directory.EncryptedBindPassword, err = helpers.Encrypt([]byte(form.BindPassword))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to encrypt bind password", err))
+			return
+		}
+	}
+
+	err = store.UpsertDirectory(directory)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save directory", err))
+		return
+	}
+
+	directory.EncryptedBindPassword = ""
+	c.JSON(http.StatusOK, directory)
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb"
+	"github.com/gin-gonic/gin"
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+)
+
+// testBucket keeps the documents of a test Store in memory as JSON. Methods the tests do not use are
+// left to the embedded interface and panic.
+type testBucket struct {
+	datastore.Bucket
+	documents map[string][]byte
+}
+
+func (b *testBucket) Get(key string, valuePtr interface{}) (gocb.Cas, error) {
+	data, found := b.documents[key]
+	if !found {
+		return 0, gocb.ErrKeyNotFound
+	}
+	return 1, json.Unmarshal(data, valuePtr)
+}
+
+func (b *testBucket) Upsert(key string, value interface{}, expiry uint32) (gocb.Cas, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	b.documents[key] = data
+	return 1, nil
+}
+
+// newTestRouter returns a router that serves the handler with a Store kept in memory
+func newTestRouter(method, path string, handler gin.HandlerFunc) (*gin.Engine, *datastore.Store) {
+	gin.SetMode(gin.TestMode)
+	store := datastore.NewStoreWithBucket(cache.New(time.Minute, time.Minute), &testBucket{documents: map[string][]byte{}}, "test")
+
+	r := gin.New()
+	r.Handle(method, path, func(c *gin.Context) {
+		c.Set(datastore.ContextKey, store)
+		c.Next()
+	}, handler)
+	return r, store
+}
+
+// serveTestJSON sends the body to the router and returns the response code
+func serveTestJSON(r *gin.Engine, method, path string, body interface{}) int {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(data)))
+	return w.Code
+}
+
+func TestUpsertDirectoryIgnoresEncryptedFields(t *testing.T) {
+	config.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+	r, store := newTestRouter(http.MethodPut, "/directory/:id", UpsertDirectory)
+
+	body := map[string]interface{}{
+		"url":                     "ldaps://ldap.example.com",
+		"base_dn":                 "dc=example,dc=com",
+		"bind_password":           "service-password",
+		"encrypted_bind_password": "ciphertext",
+	}
+	if code := serveTestJSON(r, http.MethodPut, "/directory/directory", body); code != http.StatusOK {
+		t.Fatalf("expected the directory to be saved, got %d", code)
+	}
+
+	directory, err := store.GetDirectory("directory")
+	if err != nil || directory == nil {
+		t.Fatalf("expected the saved directory, got %+v, %v", directory, err)
+	}
+	password, err := helpers.Decrypt(directory.EncryptedBindPassword)
+	if err != nil || string(password) != "service-password" {
+		t.Errorf("expected the encrypted bind password, got %q, %v", password, err)
+	}
+
+	// without a bind password the stored one is kept, whatever ciphertext is sent
+	delete(body, "bind_password")
+	if code := serveTestJSON(r, http.MethodPut, "/directory/directory", body); code != http.StatusOK {
+		t.Fatalf("expected the directory to be saved, got %d", code)
+	}
+	directory, _ = store.GetDirectory("directory")
+	password, err = helpers.Decrypt(directory.EncryptedBindPassword)
+	if err != nil || string(password) != "service-password" {
+		t.Errorf("expected the stored bind password to be kept, got %q, %v", password, err)
+	}
+	if directory.URL != "ldaps://ldap.example.com" || directory.BaseDN != "dc=example,dc=com" {
+		t.Errorf("expected the rest of the directory to be saved, got %+v", directory)
+	}
+}
@@ -0,0 +1,363 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// startFederation sends the user to their upstream provider when the site or the domain of their email
+// is federated. It returns true if the request has been handled.
+func startFederation(c *gin.Context, email string, form *models.CreateAuthCodeRequest) bool {
+	var site *models.Site
+	var err error
+	if siteID := c.Request.Header.Get(middleware.SiteHeaderKey); len(siteID) > 0 {
+		site, err = getSite(c, siteID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+			return true
+		}
+	}
+
+	federation, err := helpers.GetFederation(c, email, site)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get federation", err))
+		return true
+	}
+	if federation == nil {
+		return false
+	}
+
+	app := middleware.GetApplication(c)
+	if !hasRedirectURI(app, form.RedirectURI) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing a registered redirect_uri", nil))
+		return true
+	}
+
+	codeVerifier, err := helpers.GenerateCodeVerifier()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to generate code verifier", err))
+		return true
+	}
+
+	request := &models.FederationRequest{
+		State:         helpers.GenerateAuthCode(),
+		FederationID:  federation.ID,
+		ApplicationID: app.ID,
+		Email:         email,
+		Nonce:         helpers.GenerateAuthCode(),
+		CodeVerifier:  codeVerifier,
+		RedirectURI:   form.RedirectURI,
+		ClientState:   form.State,
+		Scopes:        helpers.ParseScope(form.Scope),
+		ClientNonce:   form.Nonce,
+		IP:            form.IP,
+		DateCreated:   time.Now().UTC(),
+	}
+
+	authorizationURL, err := helpers.BuildFederationAuthorizationURL(federation, request, helpers.GetFederationCallbackURI(c.Request))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadGateway, helpers.PrepareErrorResponse("Unable to reach upstream provider", err))
+		return true
+	}
+
+	err = datastore.GetFromContext(c).InsertFederationRequest(request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save federation request", err))
+		return true
+	}
+
+	c.Redirect(http.StatusFound, authorizationURL)
+	return true
+}
+
+// FederationCallback completes a sign in with an upstream provider. The user is linked to or created
+// from the upstream identity and sent back to the application with a new AuthCode.
+func FederationCallback(c *gin.Context) {
+	store := datastore.GetFromContext(c)
+
+	request, err := store.GetFederationRequest(c.Query("state"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get federation request", err))
+		return
+	}
+	if request == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid state", nil))
+		return
+	}
+
+	// each state may only be used once
+	ok, err := store.DeleteFederationRequest(request.State)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete federation request", err))
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid state", nil))
+		return
+	}
+
+	federation, err := store.GetFederation(request.FederationID)
+	if err != nil || federation == nil {
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+
+	identity, oauthError := exchangeFederationCallback(federation, request, c.Request.URL.Query(), helpers.GetFederationCallbackURI(c.Request))
+	if identity == nil {
+		redirectFederation(c, request, url.Values{"error": {oauthError}})
+		return
+	}
+
+	// the user belongs to the tenant of the application that started the sign in
+	app, err := store.GetApplication(request.ApplicationID)
+	if err != nil || app == nil {
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+
+	user, err := linkFederatedUser(c, app.TenantID, federation, identity)
+	if err != nil {
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+	if user == nil {
+		// the email belongs to a user the upstream provider may not sign in as
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorAccessDenied}})
+		return
+	}
+
+	authType := models.FederationAuthType(federation.ID)
+	err = store.UpdateLoginDateForAll(user.ID, authType, request.IP)
+	if err != nil {
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+
+	sites, err := getEffectiveSites(c, user)
+	if err != nil {
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+
+	authCode := &models.AuthCode{
+		Code:          helpers.GenerateAuthCode(),
+		UserID:        user.ID,
+		Email:         user.Email,
+		ApplicationID: request.ApplicationID,
+		AuthType:      authType,
+		Sites:         sites,
+		Scopes:        request.Scopes,
+		Nonce:         request.ClientNonce,
+		IP:            request.IP,
+		DateCreated:   time.Now().UTC(),
+	}
+	err = store.UpsertAuthCode(authCode)
+	if err != nil {
+		redirectFederation(c, request, url.Values{"error": {helpers.OAuthErrorServerError}})
+		return
+	}
+
+	redirectFederation(c, request, url.Values{"code": {authCode.Code}})
+}
+
+// UpsertFederation saves the upstream provider defined by the id in the path
+func UpsertFederation(c *gin.Context) {
+	form := &models.UpsertFederationRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+	if len(form.Issuer) == 0 || len(form.ClientID) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing issuer or client_id", nil))
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	existing, err := store.GetFederation(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get federation", err))
+		return
+	}
+
+	// encrypted fields are never read from the body, the client secret is encrypted here or kept
+	federation := &models.Federation{
+		ID:           c.Param("id"),
+		Name:         form.Name,
+		Issuer:       form.Issuer,
+		ClientID:     form.ClientID,
+		Scopes:       form.Scopes,
+		EmailDomains: form.EmailDomains,
+	}
+	if existing != nil {
+		federation.EncryptedClientSecret = existing.EncryptedClientSecret
+	}
+
+	// keep the stored client secret when a new one is not sent
+	if len(form.ClientSecret) > 0 {
+		federation.EncryptedClientSecret, err = helpers.Encrypt([]byte(form.ClientSecret))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to encrypt client secret", err))
+			return
+		}
+	}
+
+	err = store.UpsertFederation(federation)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save federation", err))
+		return
+	}
+
+	federation.EncryptedClientSecret = ""
+	c.JSON(http.StatusOK, federation)
+}
+
+// exchangeFederationCallback redeems the code sent to the callback for the request saved with its state
+// and returns the upstream identity. The OAuth error to send back to the application is returned instead
+// when the user did not sign in or the identity cannot be trusted.
+func exchangeFederationCallback(federation *models.Federation, request *models.FederationRequest, query url.Values, callbackURI string) (*models.FederatedIdentity, string) {
+	if query.Get("state") != request.State || len(query.Get("error")) > 0 || len(query.Get("code")) == 0 {
+		return nil, helpers.OAuthErrorAccessDenied
+	}
+
+	identity, err := helpers.ExchangeFederationCode(federation, request, query.Get("code"), callbackURI)
+	if err != nil || !federationHasEmailDomain(federation, identity.Email) {
+		return nil, helpers.OAuthErrorAccessDenied
+	}
+
+	return identity, ""
+}
+
+// linkFederatedUser returns the local user of the tenant for the upstream identity, creating the user the
+// first time they sign in. Nil is returned if the provider may not sign in as the user with the email.
+func linkFederatedUser(c *gin.Context, tenantID string, federation *models.Federation, identity *models.FederatedIdentity) (*models.User, error) {
+	store := datastore.GetFromContext(c)
+
+	existing, err := store.GetUserByEmail(tenantID, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	user, changed := linkFederatedIdentity(existing, tenantID, federation, identity)
+	if user == nil || !changed {
+		return user, nil
+	}
+
+	if existing == nil {
+		err = store.InsertUser(user)
+		if err == gocb.ErrKeyExists {
+			// a concurrent sign in created the user first
+			return linkFederatedUser(c, tenantID, federation, identity)
+		}
+		return user, err
+	}
+
+	return user, store.UpsertUser(user)
+}
+
+// linkFederatedIdentity links the upstream identity to the user with the same email, or builds a new user
+// of the tenant when there is none. Nil is returned if the user is linked to another upstream subject, or
+// is not linked yet and the email is outside the federation's domains, since a provider selected only by
+// site could otherwise take over any account of the tenant. changed is true when the user needs to be saved.
+func linkFederatedIdentity(user *models.User, tenantID string, federation *models.Federation, identity *models.FederatedIdentity) (*models.User, bool) {
+	if user == nil {
+		return &models.User{
+			ID:          uuid.New().String(),
+			Email:       identity.Email,
+			Name:        identity.Name,
+			GivenName:   identity.GivenName,
+			FamilyName:  identity.FamilyName,
+			IsValidated: true,
+			Federations: map[string]string{federation.ID: identity.Subject},
+			TenantID:    tenantID,
+		}, true
+	}
+
+	if subject, ok := user.Federations[federation.ID]; ok {
+		if subject != identity.Subject {
+			return nil, false
+		}
+		return user, false
+	}
+	if !federationOwnsEmailDomain(federation, identity.Email) {
+		return nil, false
+	}
+
+	if user.Federations == nil {
+		user.Federations = map[string]string{}
+	}
+	user.Federations[federation.ID] = identity.Subject
+	return user, true
+}
+
+// federationHasEmailDomain returns true if the upstream provider may assert the email. Providers
+// selected only by site have no domains and may assert any email.
+func federationHasEmailDomain(federation *models.Federation, email string) bool {
+	return len(federation.EmailDomains) == 0 || federationOwnsEmailDomain(federation, email)
+}
+
+// federationOwnsEmailDomain returns true if the email is in one of the upstream provider's domains
+func federationOwnsEmailDomain(federation *models.Federation, email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	for _, domain := range federation.EmailDomains {
+		if strings.EqualFold(domain, email[at+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRedirectURI returns true if the redirect uri is registered for the application
+func hasRedirectURI(app *models.Application, redirectURI string) bool {
+	for _, uri := range app.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectFederation sends the user back to the application with the values and its state
+func redirectFederation(c *gin.Context, request *models.FederationRequest, values url.Values) {
+	redirectURL, err := buildRedirectURL(request.RedirectURI, request.ClientState, values)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Invalid redirect_uri", err))
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// buildRedirectURL adds the values and the client's state to the query of the redirect uri
+func buildRedirectURL(redirectURI, state string, values url.Values) (string, error) {
+	redirectURL, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	query := redirectURL.Query()
+	for key, value := range values {
+		query[key] = value
+	}
+	if len(state) > 0 {
+		query.Set("state", state)
+	}
+	redirectURL.RawQuery = query.Encode()
+
+	return redirectURL.String(), nil
+}
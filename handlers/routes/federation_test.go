@@ -0,0 +1,444 @@
+package routes
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+const testCallbackURI = "https://auth.example.com/federation/callback"
+
+// testOIDCProvider is an upstream OpenID Connect provider served by httptest. It signs an ID token for
+// the nonce and code challenge of the last authorization url it was sent to.
+type testOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *helpers.SigningKey
+	jwk    *models.JWK
+	query  url.Values
+	email  string
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	config.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+
+	generated, err := helpers.GenerateSigningKey(helpers.AlgorithmRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := helpers.Decrypt(generated.EncryptedPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testOIDCProvider{
+		t:     t,
+		key:   &helpers.SigningKey{ID: generated.ID, Algorithm: generated.Algorithm, Key: private.(crypto.Signer)},
+		jwk:   generated.PublicKey,
+		email: "jane@example.com",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&models.OpenIDConfiguration{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&models.JWKSet{Keys: []*models.JWK{p.jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "upstream-code" || helpers.CodeChallengeS256(r.PostFormValue("code_verifier")) != p.query.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		idToken, err := helpers.SignJWT(p.key, map[string]interface{}{
+			"iss":   p.server.URL,
+			"sub":   "upstream-subject",
+			"aud":   "upstream-client",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": p.query.Get("nonce"),
+			"email": p.email,
+			"name":  "Jane Doe",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(&models.TokenResponse{IDToken: idToken})
+	})
+	p.server = httptest.NewServer(mux)
+
+	return p
+}
+
+// start builds the authorization url for a new request, as startFederation does, and remembers it as
+// the one the user signed in with upstream
+func (p *testOIDCProvider) start(federation *models.Federation) *models.FederationRequest {
+	verifier, err := helpers.GenerateCodeVerifier()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	request := &models.FederationRequest{
+		State:        helpers.GenerateAuthCode(),
+		FederationID: federation.ID,
+		Nonce:        helpers.GenerateAuthCode(),
+		CodeVerifier: verifier,
+		RedirectURI:  "https://app.example.com/callback",
+	}
+
+	authorizationURL, err := helpers.BuildFederationAuthorizationURL(federation, request, testCallbackURI)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.query = parsed.Query()
+
+	return request
+}
+
+func TestExchangeFederationCallback(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	defer provider.server.Close()
+
+	secret, err := helpers.Encrypt([]byte("upstream-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	federation := &models.Federation{
+		ID:                    "federation",
+		Issuer:                provider.server.URL,
+		ClientID:              "upstream-client",
+		EncryptedClientSecret: secret,
+		EmailDomains:          []string{"Example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		query   func(request *models.FederationRequest) url.Values
+		email   string
+		success bool
+	}{
+		{
+			name: "signed in upstream",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"state": {request.State}, "code": {"upstream-code"}}
+			},
+			success: true,
+		},
+		{
+			name: "state of another request",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"state": {"other"}, "code": {"upstream-code"}}
+			},
+		},
+		{
+			name: "missing state",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"code": {"upstream-code"}}
+			},
+		},
+		{
+			name: "upstream error",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"state": {request.State}, "error": {"access_denied"}}
+			},
+		},
+		{
+			name: "missing code",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"state": {request.State}}
+			},
+		},
+		{
+			name: "wrong code",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"state": {request.State}, "code": {"other"}}
+			},
+		},
+		{
+			name: "email outside the federation's domains",
+			query: func(request *models.FederationRequest) url.Values {
+				return url.Values{"state": {request.State}, "code": {"upstream-code"}}
+			},
+			email: "jane@other.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider.email = "jane@example.com"
+			if len(test.email) > 0 {
+				provider.email = test.email
+			}
+			request := provider.start(federation)
+
+			identity, oauthError := exchangeFederationCallback(federation, request, test.query(request), testCallbackURI)
+			if !test.success {
+				if identity != nil || oauthError != helpers.OAuthErrorAccessDenied {
+					t.Errorf("expected access_denied, got %+v, %q", identity, oauthError)
+				}
+				return
+			}
+			if identity == nil {
+				t.Fatalf("expected an identity, got %q", oauthError)
+			}
+			if identity.Subject != "upstream-subject" || identity.Email != "jane@example.com" {
+				t.Errorf("unexpected identity %+v", identity)
+			}
+		})
+	}
+
+	// a code issued for one request cannot be redeemed with the state of another, since the nonce and
+	// code verifier are bound to the request
+	first := provider.start(federation)
+	provider.start(federation)
+	identity, _ := exchangeFederationCallback(federation, first, url.Values{"state": {first.State}, "code": {"upstream-code"}}, testCallbackURI)
+	if identity != nil {
+		t.Errorf("expected the code of another request to be rejected, got %+v", identity)
+	}
+}
+
+func TestLinkFederatedIdentity(t *testing.T) {
+	federation := &models.Federation{ID: "federation", EmailDomains: []string{"Example.com"}}
+	siteFederation := &models.Federation{ID: "site-federation"}
+	identity := &models.FederatedIdentity{
+		Subject:    "upstream-subject",
+		Email:      "jane@example.com",
+		Name:       "Jane Doe",
+		GivenName:  "Jane",
+		FamilyName: "Doe",
+	}
+
+	t.Run("new user", func(t *testing.T) {
+		user, changed := linkFederatedIdentity(nil, "tenant", federation, identity)
+		if user == nil || !changed {
+			t.Fatalf("expected a new user to save, got %+v, %t", user, changed)
+		}
+
+		expected := &models.User{
+			ID:          user.ID,
+			Email:       "jane@example.com",
+			Name:        "Jane Doe",
+			GivenName:   "Jane",
+			FamilyName:  "Doe",
+			IsValidated: true,
+			Federations: map[string]string{"federation": "upstream-subject"},
+			TenantID:    "tenant",
+		}
+		if len(user.ID) == 0 || !reflect.DeepEqual(user, expected) {
+			t.Errorf("expected %+v, got %+v", expected, user)
+		}
+	})
+
+	t.Run("existing user is linked", func(t *testing.T) {
+		existing := &models.User{
+			ID:          "user",
+			Email:       "jane@example.com",
+			Name:        "Jane Smith",
+			Password:    "hash",
+			Federations: map[string]string{"other": "other-subject"},
+			TenantID:    "tenant",
+		}
+
+		user, changed := linkFederatedIdentity(existing, "tenant", federation, identity)
+		if user != existing || !changed {
+			t.Fatalf("expected the existing user to be linked and saved, got %+v, %t", user, changed)
+		}
+		expected := map[string]string{"other": "other-subject", "federation": "upstream-subject"}
+		if !reflect.DeepEqual(user.Federations, expected) {
+			t.Errorf("expected federations %v, got %v", expected, user.Federations)
+		}
+		if user.Name != "Jane Smith" || user.Password != "hash" {
+			t.Errorf("expected the rest of the user to be kept, got %+v", user)
+		}
+	})
+
+	t.Run("existing user without federations", func(t *testing.T) {
+		user, changed := linkFederatedIdentity(&models.User{ID: "user"}, "tenant", federation, identity)
+		if user == nil || !changed || user.Federations["federation"] != "upstream-subject" {
+			t.Errorf("expected the user to be linked, got %+v, %t", user, changed)
+		}
+	})
+
+	t.Run("provider selected by site creates new users", func(t *testing.T) {
+		user, changed := linkFederatedIdentity(nil, "tenant", siteFederation, identity)
+		if user == nil || !changed || user.Federations["site-federation"] != "upstream-subject" {
+			t.Errorf("expected a new linked user, got %+v, %t", user, changed)
+		}
+	})
+
+	t.Run("provider selected by site cannot link existing users", func(t *testing.T) {
+		for _, existing := range []*models.User{
+			{ID: "user", Email: "jane@example.com", Password: "hash", TenantID: "tenant"},
+			{ID: "admin", Email: "jane@example.com", IsAdmin: true, TenantID: "tenant", Federations: map[string]string{"federation": "upstream-subject"}},
+		} {
+			user, changed := linkFederatedIdentity(existing, "tenant", siteFederation, identity)
+			if user != nil || changed {
+				t.Errorf("expected no user, got %+v, %t", user, changed)
+			}
+			if _, ok := existing.Federations["site-federation"]; ok {
+				t.Errorf("expected %s not to be linked", existing.ID)
+			}
+		}
+	})
+
+	t.Run("provider selected by site signs in users it already linked", func(t *testing.T) {
+		existing := &models.User{ID: "user", Federations: map[string]string{"site-federation": "upstream-subject"}}
+
+		user, changed := linkFederatedIdentity(existing, "tenant", siteFederation, identity)
+		if user != existing || changed {
+			t.Errorf("expected the linked user without changes, got %+v, %t", user, changed)
+		}
+	})
+
+	t.Run("email outside the provider's domains", func(t *testing.T) {
+		other := *identity
+		other.Email = "jane@other.com"
+
+		user, changed := linkFederatedIdentity(&models.User{ID: "user", Email: "jane@other.com"}, "tenant", federation, &other)
+		if user != nil || changed {
+			t.Errorf("expected no user, got %+v, %t", user, changed)
+		}
+	})
+
+	t.Run("already linked", func(t *testing.T) {
+		existing := &models.User{ID: "user", Federations: map[string]string{"federation": "upstream-subject"}}
+
+		user, changed := linkFederatedIdentity(existing, "tenant", federation, identity)
+		if user != existing || changed {
+			t.Errorf("expected the linked user without changes, got %+v, %t", user, changed)
+		}
+	})
+
+	t.Run("linked to another subject", func(t *testing.T) {
+		existing := &models.User{ID: "user", Federations: map[string]string{"federation": "other-subject"}}
+
+		user, changed := linkFederatedIdentity(existing, "tenant", federation, identity)
+		if user != nil || changed {
+			t.Errorf("expected no user, got %+v, %t", user, changed)
+		}
+		if existing.Federations["federation"] != "other-subject" {
+			t.Error("expected the existing link to be kept")
+		}
+	})
+}
+
+func TestBuildRedirectURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURI string
+		state       string
+		values      url.Values
+		expected    string
+	}{
+		{
+			name:        "code and state",
+			redirectURI: "https://app.example.com/callback",
+			state:       "client-state",
+			values:      url.Values{"code": {"code"}},
+			expected:    "https://app.example.com/callback?code=code&state=client-state",
+		},
+		{
+			name:        "redirect uri with a query",
+			redirectURI: "https://app.example.com/callback?tenant=1",
+			values:      url.Values{"error": {helpers.OAuthErrorAccessDenied}},
+			expected:    "https://app.example.com/callback?error=access_denied&tenant=1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redirectURL, err := buildRedirectURL(test.redirectURI, test.state, test.values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if redirectURL != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, redirectURL)
+			}
+		})
+	}
+}
+
+func TestFederationEmailDomains(t *testing.T) {
+	federation := &models.Federation{EmailDomains: []string{"Example.com"}}
+	siteFederation := &models.Federation{}
+
+	tests := []struct {
+		name       string
+		federation *models.Federation
+		email      string
+		has        bool
+		owns       bool
+	}{
+		{"email in the domains", federation, "jane@example.com", true, true},
+		{"email in a sub domain", federation, "jane@sub.example.com", false, false},
+		{"email outside the domains", federation, "jane@other.com", false, false},
+		{"not an email", federation, "jane", false, false},
+		{"provider without domains", siteFederation, "jane@example.com", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if has := federationHasEmailDomain(test.federation, test.email); has != test.has {
+				t.Errorf("expected federationHasEmailDomain %t, got %t", test.has, has)
+			}
+			if owns := federationOwnsEmailDomain(test.federation, test.email); owns != test.owns {
+				t.Errorf("expected federationOwnsEmailDomain %t, got %t", test.owns, owns)
+			}
+		})
+	}
+}
+
+func TestUpsertFederationIgnoresEncryptedFields(t *testing.T) {
+	config.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+	r, store := newTestRouter(http.MethodPut, "/federation/:id", UpsertFederation)
+
+	body := map[string]interface{}{
+		"issuer":                  "https://login.example.com",
+		"client_id":               "upstream-client",
+		"client_secret":           "upstream-secret",
+		"encrypted_client_secret": "ciphertext",
+	}
+	if code := serveTestJSON(r, http.MethodPut, "/federation/federation", body); code != http.StatusOK {
+		t.Fatalf("expected the federation to be saved, got %d", code)
+	}
+
+	// without a client secret the stored one is kept, whatever ciphertext is sent
+	delete(body, "client_secret")
+	if code := serveTestJSON(r, http.MethodPut, "/federation/federation", body); code != http.StatusOK {
+		t.Fatalf("expected the federation to be saved, got %d", code)
+	}
+
+	federation, err := store.GetFederation("federation")
+	if err != nil || federation == nil {
+		t.Fatalf("expected the saved federation, got %+v, %v", federation, err)
+	}
+	secret, err := helpers.Decrypt(federation.EncryptedClientSecret)
+	if err != nil || string(secret) != "upstream-secret" {
+		t.Errorf("expected the stored client secret, got %q, %v", secret, err)
+	}
+	if federation.Issuer != "https://login.example.com" || federation.ClientID != "upstream-client" {
+		t.Errorf("expected the rest of the federation to be saved, got %+v", federation)
+	}
+}
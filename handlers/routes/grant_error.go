@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/pemiller/authentication/helpers"
+)
+
+// grantError describes why a token could not be granted so that the legacy routes and the
+// OAuth 2.0 endpoints can each format the error in their own style
+type grantError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+}
+
+func newGrantError(status int, code, message string, err error) *grantError {
+	return &grantError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// oauthStatus returns the status code RFC 6749 section 5.2 uses for the error code
+func (e *grantError) oauthStatus() int {
+	switch e.Code {
+	case helpers.OAuthErrorServerError:
+		return http.StatusInternalServerError
+	case helpers.OAuthErrorInvalidClient:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,365 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// CreateGroup saves a new Group from the body
+func CreateGroup(c *gin.Context) {
+	group := &models.Group{
+		ID:          uuid.New().String(),
+		TenantID:    middleware.GetAdmin(c).TenantID,
+		DateCreated: time.Now().UTC(),
+	}
+	if !bindGroup(c, group, true) {
+		return
+	}
+
+	err := datastore.GetFromContext(c).UpsertGroup(group)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save group", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// GetGroup returns the Group defined by the id
+func GetGroup(c *gin.Context) {
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup replaces the Group defined by the id with the body. The change applies to the members
+// straight away, except for the roles in tokens that were already issued.
+func UpdateGroup(c *gin.Context) {
+	existing, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+
+	// the cached group is shared, so changes are made to a copy
+	group := *existing
+	if !bindGroup(c, &group, false) {
+		return
+	}
+
+	err := datastore.GetFromContext(c).UpsertGroup(&group)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save group", err))
+		return
+	}
+
+	err = clearGroupMembersCache(c, group.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to update group members", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, &group)
+}
+
+// DeleteGroup removes every member from the Group defined by the id and deletes it
+func DeleteGroup(c *gin.Context) {
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	members, err := store.GetGroupMembers(group.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get group members", err))
+		return
+	}
+
+	for _, user := range members {
+		err = store.SetUserGroups(user.ID, removeValue(user.Groups, group.ID))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to remove group member", err))
+			return
+		}
+		err = store.DeleteUserAuthCodesDetailedFromCache(user.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user tokens", err))
+			return
+		}
+	}
+
+	err = store.DeleteGroup(group.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete group", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetGroupMembers returns the ids and emails of the users in the Group defined by the id
+func GetGroupMembers(c *gin.Context) {
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+
+	members, err := datastore.GetFromContext(c).GetGroupMembers(group.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get group members", err))
+		return
+	}
+
+	response := []gin.H{}
+	for _, user := range members {
+		response = append(response, gin.H{"id": user.ID, "email": user.Email})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AddGroupMember adds the user defined by the user_id to the Group defined by the id
+func AddGroupMember(c *gin.Context) {
+	group, user, ok := loadGroupAndUser(c)
+	if !ok {
+		return
+	}
+
+	if !helpers.HasScope(user.Groups, group.ID) {
+		err := datastore.GetFromContext(c).SetUserGroups(user.ID, append(user.Groups, group.ID))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to add group member", err))
+			return
+		}
+		err = datastore.GetFromContext(c).DeleteUserAuthCodesDetailedFromCache(user.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user tokens", err))
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteGroupMember removes the user defined by the user_id from the Group defined by the id
+func DeleteGroupMember(c *gin.Context) {
+	group, user, ok := loadGroupAndUser(c)
+	if !ok {
+		return
+	}
+	if !helpers.HasScope(user.Groups, group.ID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("User is not a member of the group", nil))
+		return
+	}
+
+	err := datastore.GetFromContext(c).SetUserGroups(user.ID, removeValue(user.Groups, group.ID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to remove group member", err))
+		return
+	}
+	err = datastore.GetFromContext(c).DeleteUserAuthCodesDetailedFromCache(user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user tokens", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bindGroup reads the UpsertGroupRequest in the body into the Group, resolving site urls to ids and
+// checking that each role is defined by its application. Sites and applications must belong to the
+// group's tenant. The request is aborted and false is returned if the body is not valid.
+func bindGroup(c *gin.Context, group *models.Group, create bool) bool {
+	form := &models.UpsertGroupRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return false
+	}
+	if len(form.Name) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing name", nil))
+		return false
+	}
+	if !bindAdminTenantID(c, &group.TenantID, form.TenantID, create) {
+		return false
+	}
+
+	group.Name = form.Name
+	group.Description = form.Description
+	group.Sites = []string{}
+	group.Roles = []*models.RoleAssignment{}
+
+	for _, siteID := range form.Sites {
+		site, ok := getGroupSite(c, group.TenantID, siteID)
+		if !ok {
+			return false
+		}
+		if !helpers.HasScope(group.Sites, site.SiteID) {
+			group.Sites = append(group.Sites, site.SiteID)
+		}
+	}
+
+	for _, role := range form.Roles {
+		app, err := datastore.GetFromContext(c).GetApplication(role.ApplicationID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+			return false
+		}
+		if app == nil || app.TenantID != group.TenantID || helpers.GetRole(app, role.Role) == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Role is not defined by the application", nil))
+			return false
+		}
+
+		site, ok := getGroupSite(c, group.TenantID, role.Site)
+		if !ok {
+			return false
+		}
+
+		group.Roles = append(group.Roles, &models.RoleAssignment{
+			ApplicationID: app.ID,
+			SiteID:        site.SiteID,
+			Role:          role.Role,
+		})
+	}
+
+	return true
+}
+
+// getGroupSite gets a site of the tenant named in a group. The request is aborted and false is returned
+// if it cannot be found.
+func getGroupSite(c *gin.Context, tenantID, siteID string) (*models.Site, bool) {
+	site, err := getTenantSite(c, tenantID, siteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return nil, false
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Site not found", nil))
+		return nil, false
+	}
+
+	return site, true
+}
+
+// loadGroup gets the Group defined by the id if the admin in the context may manage its tenant. The
+// request is aborted and false is returned if it cannot be found.
+func loadGroup(c *gin.Context) (*models.Group, bool) {
+	group, err := datastore.GetFromContext(c).GetGroup(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get group", err))
+		return nil, false
+	}
+	if group == nil || !middleware.CanAdminTenant(c, group.TenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Group not found", nil))
+		return nil, false
+	}
+
+	return group, true
+}
+
+// loadGroupAndUser gets the Group defined by the id and the user defined by the user_id, who must be
+// in the same tenant. The request is aborted and false is returned if either cannot be found.
+func loadGroupAndUser(c *gin.Context) (*models.Group, *models.User, bool) {
+	group, ok := loadGroup(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	user, ok := loadAdminUser(c, c.Param("user_id"))
+	if !ok {
+		return nil, nil, false
+	}
+	if user.TenantID != group.TenantID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("User does not belong to the group's tenant", nil))
+		return nil, nil, false
+	}
+
+	return group, user, true
+}
+
+// clearGroupMembersCache removes the cached AuthCodeDetailed of every member of the group
+func clearGroupMembersCache(c context.Context, groupID string) error {
+	members, err := datastore.GetFromContext(c).GetGroupMembers(groupID)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range members {
+		err = datastore.GetFromContext(c).DeleteUserAuthCodesDetailedFromCache(user.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getUserGroups returns the groups the user is a member of, skipping any that have been deleted or
+// belong to another tenant
+func getUserGroups(c context.Context, user *models.User) ([]*models.Group, error) {
+	groups := []*models.Group{}
+	for _, id := range user.Groups {
+		group, err := datastore.GetFromContext(c).GetGroup(id)
+		if err != nil {
+			return nil, err
+		}
+		if group != nil && group.TenantID == user.TenantID {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// getEffectiveSites returns the ids of the sites the user can access, directly or through their groups
+func getEffectiveSites(c context.Context, user *models.User) ([]string, error) {
+	groups, err := getUserGroups(c, user)
+	if err != nil {
+		return nil, err
+	}
+
+	sites := append([]string{}, user.SiteRefs...)
+	for _, group := range groups {
+		for _, siteID := range group.Sites {
+			if !helpers.HasScope(sites, siteID) {
+				sites = append(sites, siteID)
+			}
+		}
+	}
+	return sites, nil
+}
+
+// hasSiteAccess returns true if the user defined by the id can access the site, directly or through their groups
+func hasSiteAccess(c context.Context, userID, siteID string) (bool, error) {
+	user, err := datastore.GetFromContext(c).GetUser(userID)
+	if err != nil || user == nil {
+		return false, err
+	}
+
+	sites, err := getEffectiveSites(c, user)
+	if err != nil {
+		return false, err
+	}
+	return helpers.HasScope(sites, siteID), nil
+}
+
+// removeValue returns a copy of the values without the value
+func removeValue(values []string, value string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// ImpersonateUser creates a short lived AccessToken for the user defined by the id on behalf of the
+// administrator making the request. The token records the administrator, cannot be refreshed and
+// the impersonation is saved to the audit log before the token is issued.
+func ImpersonateUser(c *gin.Context) {
+	form := &models.ImpersonationRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+	form.Reason = strings.TrimSpace(form.Reason)
+	if len(form.Site) == 0 || len(form.Reason) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing site or reason", nil))
+		return
+	}
+
+	// the token is issued for the application of the admin's own token, so service accounts cannot impersonate
+	admin := middleware.GetAdmin(c)
+	if admin.Type != models.AdminPrincipalTypeUser {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Impersonation requires an admin user", nil))
+		return
+	}
+	adminID := admin.ID
+	if c.Param("id") == adminID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Cannot impersonate yourself", nil))
+		return
+	}
+
+	user, ok := loadAdminUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	// the token is issued for the application in the request, so the user must belong to its tenant
+	app := middleware.GetApplication(c)
+	if user.TenantID != app.TenantID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("User does not belong to the application's tenant", nil))
+		return
+	}
+
+	site, err := getSite(c, form.Site)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Site not found", nil))
+		return
+	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteUnavailableMessage, nil))
+		return
+	}
+
+	sites, err := getEffectiveSites(c, user)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return
+	}
+	if !helpers.HasScope(sites, site.SiteID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("User does not have access to the site", nil))
+		return
+	}
+	allowed, err := isApplicationSite(c, app, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(helpers.SiteNotAllowedMessage, nil))
+		return
+	}
+
+	err = middleware.RecordAuditEvent(c, &models.AuditEvent{
+		Action:   models.AuditActionImpersonate,
+		TenantID: user.TenantID,
+		UserID:   user.ID,
+		SiteID:   site.SiteID,
+		Reason:   form.Reason,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save audit event", err))
+		return
+	}
+
+	roles, err := getUserRoles(c, user.ID, app.ID, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get roles", err))
+		return
+	}
+
+	now := time.Now().UTC()
+	authCode := &models.AuthCode{
+		Code:          helpers.GenerateAuthCode(),
+		UserID:        user.ID,
+		Email:         user.Email,
+		ApplicationID: app.ID,
+		AuthType:      models.AuthTypeImpersonation,
+		Sites:         []string{site.SiteID},
+		IP:            c.ClientIP(),
+		DateCreated:   now,
+	}
+
+	err = datastore.GetFromContext(c).UpsertAuthCode(authCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AuthCode", err))
+		return
+	}
+
+	accessToken := &models.AccessToken{
+		Token:          helpers.GenerateAccessToken(authCode.Code),
+		Type:           models.AccessTokenTypeUser,
+		ApplicationID:  app.ID,
+		UserID:         user.ID,
+		AuthCode:       authCode.Code,
+		SiteID:         site.SiteID,
+		Roles:          roles,
+		ImpersonatorID: adminID,
+		DateCreated:    now,
+		DateExpires:    now.Add(config.ImpersonationTTL),
+	}
+
+	err = saveAccessToken(c, app, accessToken, authCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to create AccessToken", err))
+		return
+	}
+
+	model := &models.AccessTokenDetailed{
+		Token:               accessToken.Token,
+		DateExpires:         accessToken.DateExpires,
+		UserID:              user.ID,
+		Email:               user.Email,
+		IsValidated:         user.IsValidated,
+		DatePasswordExpires: user.DateExpires,
+		Site:                site,
+		Status:              helpers.GetLoginStatus(user.IsValidated, user.DateExpires),
+		AuthType:            authCode.AuthType,
+		Application:         app,
+		Roles:               roles,
+		ImpersonatorID:      adminID,
+	}
+	datastore.GetFromContext(c).UpsertAccessTokenDetailedToCache(model)
+
+	c.Header(middleware.AccessTokenHeaderKey, model.Token)
+	c.Header(middleware.SiteHeaderKey, site.SiteURL)
+	c.JSON(http.StatusCreated, model)
+}
@@ -0,0 +1,204 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+// IntrospectToken returns the state of the token in the request form as defined by RFC 7662.
+// The caller is the resource server and authenticates with its own client credentials.
+func IntrospectToken(c *gin.Context) {
+	form := &models.IntrospectionRequest{}
+	err := c.ShouldBind(form)
+	if err != nil || len(form.Token) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing token"))
+		return
+	}
+
+	var response *models.IntrospectionResponse
+	if form.TokenTypeHint == models.TokenTypeHintRefreshToken {
+		response, err = introspectRefreshToken(c, form.Token)
+		if err == nil && !response.Active {
+			response, err = introspectAccessToken(c, form.Token)
+		}
+	} else {
+		response, err = introspectAccessToken(c, form.Token)
+		if err == nil && !response.Active {
+			response, err = introspectRefreshToken(c, form.Token)
+		}
+	}
+	if err == nil && response.Active {
+		// resource servers cannot see the tokens of other tenants
+		var ok bool
+		ok, err = isTenantApplication(c, response.ClientID)
+		if !ok {
+			response = &models.IntrospectionResponse{Active: false}
+		}
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to introspect token"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// introspectAccessToken builds the introspection response for an AccessToken
+func introspectAccessToken(c *gin.Context, token string) (*models.IntrospectionResponse, error) {
+	inactive := &models.IntrospectionResponse{Active: false}
+
+	accessToken, authCode, err := getAccessTokenAndAuthCode(c, token)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken == nil {
+		return inactive, nil
+	}
+
+	response := &models.IntrospectionResponse{
+		Active:         true,
+		ClientID:       accessToken.ApplicationID,
+		TokenType:      models.TokenTypeBearer,
+		Iat:            accessToken.DateCreated.Unix(),
+		Iss:            helpers.GetIssuer(c.Request),
+		AuthType:       authCode.AuthType,
+		Scope:          helpers.FormatScope(helpers.GetAccessTokenScopes(accessToken, authCode)),
+		Roles:          accessToken.Roles,
+		Act:            accessToken.Actor,
+		ImpersonatorID: accessToken.ImpersonatorID,
+	}
+	if !accessToken.DateExpires.IsZero() {
+		response.Exp = accessToken.DateExpires.Unix()
+	}
+
+	if accessToken.Type == models.AccessTokenTypeApplication {
+		response.Sub = accessToken.ApplicationID
+	} else {
+		response.Sub = authCode.UserID
+		response.Username = authCode.Email
+	}
+
+	found, err := addSiteClaims(c, response, accessToken.SiteID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return inactive, nil
+	}
+
+	return response, nil
+}
+
+// getAccessTokenAndAuthCode gets an unexpired AccessToken, opaque or JWT, and the AuthCode it was issued from
+func getAccessTokenAndAuthCode(c *gin.Context, token string) (*models.AccessToken, *models.AuthCode, error) {
+	if helpers.IsJWT(token) {
+		return helpers.ParseAccessTokenJWT(c, token)
+	}
+
+	accessToken, err := datastore.GetFromContext(c).GetAccessToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if accessToken == nil {
+		return nil, nil, nil
+	}
+	if !accessToken.DateExpires.IsZero() && accessToken.DateExpires.Before(time.Now().UTC()) {
+		return nil, nil, nil
+	}
+	available, err := helpers.IsTokenSiteAvailable(c, accessToken.SiteID)
+	if err != nil || !available {
+		return nil, nil, err
+	}
+
+	authCode, err := datastore.GetFromContext(c).GetAuthCode(accessToken.AuthCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if authCode == nil {
+		return nil, nil, nil
+	}
+
+	return accessToken, authCode, nil
+}
+
+// introspectRefreshToken builds the introspection response for a RefreshToken
+func introspectRefreshToken(c *gin.Context, token string) (*models.IntrospectionResponse, error) {
+	inactive := &models.IntrospectionResponse{Active: false}
+
+	refreshToken, err := datastore.GetFromContext(c).GetRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken == nil || refreshToken.IsUsed {
+		return inactive, nil
+	}
+
+	family, err := datastore.GetFromContext(c).GetRefreshTokenFamily(refreshToken.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if family == nil {
+		return inactive, nil
+	}
+
+	authCode, err := datastore.GetFromContext(c).GetAuthCode(refreshToken.AuthCode)
+	if err != nil {
+		return nil, err
+	}
+	if authCode == nil {
+		return inactive, nil
+	}
+
+	expires, err := getRefreshTokenExpiry(c, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if expires.Before(time.Now().UTC()) {
+		return inactive, nil
+	}
+
+	response := &models.IntrospectionResponse{
+		Active:   true,
+		ClientID: refreshToken.ApplicationID,
+		Iat:      refreshToken.DateCreated.Unix(),
+		Exp:      expires.Unix(),
+		Iss:      helpers.GetIssuer(c.Request),
+		Sub:      authCode.UserID,
+		Username: authCode.Email,
+		AuthType: authCode.AuthType,
+	}
+
+	found, err := addSiteClaims(c, response, refreshToken.SiteID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return inactive, nil
+	}
+
+	return response, nil
+}
+
+// addSiteClaims adds the site claims to the response, returning false if the site no longer exists or is unavailable
+func addSiteClaims(c context.Context, response *models.IntrospectionResponse, siteID string) (bool, error) {
+	site, err := datastore.GetFromContext(c).GetCurrentSite(siteID)
+	if err != nil {
+		return false, err
+	}
+	if site == nil || !site.IsAvailable() {
+		return false, nil
+	}
+
+	response.SiteID = site.SiteID
+	response.SiteURL = site.SiteURL
+	response.SiteName = site.SiteName
+	return true, nil
+}
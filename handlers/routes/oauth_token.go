@@ -0,0 +1,243 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// CreateOAuthToken issues an access token for the grant type in the request form
+func CreateOAuthToken(c *gin.Context) {
+	form := &models.TokenRequest{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Unable to read form"))
+		return
+	}
+
+	// token responses must never be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	// applications that registered their grant types can only use those
+	app := middleware.GetApplication(c)
+	if len(form.GrantType) > 0 && len(app.GrantTypes) > 0 && !helpers.HasScope(app.GrantTypes, form.GrantType) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorUnauthorizedClient, "Grant type is not registered for the client"))
+		return
+	}
+
+	switch form.GrantType {
+	case models.GrantTypeAuthorizationCode:
+		createAuthorizationCodeToken(c, form)
+	case models.GrantTypeClientCredentials:
+		createClientCredentialsToken(c, form)
+	case models.GrantTypeRefreshToken:
+		createRefreshTokenGrantToken(c, form)
+	case models.GrantTypeDeviceCode:
+		createDeviceCodeToken(c, form)
+	case models.GrantTypeTokenExchange:
+		createTokenExchangeToken(c, form)
+	case "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing grant_type"))
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorUnsupportedGrantType, ""))
+	}
+}
+
+// createAuthorizationCodeToken exchanges a code from the authorization endpoint for a user access token,
+// refresh token and, when the openid scope was requested, an ID token. The code can only be used once,
+// by the client it was issued to, with the same redirect uri and the PKCE code verifier.
+func createAuthorizationCodeToken(c *gin.Context, form *models.TokenRequest) {
+	if len(form.Code) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing code"))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	store := datastore.GetFromContext(c)
+	code, err := store.UseAuthorizationCode(form.Code)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to use code"))
+		return
+	}
+	if code == nil || code.ApplicationID != app.ID || code.RedirectURI != form.RedirectURI || !helpers.VerifyCodeChallenge(code.CodeChallenge, form.CodeVerifier) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Invalid code"))
+		return
+	}
+
+	authCode, err := store.GetAuthCode(code.AuthCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get AuthCode"))
+		return
+	}
+	if authCode == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Authorization has been revoked"))
+		return
+	}
+	if authCode.PasswordChangeRequired {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.PasswordChangeRequiredMessage))
+		return
+	}
+
+	site, ok := getTokenRequestSite(c, form)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(authCode.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get user"))
+		return
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "User not found"))
+		return
+	}
+
+	allowed, err := hasSiteAccess(c, user.ID, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get list of sites"))
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, "User does not have access to the site"))
+		return
+	}
+
+	scopes, ok := helpers.NarrowScopes(authCode.Scopes, helpers.ParseScope(form.Scope))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidScope, "Scope was not granted to the code"))
+		return
+	}
+
+	decision, err := checkTokenPolicy(c, app, authCode, user, site, scopes)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to evaluate policy"))
+		return
+	}
+	if !decision.Allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, policyDeniedMessage(decision)))
+		return
+	}
+
+	model, err := createUserAccessToken(c, app, authCode, user, site, scopes, "")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create AccessToken"))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken:  model.Token,
+		TokenType:    models.TokenTypeBearer,
+		ExpiresIn:    getExpiresIn(model.DateExpires),
+		RefreshToken: model.RefreshToken,
+		IDToken:      model.IDToken,
+		SiteID:       site.SiteID,
+		Scope:        helpers.FormatScope(model.Scopes),
+	})
+}
+
+// createClientCredentialsToken issues an application access token for the authenticated client
+func createClientCredentialsToken(c *gin.Context, form *models.TokenRequest) {
+	if middleware.GetClientAuthMethod(c) == models.ClientAuthMethodNone {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorUnauthorizedClient, "Public clients cannot use the client_credentials grant"))
+		return
+	}
+
+	site, ok := getTokenRequestSite(c, form)
+	if !ok {
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	scopes, ok := helpers.NarrowScopes(app.Scopes, helpers.ParseScope(form.Scope))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidScope, "Scope is not allowed for the client"))
+		return
+	}
+
+	model, err := createApplicationAccessToken(c, app, site, scopes, form.IP)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create AccessToken"))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken: model.Token,
+		TokenType:   models.TokenTypeBearer,
+		ExpiresIn:   getExpiresIn(model.DateExpires),
+		SiteID:      site.SiteID,
+		Scope:       helpers.FormatScope(model.Scopes),
+	})
+}
+
+// getTokenRequestSite gets the site from the form or, if it is not in the form, the site header.
+// The request is aborted and false is returned if the site cannot be found, is unavailable or is not
+// allowed for the client.
+func getTokenRequestSite(c *gin.Context, form *models.TokenRequest) (*models.Site, bool) {
+	siteID := form.Site
+	if len(siteID) == 0 {
+		siteID = c.Request.Header.Get(middleware.SiteHeaderKey)
+	}
+	if len(siteID) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing site"))
+		return nil, false
+	}
+
+	// get site from couchbase datastore
+	site, err := getSite(c, siteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get site"))
+		return nil, false
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Site not found"))
+		return nil, false
+	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.SiteUnavailableMessage))
+		return nil, false
+	}
+
+	allowed, err := isApplicationSite(c, middleware.GetApplication(c), site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get tenant"))
+		return nil, false
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.SiteNotAllowedMessage))
+		return nil, false
+	}
+
+	return site, true
+}
+
+// createRefreshTokenGrantToken rotates the refresh token and issues a new user access token
+func createRefreshTokenGrantToken(c *gin.Context, form *models.TokenRequest) {
+	if len(form.RefreshToken) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing refresh_token"))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	model, gErr := refreshUserAccessToken(c, app, form.RefreshToken, form.Scope)
+	if gErr != nil {
+		c.AbortWithStatusJSON(gErr.oauthStatus(), helpers.PrepareOAuthErrorResponse(gErr.Code, gErr.Message))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken:  model.Token,
+		TokenType:    models.TokenTypeBearer,
+		ExpiresIn:    getExpiresIn(model.DateExpires),
+		RefreshToken: model.RefreshToken,
+		IDToken:      model.IDToken,
+		SiteID:       model.Site.SiteID,
+		Scope:        helpers.FormatScope(model.Scopes),
+	})
+}
@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/jobs"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetOpenIDConfiguration returns the OpenID Connect discovery document
+func GetOpenIDConfiguration(c *gin.Context) {
+	issuer := helpers.GetIssuer(c.Request)
+	c.JSON(http.StatusOK, &models.OpenIDConfiguration{
+		Issuer:                      issuer,
+		AuthorizationEndpoint:       issuer + "/oauth/authorize",
+		TokenEndpoint:               issuer + "/oauth/token",
+		UserInfoEndpoint:            issuer + "/userinfo",
+		JWKSURI:                     issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:          issuer + "/oauth/revoke",
+		IntrospectionEndpoint:       issuer + "/oauth/introspect",
+		DeviceAuthorizationEndpoint: issuer + "/oauth/device_authorization",
+		RegistrationEndpoint:        issuer + "/oauth/register",
+		ScopesSupported:             []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile},
+		ResponseTypesSupported: []string{
+			"code",
+		},
+		GrantTypesSupported: []string{
+			models.GrantTypeAuthorizationCode,
+			models.GrantTypeRefreshToken,
+			models.GrantTypeClientCredentials,
+			models.GrantTypeDeviceCode,
+			models.GrantTypeTokenExchange,
+		},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{helpers.AlgorithmRS256},
+		TokenEndpointAuthMethodsSupported: []string{
+			models.ClientAuthMethodSecretBasic,
+			models.ClientAuthMethodSecretPost,
+			models.ClientAuthMethodNone,
+			models.ClientAuthMethodTLS,
+			models.ClientAuthMethodSelfSignedTLS,
+			models.ClientAuthMethodPrivateKeyJWT,
+		},
+		TokenEndpointAuthSigningAlgValuesSupported: []string{helpers.AlgorithmRS256, helpers.AlgorithmES256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "name", "given_name", "family_name",
+		},
+		CodeChallengeMethodsSupported: []string{models.CodeChallengeMethodS256},
+	})
+}
+
+// GetJWKS returns the public keys used to verify signed tokens, including keys that are about to
+// become active and keys that have been retired but may still have signed unexpired tokens
+func GetJWKS(c *gin.Context) {
+	set, err := helpers.GetPublishedJWKS(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing keys", err))
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+// RotateSigningKeys immediately replaces the active signing keys. With compromised=true the replaced
+// keys are removed from the JWKS at once instead of staying published until their tokens expire.
+func RotateSigningKeys(c *gin.Context) {
+	compromised, err := strconv.ParseBool(c.DefaultQuery("compromised", "false"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid compromised", err))
+		return
+	}
+
+	err = jobs.RotateSigningKeysNow(datastore.GetFromContext(c), compromised)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to rotate signing keys", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetUserInfo returns the claims about the owner of the access token that its scopes allow
+func GetUserInfo(c *gin.Context) {
+	authCode := middleware.GetAuthCode(c)
+	if len(authCode.UserID) == 0 || !helpers.HasScope(authCode.Scopes, models.ScopeOpenID) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareOAuthErrorResponse("insufficient_scope", "The access token was not issued with the openid scope"))
+		return
+	}
+
+	user, err := datastore.GetFromContext(c).GetUser(authCode.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user", err))
+		return
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("User not found", nil))
+		return
+	}
+
+	info := helpers.BuildUserInfo(user, authCode.Scopes)
+	c.JSON(http.StatusOK, &info)
+}
+
+// createIDToken creates a signed OpenID Connect ID token for the user
+func createIDToken(c *gin.Context, app *models.Application, authCode *models.AuthCode, user *models.User) (string, error) {
+	ttl, err := getAccessTokenTTL(c, app.TenantID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims := &models.IDTokenClaims{
+		Issuer:   helpers.GetIssuer(c.Request),
+		Audience: app.ID,
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(ttl).Unix(),
+		AuthTime: helpers.GetAuthTime(user, authCode).Unix(),
+		Nonce:    authCode.Nonce,
+		UserInfo: helpers.BuildUserInfo(user, authCode.Scopes),
+	}
+
+	key, err := helpers.GetActiveSigningKey(c, helpers.AlgorithmRS256)
+	if err != nil {
+		return "", err
+	}
+
+	return helpers.SignJWT(key, claims)
+}
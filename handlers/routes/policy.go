@@ -0,0 +1,221 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb"
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetPolicy returns the current Policy of the application, or the version in the query
+func GetPolicy(c *gin.Context) {
+	getPolicy(c, middleware.GetApplication(c))
+}
+
+// GetAdminPolicy returns the current Policy of the Application defined by the id, or the version in the query
+func GetAdminPolicy(c *gin.Context) {
+	app, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+
+	getPolicy(c, app)
+}
+
+func getPolicy(c *gin.Context, app *models.Application) {
+	var policy *models.Policy
+	var err error
+	if value := c.Query("version"); len(value) > 0 {
+		version, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Invalid version", convErr))
+			return
+		}
+		policy, err = datastore.GetFromContext(c).GetPolicyVersion(app.ID, version)
+	} else {
+		policy, err = datastore.GetFromContext(c).GetPolicy(app.ID)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get policy", err))
+		return
+	}
+	if policy == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Policy not found", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpsertPolicy saves the Policy in the body as a new version. Earlier versions are kept so they can be
+// read or saved again to roll back.
+func UpsertPolicy(c *gin.Context) {
+	upsertPolicy(c, middleware.GetApplication(c))
+}
+
+// UpsertAdminPolicy saves the Policy in the body as a new version for the Application defined by the id
+func UpsertAdminPolicy(c *gin.Context) {
+	app, ok := loadApplication(c)
+	if !ok {
+		return
+	}
+
+	upsertPolicy(c, app)
+}
+
+func upsertPolicy(c *gin.Context, app *models.Application) {
+	form := &models.UpsertPolicyRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	current, err := datastore.GetFromContext(c).GetPolicy(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get policy", err))
+		return
+	}
+
+	policy := &models.Policy{
+		ApplicationID: app.ID,
+		Version:       1,
+		DefaultEffect: form.DefaultEffect,
+		TimeZone:      form.TimeZone,
+		Rules:         form.Rules,
+		DateCreated:   time.Now().UTC(),
+	}
+	if current != nil {
+		policy.Version = current.Version + 1
+	}
+	if policy.Rules == nil {
+		policy.Rules = []*models.PolicyRule{}
+	}
+
+	err = helpers.ValidatePolicy(policy)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse(fmt.Sprintf("Invalid policy: %v", err), nil))
+		return
+	}
+
+	err = datastore.GetFromContext(c).InsertPolicy(policy)
+	if err == gocb.ErrKeyExists {
+		c.AbortWithStatusJSON(http.StatusConflict, helpers.PrepareErrorResponse("Policy was changed by another request", nil))
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save policy", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, policy)
+}
+
+// Authorize evaluates the application's Policy for the AccessToken in the header and returns the
+// decision with its reasons
+func Authorize(c *gin.Context) {
+	form := &models.AuthorizeRequest{}
+	if c.Request.Body != http.NoBody {
+		err := c.BindJSON(form)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+			return
+		}
+	}
+
+	accessToken := middleware.GetAccessToken(c)
+	authCode := middleware.GetAuthCode(c)
+
+	siteID := accessToken.SiteID
+	if len(form.Site) > 0 {
+		siteID = form.Site
+	}
+	site, err := getSite(c, siteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Site not found", nil))
+		return
+	}
+	if site.SiteID != accessToken.SiteID {
+		allowed := false
+		if accessToken.Type != models.AccessTokenTypeApplication {
+			allowed, err = hasSiteAccess(c, authCode.UserID, site.SiteID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+				return
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusOK, &models.PolicyDecision{Allowed: false, Reasons: []string{"Token does not have access to the site"}})
+			return
+		}
+	}
+
+	var user *models.User
+	if accessToken.Type != models.AccessTokenTypeApplication {
+		user, err = datastore.GetFromContext(c).GetUser(authCode.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user", err))
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("User not found", nil))
+			return
+		}
+	}
+
+	policy, err := datastore.GetFromContext(c).GetPolicy(middleware.GetApplication(c).ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get policy", err))
+		return
+	}
+
+	ip := form.IP
+	if len(ip) == 0 {
+		ip = authCode.IP
+	}
+
+	c.JSON(http.StatusOK, helpers.EvaluatePolicy(policy, helpers.NewPolicyInput(user, site, authCode, accessToken, ip)))
+}
+
+// checkTokenPolicy evaluates the application's Policy for a new user AccessToken with the scopes
+func checkTokenPolicy(c *gin.Context, app *models.Application, authCode *models.AuthCode, user *models.User, site *models.Site, scopes []string) (*models.PolicyDecision, error) {
+	policy, err := datastore.GetFromContext(c).GetPolicy(app.ID)
+	if err != nil || policy == nil {
+		return helpers.EvaluatePolicy(nil, nil), err
+	}
+
+	roles, err := getUserRoles(c, user.ID, app.ID, site.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token that would be issued
+	accessToken := &models.AccessToken{
+		Type:          models.AccessTokenTypeUser,
+		ApplicationID: app.ID,
+		UserID:        user.ID,
+		SiteID:        site.SiteID,
+		Scopes:        scopes,
+		Roles:         roles,
+	}
+
+	return helpers.EvaluatePolicy(policy, helpers.NewPolicyInput(user, site, authCode, accessToken, authCode.IP)), nil
+}
+
+// policyDeniedMessage describes a denied PolicyDecision
+func policyDeniedMessage(decision *models.PolicyDecision) string {
+	return fmt.Sprintf("Denied by policy: %s", strings.Join(decision.Reasons, ", "))
+}
@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// RevokeToken revokes the access or refresh token in the request form as defined by RFC 7009.
+// Only tokens issued to the authenticated client are revoked, and the response is the same
+// whether or not the token was found.
+func RevokeToken(c *gin.Context) {
+	form := &models.IntrospectionRequest{}
+	err := c.ShouldBind(form)
+	if err != nil || len(form.Token) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing token"))
+		return
+	}
+
+	app := middleware.GetApplication(c)
+	if form.TokenTypeHint == models.TokenTypeHintRefreshToken {
+		err = revokeRefreshToken(c, app, form.Token)
+		if err == nil {
+			err = revokeAccessToken(c, app, form.Token)
+		}
+	} else {
+		err = revokeAccessToken(c, app, form.Token)
+		if err == nil {
+			err = revokeRefreshToken(c, app, form.Token)
+		}
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to revoke token"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// DeleteUserSessions signs the user who owns the AccessToken out of every session
+func DeleteUserSessions(c *gin.Context) {
+	authCode := middleware.GetAuthCode(c)
+	if len(authCode.UserID) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("AccessToken does not belong to a user", nil))
+		return
+	}
+
+	err := datastore.GetFromContext(c).RevokeUserTokens(authCode.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to revoke tokens", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUserTokens revokes every token issued to the user defined by the id
+func DeleteUserTokens(c *gin.Context) {
+	user, ok := loadAdminUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	err := datastore.GetFromContext(c).RevokeUserTokens(user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to revoke tokens", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func revokeAccessToken(c *gin.Context, app *models.Application, token string) error {
+	accessToken, _, err := getAccessTokenAndAuthCode(c, token)
+	if err != nil {
+		return err
+	}
+	if accessToken == nil || accessToken.ApplicationID != app.ID {
+		return nil
+	}
+
+	if len(accessToken.JWTID) > 0 {
+		return datastore.GetFromContext(c).RevokeJWTID(accessToken.JWTID, accessToken.DateExpires)
+	}
+
+	return datastore.GetFromContext(c).DeleteAccessToken(accessToken.Token)
+}
+
+// GetRevokedTokens returns the ids of JWT access tokens that were revoked before they expired, so that
+// services verifying them offline can also reject them
+func GetRevokedTokens(c *gin.Context) {
+	tokens, err := datastore.GetFromContext(c).GetRevokedTokens()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get revoked tokens", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// revokeRefreshToken revokes the refresh token along with every token issued from the same grant
+func revokeRefreshToken(c *gin.Context, app *models.Application, token string) error {
+	refreshToken, err := datastore.GetFromContext(c).GetRefreshToken(token)
+	if err != nil {
+		return err
+	}
+	if refreshToken == nil || refreshToken.ApplicationID != app.ID {
+		return nil
+	}
+
+	return datastore.GetFromContext(c).RevokeRefreshTokenFamily(refreshToken.FamilyID)
+}
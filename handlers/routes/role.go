@@ -0,0 +1,254 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetUserRoles returns every role assigned to the user defined by the id
+func GetUserRoles(c *gin.Context) {
+	user, ok := loadAdminUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	assignments, err := datastore.GetFromContext(c).GetRoleAssignments(user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get roles", err))
+		return
+	}
+
+	response := []*models.RoleAssignment{}
+	if assignments != nil {
+		response = assignments.Assignments
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AddUserRole assigns an application's role on a site to the user defined by the id. Tokens issued
+// before the change keep the roles they were issued with.
+func AddUserRole(c *gin.Context) {
+	assignment, assignments, ok := getRoleAssignmentRequest(c)
+	if !ok {
+		return
+	}
+
+	for _, existing := range assignments.Assignments {
+		if *existing == *assignment {
+			c.JSON(http.StatusOK, assignments.Assignments)
+			return
+		}
+	}
+	assignments.Assignments = append(assignments.Assignments, assignment)
+
+	err := datastore.GetFromContext(c).UpsertRoleAssignments(assignments)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save roles", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, assignments.Assignments)
+}
+
+// DeleteUserRole removes an application's role on a site from the user defined by the id
+func DeleteUserRole(c *gin.Context) {
+	assignment, assignments, ok := getRoleAssignmentRequest(c)
+	if !ok {
+		return
+	}
+
+	remaining := []*models.RoleAssignment{}
+	for _, existing := range assignments.Assignments {
+		if *existing != *assignment {
+			remaining = append(remaining, existing)
+		}
+	}
+	if len(remaining) == len(assignments.Assignments) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Role assignment not found", nil))
+		return
+	}
+
+	assignments.Assignments = remaining
+	err := datastore.GetFromContext(c).UpsertRoleAssignments(assignments)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save roles", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CheckPermission answers whether the token in the request form can perform an action on a site.
+// The site defaults to the site of the token, and the roles are read when the request is made so
+// roles removed since the token was issued no longer count.
+func CheckPermission(c *gin.Context) {
+	form := &models.PermissionRequest{}
+	err := c.ShouldBind(form)
+	if err != nil || len(form.Token) == 0 || len(form.Permission) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing token or permission"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	denied := &models.PermissionResponse{Allowed: false}
+
+	accessToken, authCode, err := getAccessTokenAndAuthCode(c, form.Token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get token"))
+		return
+	}
+	if accessToken == nil || accessToken.Type == models.AccessTokenTypeApplication {
+		c.JSON(http.StatusOK, denied)
+		return
+	}
+	if ok, err := isTenantApplication(c, accessToken.ApplicationID); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get application"))
+		return
+	} else if !ok {
+		c.JSON(http.StatusOK, denied)
+		return
+	}
+
+	siteID := accessToken.SiteID
+	if len(form.Site) > 0 {
+		site, err := getSite(c, form.Site)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get site"))
+			return
+		}
+		if site == nil {
+			c.JSON(http.StatusOK, denied)
+			return
+		}
+		if site.SiteID != accessToken.SiteID {
+			allowed, err := hasSiteAccess(c, authCode.UserID, site.SiteID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get list of sites"))
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusOK, denied)
+				return
+			}
+		}
+		siteID = site.SiteID
+	}
+
+	app, err := datastore.GetFromContext(c).GetApplication(accessToken.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get application"))
+		return
+	}
+	if app == nil {
+		c.JSON(http.StatusOK, denied)
+		return
+	}
+
+	roles, err := getUserRoles(c, accessToken.UserID, app.ID, siteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get roles"))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.PermissionResponse{
+		Allowed: helpers.HasPermission(app, roles, form.Permission),
+		SiteID:  siteID,
+		Roles:   roles,
+	})
+}
+
+// getRoleAssignmentRequest reads the RoleAssignmentRequest in the body, checks the role and site
+// exist and gets the roles already assigned to the user. The request is aborted and false is
+// returned if any of them are not valid.
+func getRoleAssignmentRequest(c *gin.Context) (*models.RoleAssignment, *models.RoleAssignments, bool) {
+	form := &models.RoleAssignmentRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return nil, nil, false
+	}
+	if len(form.ApplicationID) == 0 || len(form.Site) == 0 || len(form.Role) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing application_id, site or role", nil))
+		return nil, nil, false
+	}
+
+	user, ok := loadAdminUser(c, c.Param("id"))
+	if !ok {
+		return nil, nil, false
+	}
+
+	// the application and site must belong to the user's tenant
+	app, err := datastore.GetFromContext(c).GetApplication(form.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return nil, nil, false
+	}
+	if app == nil || app.TenantID != user.TenantID || helpers.GetRole(app, form.Role) == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Role is not defined by the application", nil))
+		return nil, nil, false
+	}
+
+	site, err := getTenantSite(c, user.TenantID, form.Site)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return nil, nil, false
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Site not found", nil))
+		return nil, nil, false
+	}
+
+	assignments, err := datastore.GetFromContext(c).GetRoleAssignments(user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get roles", err))
+		return nil, nil, false
+	}
+	if assignments == nil {
+		assignments = &models.RoleAssignments{UserID: user.ID, Assignments: []*models.RoleAssignment{}}
+	}
+
+	assignment := &models.RoleAssignment{
+		ApplicationID: app.ID,
+		SiteID:        site.SiteID,
+		Role:          form.Role,
+	}
+	return assignment, assignments, true
+}
+
+// getUserRoles returns the names of the application's roles assigned to the user on the site
+func getUserRoles(c context.Context, userID, applicationID, siteID string) ([]string, error) {
+	assignments, err := datastore.GetFromContext(c).GetRoleAssignments(userID)
+	if err != nil {
+		return nil, err
+	}
+	if assignments == nil {
+		assignments = &models.RoleAssignments{UserID: userID}
+	}
+
+	// roles granted to the user's groups are combined with the direct assignments
+	user, err := datastore.GetFromContext(c).GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && len(user.Groups) > 0 {
+		groups, err := getUserGroups(c, user)
+		if err != nil {
+			return nil, err
+		}
+
+		combined := &models.RoleAssignments{UserID: userID, Assignments: append([]*models.RoleAssignment{}, assignments.Assignments...)}
+		for _, group := range groups {
+			combined.Assignments = append(combined.Assignments, group.Roles...)
+		}
+		assignments = combined
+	}
+
+	return helpers.GetRoles(assignments, applicationID, siteID), nil
+}
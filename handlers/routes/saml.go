@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetSAMLMetadata returns the SAML 2.0 identity provider metadata
+func GetSAMLMetadata(c *gin.Context) {
+	certs, err := helpers.GetSAMLCertificates(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing keys", err))
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", []byte(helpers.BuildSAMLMetadata(helpers.GetIssuer(c.Request), certs)))
+}
+
+// SAMLSingleSignOn accepts an AuthnRequest from a service provider with either the redirect or POST
+// binding, saves it and sends the user to the login page to sign in
+func SAMLSingleSignOn(c *gin.Context) {
+	if len(config.SAMLLoginURL) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("SAML is not configured", nil))
+		return
+	}
+
+	redirectBinding := c.Request.Method == http.MethodGet
+	var encoded, relayState string
+	if redirectBinding {
+		encoded, relayState = c.Query("SAMLRequest"), c.Query("RelayState")
+	} else {
+		encoded, relayState = c.PostForm("SAMLRequest"), c.PostForm("RelayState")
+	}
+	if len(encoded) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request is missing SAMLRequest", nil))
+		return
+	}
+
+	authnRequest, err := helpers.ParseSAMLAuthnRequest(encoded, redirectBinding)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read SAMLRequest", err))
+		return
+	}
+
+	app, err := datastore.GetFromContext(c).GetApplicationBySAMLEntityID(authnRequest.Issuer)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return
+	}
+	if app == nil || app.SAML == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unknown service provider", nil))
+		return
+	}
+
+	if message, err := checkSAMLRequestSignature(app.SAML, redirectBinding, c.Request.URL.RawQuery); len(message) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse(message, err))
+		return
+	}
+
+	acsURL, ok := getSAMLACSURL(app.SAML, authnRequest.AssertionConsumerServiceURL)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("AssertionConsumerServiceURL is not registered", nil))
+		return
+	}
+
+	request := &models.SAMLRequest{
+		ID:            uuid.New().String(),
+		RequestID:     authnRequest.ID,
+		ApplicationID: app.ID,
+		ACSURL:        acsURL,
+		RelayState:    relayState,
+		DateCreated:   time.Now().UTC(),
+	}
+	err = datastore.GetFromContext(c).InsertSAMLRequest(request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save SAMLRequest", err))
+		return
+	}
+
+	loginURL, err := url.Parse(config.SAMLLoginURL)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Invalid SAML login URL", err))
+		return
+	}
+	query := loginURL.Query()
+	query.Set("saml_request", request.ID)
+	loginURL.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, loginURL.String())
+}
+
+// CreateSAMLResponse builds the signed response to a saved AuthnRequest for the user of the AuthCode
+// in the context. The login page posts it to the acs_url of the service provider.
+func CreateSAMLResponse(c *gin.Context) {
+	form := &models.CreateSAMLResponseRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	request, err := store.GetSAMLRequest(form.SAMLRequest)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get SAMLRequest", err))
+		return
+	}
+	if request == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("SAMLRequest not found", nil))
+		return
+	}
+
+	app, err := store.GetApplication(request.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get application", err))
+		return
+	}
+	if app == nil || app.SAML == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Service provider not found", nil))
+		return
+	}
+
+	authCode := middleware.GetAuthCode(c)
+	user, err := store.GetUser(authCode.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user", err))
+		return
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("User not found", nil))
+		return
+	}
+
+	key, err := helpers.GetSAMLSigningKey(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing key", err))
+		return
+	}
+
+	// only one response is issued for each AuthnRequest
+	ok, err := store.DeleteSAMLRequest(request.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete SAMLRequest", err))
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("SAMLRequest not found", nil))
+		return
+	}
+
+	sites, err := getEffectiveSites(c, user)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return
+	}
+
+	response, err := helpers.BuildSAMLResponse(helpers.GetIssuer(c.Request), key, app.SAML, request, user, sites, helpers.GetAuthTime(user, authCode))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to build SAMLResponse", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.SAMLResponse{
+		ACSURL:       request.ACSURL,
+		SAMLResponse: response,
+		RelayState:   request.RelayState,
+	})
+}
+
+// getSAMLACSURL returns the requested ACS URL if it is registered, or the first registered ACS URL
+// when the request did not include one
+// checkSAMLRequestSignature verifies the signature of an AuthnRequest with the service provider's
+// certificate. Signatures are only checked on the redirect binding, where the signed value does not
+// depend on how the XML is serialized. A description of the problem is returned when the request
+// may not be used.
+func checkSAMLRequestSignature(sp *models.SAMLServiceProvider, redirectBinding bool, rawQuery string) (string, error) {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "Invalid query", err
+	}
+
+	signed := redirectBinding && len(query.Get("Signature")) > 0
+	if sp.WantAuthnRequestsSigned && !signed {
+		return "Signed requests must use the redirect binding", nil
+	}
+	if len(sp.Certificate) == 0 {
+		if sp.WantAuthnRequestsSigned {
+			return "Service provider has no certificate to verify the request signature", nil
+		}
+		return "", nil
+	}
+	if !signed {
+		return "", nil
+	}
+
+	err = helpers.VerifySAMLRedirectSignature(rawQuery, sp.Certificate)
+	if err != nil {
+		return "Invalid request signature", err
+	}
+
+	return "", nil
+}
+
+func getSAMLACSURL(sp *models.SAMLServiceProvider, requested string) (string, bool) {
+	if len(sp.ACSURLs) == 0 {
+		return "", false
+	}
+	if len(requested) == 0 {
+		return sp.ACSURLs[0], true
+	}
+
+	for _, acsURL := range sp.ACSURLs {
+		if acsURL == requested {
+			return acsURL, true
+		}
+	}
+
+	return "", false
+}
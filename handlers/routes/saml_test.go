@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/models"
+)
+
+const testSAMLSigAlg = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+
+// newTestSAMLCertificate returns a service provider key and its PEM encoded certificate
+func newTestSAMLCertificate(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// signTestSAMLQuery returns the query of a redirect binding AuthnRequest signed with the key
+func signTestSAMLQuery(t *testing.T, key *rsa.PrivateKey) string {
+	signed := "SAMLRequest=" + url.QueryEscape("request") + "&RelayState=" + url.QueryEscape("state") + "&SigAlg=" + url.QueryEscape(testSAMLSigAlg)
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig))
+}
+
+func TestCheckSAMLRequestSignature(t *testing.T) {
+	key, certificate := newTestSAMLCertificate(t)
+	otherKey, _ := newTestSAMLCertificate(t)
+
+	signed := signTestSAMLQuery(t, key)
+	unsigned := "SAMLRequest=request&RelayState=state"
+
+	tests := []struct {
+		name            string
+		sp              *models.SAMLServiceProvider
+		redirectBinding bool
+		rawQuery        string
+		success         bool
+	}{
+		{
+			name:     "unsigned request that need not be signed",
+			sp:       &models.SAMLServiceProvider{},
+			rawQuery: unsigned,
+			success:  true,
+		},
+		{
+			name:            "signed request verified with the certificate",
+			sp:              &models.SAMLServiceProvider{Certificate: certificate, WantAuthnRequestsSigned: true},
+			redirectBinding: true,
+			rawQuery:        signed,
+			success:         true,
+		},
+		{
+			name:            "signature is verified even when it is not required",
+			sp:              &models.SAMLServiceProvider{Certificate: certificate},
+			redirectBinding: true,
+			rawQuery:        signTestSAMLQuery(t, otherKey),
+		},
+		{
+			name:            "signed by another key",
+			sp:              &models.SAMLServiceProvider{Certificate: certificate, WantAuthnRequestsSigned: true},
+			redirectBinding: true,
+			rawQuery:        signTestSAMLQuery(t, otherKey),
+		},
+		{
+			name:            "unsigned request that must be signed",
+			sp:              &models.SAMLServiceProvider{Certificate: certificate, WantAuthnRequestsSigned: true},
+			redirectBinding: true,
+			rawQuery:        unsigned,
+		},
+		{
+			name:     "signed requests need the redirect binding",
+			sp:       &models.SAMLServiceProvider{Certificate: certificate, WantAuthnRequestsSigned: true},
+			rawQuery: signed,
+		},
+		{
+			name:            "signed requests are required without a certificate",
+			sp:              &models.SAMLServiceProvider{WantAuthnRequestsSigned: true},
+			redirectBinding: true,
+			rawQuery:        "SAMLRequest=request&SigAlg=" + url.QueryEscape(testSAMLSigAlg) + "&Signature=anything",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, _ := checkSAMLRequestSignature(test.sp, test.redirectBinding, test.rawQuery)
+			if test.success != (len(message) == 0) {
+				t.Errorf("expected success %t, got %q", test.success, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// ListServiceAccounts returns the tenant's ServiceAccounts. Super admins can list another tenant with
+// the tenant_id query.
+func ListServiceAccounts(c *gin.Context) {
+	tenantID, ok := getAdminTenantQuery(c)
+	if !ok {
+		return
+	}
+
+	accounts, err := datastore.GetFromContext(c).GetServiceAccounts(tenantID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get service accounts", err))
+		return
+	}
+
+	response := []*models.ServiceAccountResponse{}
+	for _, account := range accounts {
+		response = append(response, newServiceAccountResponse(account, ""))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateServiceAccount saves a new ServiceAccount from the body and returns its API key
+func CreateServiceAccount(c *gin.Context) {
+	account := &models.ServiceAccount{
+		ID:          uuid.New().String(),
+		TenantID:    middleware.GetAdmin(c).TenantID,
+		DateCreated: time.Now().UTC(),
+	}
+	if !bindServiceAccount(c, account, true) {
+		return
+	}
+
+	saveServiceAccountKey(c, account, http.StatusCreated)
+}
+
+// GetServiceAccount returns the ServiceAccount defined by the id
+func GetServiceAccount(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newServiceAccountResponse(account, ""))
+}
+
+// UpdateServiceAccount replaces the name and permissions of the ServiceAccount defined by the id with the body
+func UpdateServiceAccount(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+	if !bindServiceAccount(c, account, false) {
+		return
+	}
+
+	err := datastore.GetFromContext(c).UpsertServiceAccount(account)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save service account", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, newServiceAccountResponse(account, ""))
+}
+
+// DeleteServiceAccount deletes the ServiceAccount defined by the id, which stops its API key working
+func DeleteServiceAccount(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	err := datastore.GetFromContext(c).DeleteServiceAccount(account.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete service account", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateServiceAccountKey replaces the API key of the ServiceAccount defined by the id and returns the new key.
+// The old key stops working straight away.
+func RotateServiceAccountKey(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	saveServiceAccountKey(c, account, http.StatusOK)
+}
+
+// bindServiceAccount reads the UpsertServiceAccountRequest in the body into the ServiceAccount. The
+// request is aborted and false is returned if the body is not valid or grants more than the admin has.
+func bindServiceAccount(c *gin.Context, account *models.ServiceAccount, create bool) bool {
+	form := &models.UpsertServiceAccountRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return false
+	}
+	if len(form.Name) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing name", nil))
+		return false
+	}
+	if len(form.Permissions) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing permissions", nil))
+		return false
+	}
+	if message := helpers.ValidateAdminPermissions(middleware.GetAdmin(c), form.Permissions); len(message) > 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(message, nil))
+		return false
+	}
+	if !bindAdminTenantID(c, &account.TenantID, form.TenantID, create) {
+		return false
+	}
+
+	account.Name = form.Name
+	account.Permissions = form.Permissions
+	return true
+}
+
+// saveServiceAccountKey creates a new API key for the ServiceAccount, saves it and writes the response
+// with the key and status
+func saveServiceAccountKey(c *gin.Context, account *models.ServiceAccount, status int) {
+	key, hash, err := helpers.GenerateAPIKey(account.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to generate API key", err))
+		return
+	}
+	account.KeyHash = hash
+	account.DateKeyCreated = time.Now().UTC()
+
+	err = datastore.GetFromContext(c).UpsertServiceAccount(account)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save service account", err))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(status, newServiceAccountResponse(account, key))
+}
+
+// loadServiceAccount gets the ServiceAccount defined by the id if the admin in the context may manage it.
+// Only admins with every permission of the account can change it, so its key cannot be used to gain
+// permissions. The request is aborted and false is returned if it cannot be found or changed.
+func loadServiceAccount(c *gin.Context) (*models.ServiceAccount, bool) {
+	account, err := datastore.GetFromContext(c).GetServiceAccount(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get service account", err))
+		return nil, false
+	}
+	if account == nil || !middleware.CanAdminTenant(c, account.TenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Service account not found", nil))
+		return nil, false
+	}
+	if c.Request.Method != http.MethodGet {
+		if message := helpers.ValidateAdminPermissions(middleware.GetAdmin(c), account.Permissions); len(message) > 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse(message, nil))
+			return nil, false
+		}
+	}
+
+	return account, true
+}
+
+// newServiceAccountResponse builds the response for the ServiceAccount without its key hash
+func newServiceAccountResponse(account *models.ServiceAccount, key string) *models.ServiceAccountResponse {
+	return &models.ServiceAccountResponse{
+		ID:             account.ID,
+		Name:           account.Name,
+		TenantID:       account.TenantID,
+		Permissions:    account.Permissions,
+		APIKey:         key,
+		DateCreated:    account.DateCreated,
+		DateKeyCreated: account.DateKeyCreated,
+	}
+}
@@ -0,0 +1,292 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// ListSites returns a page of the tenant's Sites, optionally only those matching the search in the query.
+// Super admins can list another tenant with the tenant_id query.
+func ListSites(c *gin.Context) {
+	tenantID, ok := getAdminTenantQuery(c)
+	if !ok {
+		return
+	}
+	offset, limit, ok := getAdminPage(c)
+	if !ok {
+		return
+	}
+
+	sites, err := datastore.GetFromContext(c).SearchSites(tenantID, c.Query("search"), offset, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get sites", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, sites)
+}
+
+// CreateSite saves a new Site from the body
+func CreateSite(c *gin.Context) {
+	site := &models.Site{
+		SiteID:   uuid.New().String(),
+		TenantID: middleware.GetAdmin(c).TenantID,
+		IsActive: true,
+	}
+	if !bindSite(c, site, true) {
+		return
+	}
+
+	err := datastore.GetFromContext(c).UpsertSite(site)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save site", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, site)
+}
+
+// GetSite returns the Site defined by the id
+func GetSite(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, site)
+}
+
+// UpdateSite replaces the Site defined by the id with the body. Every token issued for the site is
+// revoked when it is deactivated, while a maintenance window only suspends them.
+func UpdateSite(c *gin.Context) {
+	existing, ok := loadSite(c)
+	if !ok {
+		return
+	}
+
+	// the cached site is shared, so changes are made to a copy
+	site := *existing
+	if !bindSite(c, &site, false) {
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	err := store.UpsertSite(&site)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save site", err))
+		return
+	}
+
+	// the site is saved first so no new tokens are issued while the old ones are revoked
+	if existing.IsActive && !site.IsActive {
+		err = store.RevokeSiteTokens(site.SiteID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to revoke site tokens", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, &site)
+}
+
+// DeleteSite revokes every token issued for the Site defined by the id and deletes it
+func DeleteSite(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+
+	store := datastore.GetFromContext(c)
+	err := store.RevokeSiteTokens(site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to revoke site tokens", err))
+		return
+	}
+
+	err = store.DeleteSite(site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to delete site", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bindSite reads the UpsertSiteRequest in the body into the Site. The request is aborted and false is
+// returned if the body is not valid or the url or number is used by another site of the tenant.
+func bindSite(c *gin.Context, site *models.Site, create bool) bool {
+	form := &models.UpsertSiteRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return false
+	}
+	if len(form.SiteName) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing site_name", nil))
+		return false
+	}
+	if len(form.SiteURL) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing site_url", nil))
+		return false
+	}
+	// sites are looked up by id when the value is a uuid, so the url cannot be one
+	if _, err = uuid.Parse(form.SiteURL); err == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("site_url cannot be a uuid", nil))
+		return false
+	}
+	if window := form.MaintenanceWindow; window != nil && !window.End.After(window.Start) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("maintenance_window must end after it starts", nil))
+		return false
+	}
+	if !bindAdminTenantID(c, &site.TenantID, form.TenantID, create) {
+		return false
+	}
+
+	store := datastore.GetFromContext(c)
+	existing, err := store.GetSiteByURL(site.TenantID, form.SiteURL)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return false
+	}
+	if existing != nil && existing.SiteID != site.SiteID {
+		c.AbortWithStatusJSON(http.StatusConflict, helpers.PrepareErrorResponse("site_url is used by another site", nil))
+		return false
+	}
+
+	if len(form.SiteNumber) > 0 {
+		existing, err = store.GetSiteByNumber(site.TenantID, form.SiteNumber)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+			return false
+		}
+		if existing != nil && existing.SiteID != site.SiteID {
+			c.AbortWithStatusJSON(http.StatusConflict, helpers.PrepareErrorResponse("site_number is used by another site", nil))
+			return false
+		}
+	}
+
+	if len(form.DirectoryID) > 0 {
+		directory, err := store.GetDirectory(form.DirectoryID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get directory", err))
+			return false
+		}
+		if directory == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Directory not found", nil))
+			return false
+		}
+	}
+	if len(form.FederationID) > 0 {
+		federation, err := store.GetFederation(form.FederationID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get federation", err))
+			return false
+		}
+		if federation == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Federation not found", nil))
+			return false
+		}
+	}
+
+	site.SiteName = form.SiteName
+	site.SiteNumber = form.SiteNumber
+	site.SiteURL = form.SiteURL
+	site.DirectoryID = form.DirectoryID
+	site.FederationID = form.FederationID
+	site.Attributes = form.Attributes
+	site.MaintenanceWindow = form.MaintenanceWindow
+	if form.IsActive != nil {
+		site.IsActive = *form.IsActive
+	}
+	return true
+}
+
+// loadSite gets the Site defined by the id if the admin in the context may manage it. The request is
+// aborted and false is returned if it cannot be found.
+func loadSite(c *gin.Context) (*models.Site, bool) {
+	site, err := datastore.GetFromContext(c).GetSite(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return nil, false
+	}
+	if site == nil || !middleware.CanAdminTenant(c, site.TenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Site not found", nil))
+		return nil, false
+	}
+
+	return site, true
+}
+
+// validateSites checks every id in the list is a site of the tenant. The request is aborted and false
+// is returned if one is not.
+func validateSites(c *gin.Context, tenantID string, siteIDs []string) bool {
+	sites, err := getSites(c, tenantID, siteIDs)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get list of sites", err))
+		return false
+	}
+	for _, siteID := range siteIDs {
+		found := false
+		for _, site := range sites {
+			found = found || site.SiteID == siteID
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse(fmt.Sprintf("Site not found (%s)", siteID), nil))
+			return false
+		}
+	}
+
+	return true
+}
+
+// getApplicationSites returns the ids of the sites the application may issue tokens for, from the
+// application or else the settings of its tenant. Nil is returned when every site is allowed.
+func getApplicationSites(c context.Context, app *models.Application) ([]string, error) {
+	if len(app.AllowedSites) > 0 || app.RestrictSites {
+		return append([]string{}, app.AllowedSites...), nil
+	}
+
+	settings, err := getTenantSettings(c, app.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if settings != nil && len(settings.AllowedSites) > 0 {
+		return settings.AllowedSites, nil
+	}
+	return nil, nil
+}
+
+// isApplicationSite returns true if the application may issue tokens for the site
+func isApplicationSite(c context.Context, app *models.Application, siteID string) (bool, error) {
+	allowed, err := getApplicationSites(c, app)
+	if err != nil {
+		return false, err
+	}
+
+	return allowed == nil || helpers.HasScope(allowed, siteID), nil
+}
+
+// filterApplicationSites returns the site ids in the list that the application may issue tokens for
+func filterApplicationSites(c context.Context, app *models.Application, siteIDs []string) ([]string, error) {
+	allowed, err := getApplicationSites(c, app)
+	if err != nil || allowed == nil {
+		return siteIDs, err
+	}
+
+	result := []string{}
+	for _, siteID := range siteIDs {
+		if helpers.HasScope(allowed, siteID) {
+			result = append(result, siteID)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pemiller/authentication/models"
+)
+
+func TestFilterApplicationSites(t *testing.T) {
+	siteIDs := []string{"site-1", "site-2"}
+
+	tests := []struct {
+		name     string
+		app      *models.Application
+		expected []string
+	}{
+		{
+			name:     "allowed sites",
+			app:      &models.Application{AllowedSites: []string{"site-2", "site-3"}},
+			expected: []string{"site-2"},
+		},
+		{
+			name:     "restricted without sites",
+			app:      &models.Application{RestrictSites: true},
+			expected: []string{},
+		},
+		{
+			name:     "restricted to allowed sites",
+			app:      &models.Application{AllowedSites: []string{"site-1"}, RestrictSites: true},
+			expected: []string{"site-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sites, err := filterApplicationSites(context.Background(), test.app, siteIDs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(sites, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, sites)
+			}
+
+			allowed, err := isApplicationSite(context.Background(), test.app, "site-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != (len(test.expected) > 0 && test.expected[0] == "site-1") {
+				t.Errorf("unexpected isApplicationSite %t for site-1", allowed)
+			}
+		})
+	}
+}
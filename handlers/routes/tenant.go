@@ -0,0 +1,271 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// CreateTenant saves a new Tenant from the body
+func CreateTenant(c *gin.Context) {
+	tenant := &models.Tenant{
+		ID:          uuid.New().String(),
+		DateCreated: time.Now().UTC(),
+	}
+	if !bindTenant(c, tenant) {
+		return
+	}
+
+	err := datastore.GetFromContext(c).UpsertTenant(tenant)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save tenant", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, tenant)
+}
+
+// GetTenant returns the Tenant defined by the id
+func GetTenant(c *gin.Context) {
+	tenant, ok := loadTenant(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// UpdateTenant replaces the name and settings of the Tenant defined by the id with the body
+func UpdateTenant(c *gin.Context) {
+	existing, ok := loadTenant(c)
+	if !ok {
+		return
+	}
+
+	// the cached tenant is shared, so changes are made to a copy
+	tenant := *existing
+	if !bindTenant(c, &tenant) {
+		return
+	}
+
+	err := datastore.GetFromContext(c).UpsertTenant(&tenant)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save tenant", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, &tenant)
+}
+
+// bindTenant reads the UpsertTenantRequest in the body into the Tenant. The request is aborted and
+// false is returned if the body is not valid.
+func bindTenant(c *gin.Context, tenant *models.Tenant) bool {
+	form := &models.UpsertTenantRequest{}
+	err := c.BindJSON(form)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+		return false
+	}
+	if len(form.Name) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Request body is missing name", nil))
+		return false
+	}
+	if settings := form.Settings; settings != nil {
+		if settings.AccessTokenTTL < 0 || settings.RefreshTokenTTL < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Token lifetimes cannot be negative", nil))
+			return false
+		}
+		if settings.PasswordPolicy != nil && settings.PasswordPolicy.MinLength < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Password min_length cannot be negative", nil))
+			return false
+		}
+		if !validateSites(c, tenant.ID, settings.AllowedSites) {
+			return false
+		}
+	}
+
+	tenant.Name = form.Name
+	tenant.Settings = form.Settings
+	return true
+}
+
+// loadTenant gets the Tenant defined by the id if the admin in the context may manage it. The
+// request is aborted and false is returned if it cannot be found.
+func loadTenant(c *gin.Context) (*models.Tenant, bool) {
+	id := c.Param("id")
+	if !middleware.CanAdminTenant(c, id) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Tenant not found", nil))
+		return nil, false
+	}
+
+	tenant, err := datastore.GetFromContext(c).GetTenant(id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+		return nil, false
+	}
+	if tenant == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Tenant not found", nil))
+		return nil, false
+	}
+
+	return tenant, true
+}
+
+// bindAdminTenantID sets the tenant of a group, site or application being saved by an administrator.
+// Only a super admin creating one may choose the tenant, otherwise it must be left empty or unchanged.
+// The request is aborted and false is returned if the tenant cannot be set.
+func bindAdminTenantID(c *gin.Context, current *string, tenantID string, create bool) bool {
+	if len(tenantID) == 0 || tenantID == *current {
+		return true
+	}
+	if !create || !middleware.GetAdmin(c).IsSuperAdmin() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Cannot set the tenant", nil))
+		return false
+	}
+
+	tenant, err := datastore.GetFromContext(c).GetTenant(tenantID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get tenant", err))
+		return false
+	}
+	if tenant == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Tenant not found", nil))
+		return false
+	}
+
+	*current = tenant.ID
+	return true
+}
+
+// getAdminTenantQuery returns the tenant in the tenant_id query, or the administrator's tenant when it
+// is not set. The request is aborted and false is returned if the administrator cannot manage it.
+func getAdminTenantQuery(c *gin.Context) (string, bool) {
+	tenantID, ok := c.GetQuery("tenant_id")
+	if !ok {
+		return middleware.GetAdmin(c).TenantID, true
+	}
+	if !middleware.CanAdminTenant(c, tenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("Tenant not found", nil))
+		return "", false
+	}
+
+	return tenantID, true
+}
+
+// getTenantID returns the tenant of the application in the context, which is empty for applications
+// that do not belong to a tenant
+func getTenantID(c *gin.Context) string {
+	app := middleware.GetApplication(c)
+	if app == nil {
+		return ""
+	}
+	return app.TenantID
+}
+
+// getTenantSettings returns the settings of the tenant, or nil if it has none
+func getTenantSettings(c context.Context, tenantID string) (*models.TenantSettings, error) {
+	if len(tenantID) == 0 {
+		return nil, nil
+	}
+
+	tenant, err := datastore.GetFromContext(c).GetTenant(tenantID)
+	if err != nil || tenant == nil {
+		return nil, err
+	}
+	return tenant.Settings, nil
+}
+
+// getAccessTokenTTL returns how long access tokens issued for the tenant are valid for
+func getAccessTokenTTL(c context.Context, tenantID string) (time.Duration, error) {
+	settings, err := getTenantSettings(c, tenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	ttl := time.Duration(datastore.GetFromContext(c).GetAccessTokenExpiration()) * time.Second
+	if settings != nil {
+		ttl = shortenTTL(ttl, settings.AccessTokenTTL)
+	}
+	return ttl, nil
+}
+
+// getRefreshTokenTTL returns how long refresh tokens issued for the tenant are valid for
+func getRefreshTokenTTL(c context.Context, tenantID string) (time.Duration, error) {
+	settings, err := getTenantSettings(c, tenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	ttl := config.RefreshTokenTTL
+	if settings != nil {
+		ttl = shortenTTL(ttl, settings.RefreshTokenTTL)
+	}
+	return ttl, nil
+}
+
+// shortenTTL returns the tenant's lifetime in seconds if it is set and shorter than the deployment's.
+// Tokens are stored with the deployment's lifetime, so a tenant cannot extend it.
+func shortenTTL(ttl time.Duration, seconds int) time.Duration {
+	if d := time.Duration(seconds) * time.Second; d > 0 && d < ttl {
+		return d
+	}
+	return ttl
+}
+
+// getExpiresIn returns the number of seconds until the expiry, for the expires_in of token responses
+func getExpiresIn(expires time.Time) int64 {
+	return int64(expires.Sub(time.Now().UTC()).Round(time.Second).Seconds())
+}
+
+// getRefreshTokenExpiry returns when the RefreshToken expires under the settings of its application's tenant
+func getRefreshTokenExpiry(c context.Context, refreshToken *models.RefreshToken) (time.Time, error) {
+	app, err := datastore.GetFromContext(c).GetApplication(refreshToken.ApplicationID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tenantID := ""
+	if app != nil {
+		tenantID = app.TenantID
+	}
+	ttl, err := getRefreshTokenTTL(c, tenantID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return refreshToken.DateCreated.Add(ttl), nil
+}
+
+// loadAdminUser gets the user defined by the id if the admin in the context may manage their tenant.
+// The request is aborted and false is returned if the user cannot be found.
+func loadAdminUser(c *gin.Context, id string) (*models.User, bool) {
+	user, err := datastore.GetFromContext(c).GetUser(id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user", err))
+		return nil, false
+	}
+	if user == nil || !middleware.CanAdminTenant(c, user.TenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, helpers.PrepareErrorResponse("User not found", nil))
+		return nil, false
+	}
+
+	return user, true
+}
+
+// isTenantApplication returns true if the application defined by the id belongs to the tenant of the
+// application in the context. Tokens of other tenants are treated as unknown.
+func isTenantApplication(c *gin.Context, applicationID string) (bool, error) {
+	app, err := datastore.GetFromContext(c).GetApplication(applicationID)
+	if err != nil || app == nil {
+		return false, err
+	}
+	return app.TenantID == getTenantID(c), nil
+}
@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
+)
+
+// createTokenExchangeToken exchanges the subject token for a new access token for the audience, restricted
+// to a site and scopes the subject token already has (RFC 8693). The new token records who is acting
+// for the subject in its act claim and it cannot be refreshed.
+func createTokenExchangeToken(c *gin.Context, form *models.TokenRequest) {
+	if middleware.GetClientAuthMethod(c) == models.ClientAuthMethodNone {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorUnauthorizedClient, "Public clients cannot exchange tokens"))
+		return
+	}
+	if len(form.SubjectToken) == 0 || form.SubjectTokenType != models.TokenTypeAccessToken {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Missing subject_token or unsupported subject_token_type"))
+		return
+	}
+	if len(form.RequestedTokenType) > 0 && form.RequestedTokenType != models.TokenTypeAccessToken {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Unsupported requested_token_type"))
+		return
+	}
+
+	client := middleware.GetApplication(c)
+	subject, authCode, err := getAccessTokenAndAuthCode(c, form.SubjectToken)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get subject_token"))
+		return
+	}
+	if subject == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Invalid subject_token"))
+		return
+	}
+
+	actor, ok := getTokenExchangeActor(c, form, client)
+	if !ok {
+		return
+	}
+	actor.Actor = subject.Actor
+
+	audienceID := form.Audience
+	if len(audienceID) == 0 {
+		audienceID = client.ID
+	}
+	if !helpers.HasScope(client.TokenExchangeAudiences, audienceID) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidTarget, "Client may not exchange tokens for the audience"))
+		return
+	}
+	audience, err := datastore.GetFromContext(c).GetApplication(audienceID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get audience"))
+		return
+	}
+	if audience == nil || audience.TenantID != client.TenantID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidTarget, "Audience not found"))
+		return
+	}
+
+	site, ok := getTokenExchangeSite(c, form, audience, subject, authCode)
+	if !ok {
+		return
+	}
+
+	// the new token can only narrow the scopes of the subject token
+	scopes, ok := helpers.NarrowScopes(helpers.GetAccessTokenScopes(subject, authCode), helpers.ParseScope(form.Scope))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidScope, "Scope exceeds the subject_token"))
+		return
+	}
+
+	// roles belong to the audience, so they are looked up again rather than copied from the subject token
+	var roles []string
+	if subject.Type != models.AccessTokenTypeApplication {
+		roles, err = getUserRoles(c, subject.UserID, audience.ID, site.SiteID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get roles"))
+			return
+		}
+	}
+
+	ttl, err := getAccessTokenTTL(c, audience.TenantID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get tenant"))
+		return
+	}
+
+	// the new token never outlives the subject token
+	now := time.Now().UTC()
+	expires := now.Add(ttl)
+	if !subject.DateExpires.IsZero() && subject.DateExpires.Before(expires) {
+		expires = subject.DateExpires
+	}
+
+	accessToken := &models.AccessToken{
+		Token:          helpers.GenerateAccessToken(authCode.Code),
+		Type:           subject.Type,
+		ApplicationID:  audience.ID,
+		UserID:         subject.UserID,
+		AuthCode:       subject.AuthCode,
+		SiteID:         site.SiteID,
+		Scopes:         scopes,
+		Roles:          roles,
+		Actor:          actor,
+		ImpersonatorID: subject.ImpersonatorID,
+		DateCreated:    now,
+		DateExpires:    expires,
+	}
+
+	err = saveAccessToken(c, audience, accessToken, authCode)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to create AccessToken"))
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken:     accessToken.Token,
+		TokenType:       models.TokenTypeBearer,
+		ExpiresIn:       int64(expires.Sub(now).Seconds()),
+		SiteID:          site.SiteID,
+		IssuedTokenType: models.TokenTypeAccessToken,
+		Scope:           helpers.FormatScope(scopes),
+	})
+}
+
+// getTokenExchangeActor returns the actor from the actor token or, when there is none, the client.
+// The request is aborted and false is returned if the actor token is invalid.
+func getTokenExchangeActor(c *gin.Context, form *models.TokenRequest, client *models.Application) (*models.Actor, bool) {
+	if len(form.ActorToken) == 0 {
+		return &models.Actor{Subject: client.ID, ClientID: client.ID}, true
+	}
+
+	if form.ActorTokenType != models.TokenTypeAccessToken {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidRequest, "Unsupported actor_token_type"))
+		return nil, false
+	}
+
+	actorToken, actorAuthCode, err := getAccessTokenAndAuthCode(c, form.ActorToken)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get actor_token"))
+		return nil, false
+	}
+	if actorToken == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidGrant, "Invalid actor_token"))
+		return nil, false
+	}
+
+	actor := &models.Actor{Subject: actorAuthCode.UserID, ClientID: actorToken.ApplicationID}
+	if actorToken.Type == models.AccessTokenTypeApplication {
+		actor.Subject = actorToken.ApplicationID
+	}
+	return actor, true
+}
+
+// getTokenExchangeSite returns the requested site, or the site of the subject token. A user token can
+// be exchanged for any site the user belongs to and an application token only for its own site, and
+// the audience must be allowed to issue tokens for it. The request is aborted and false is returned if
+// the site is not allowed.
+func getTokenExchangeSite(c *gin.Context, form *models.TokenRequest, audience *models.Application, subject *models.AccessToken, authCode *models.AuthCode) (*models.Site, bool) {
+	siteID := form.Site
+	if len(siteID) == 0 {
+		siteID = subject.SiteID
+	}
+
+	site, err := getSite(c, siteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get site"))
+		return nil, false
+	}
+	if site == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidTarget, "Site not found"))
+		return nil, false
+	}
+	if !site.IsAvailable() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorAccessDenied, helpers.SiteUnavailableMessage))
+		return nil, false
+	}
+
+	allowed := site.SiteID == subject.SiteID
+	if !allowed && subject.Type != models.AccessTokenTypeApplication {
+		allowed, err = hasSiteAccess(c, authCode.UserID, site.SiteID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get list of sites"))
+			return nil, false
+		}
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidTarget, "Subject may not access the site"))
+		return nil, false
+	}
+
+	allowed, err = isApplicationSite(c, audience, site.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Unable to get tenant"))
+		return nil, false
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidTarget, helpers.SiteNotAllowedMessage))
+		return nil, false
+	}
+
+	return site, true
+}
@@ -0,0 +1,105 @@
+package helpers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+// CreateAccessTokenJWT signs the AccessToken as a JWT using the application's signing algorithm
+func CreateAccessTokenJWT(c *gin.Context, app *models.Application, accessToken *models.AccessToken, authCode *models.AuthCode) (string, error) {
+	algorithm := app.AccessTokenSigningAlgorithm
+	if len(algorithm) == 0 {
+		algorithm = AlgorithmRS256
+	}
+
+	key, err := GetActiveSigningKey(c, algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &models.AccessTokenClaims{
+		Issuer:         GetIssuer(c.Request),
+		Subject:        accessToken.UserID,
+		Audience:       app.ID,
+		Expires:        accessToken.DateExpires.Unix(),
+		IssuedAt:       accessToken.DateCreated.Unix(),
+		JWTID:          accessToken.JWTID,
+		ClientID:       app.ID,
+		Type:           accessToken.Type,
+		Email:          authCode.Email,
+		SiteID:         accessToken.SiteID,
+		AuthType:       authCode.AuthType,
+		FamilyID:       accessToken.FamilyID,
+		Scope:          FormatScope(GetAccessTokenScopes(accessToken, authCode)),
+		Roles:          accessToken.Roles,
+		Actor:          accessToken.Actor,
+		ImpersonatorID: accessToken.ImpersonatorID,
+	}
+	if accessToken.Type == models.AccessTokenTypeApplication {
+		claims.Subject = app.ID
+	}
+
+	return SignJWT(key, claims)
+}
+
+// ParseAccessTokenJWT verifies a JWT access token against the cached signing keys and rebuilds the
+// AccessToken and AuthCode from its claims. Nil is returned if the token is invalid, expired or has
+// been revoked.
+func ParseAccessTokenJWT(c context.Context, token string) (*models.AccessToken, *models.AuthCode, error) {
+	set, err := GetPublishedJWKS(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims := &models.AccessTokenClaims{}
+	err = VerifyJWT(token, set.Keys, claims)
+	if err != nil || len(claims.JWTID) == 0 {
+		return nil, nil, nil
+	}
+
+	expires := time.Unix(claims.Expires, 0).UTC()
+	if expires.Before(time.Now().UTC()) {
+		return nil, nil, nil
+	}
+
+	// the claims are trusted once the signature is verified, so the only other check is against the
+	// in-memory revocation list, which also covers deleted applications and deactivated sites
+	issued := time.Unix(claims.IssuedAt, 0).UTC()
+	if datastore.GetFromContext(c).IsJWTRevoked(claims.JWTID, claims.ClientID, claims.SiteID, issued) {
+		return nil, nil, nil
+	}
+
+	accessToken := &models.AccessToken{
+		Token:          token,
+		JWTID:          claims.JWTID,
+		Type:           claims.Type,
+		ApplicationID:  claims.ClientID,
+		SiteID:         claims.SiteID,
+		FamilyID:       claims.FamilyID,
+		Scopes:         ParseScope(claims.Scope),
+		Roles:          claims.Roles,
+		Actor:          claims.Actor,
+		ImpersonatorID: claims.ImpersonatorID,
+		DateCreated:    issued,
+		DateExpires:    expires,
+	}
+
+	authCode := &models.AuthCode{
+		Email:         claims.Email,
+		ApplicationID: claims.ClientID,
+		AuthType:      claims.AuthType,
+		Scopes:        ParseScope(claims.Scope),
+	}
+
+	if claims.Type != models.AccessTokenTypeApplication {
+		accessToken.UserID = claims.Subject
+		authCode.UserID = claims.Subject
+	}
+
+	return accessToken, authCode, nil
+}
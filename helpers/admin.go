@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// GenerateAPIKey creates an admin API key for the service account and the hash that is stored. The key
+// starts with the account id so the account can be found without searching.
+func GenerateAPIKey(accountID string) (string, string, error) {
+	secret, err := GenerateClientSecret()
+	if err != nil {
+		return "", "", err
+	}
+	return accountID + "." + secret, HashClientSecret(secret), nil
+}
+
+// ParseAPIKey returns the service account id and secret of an admin API key
+func ParseAPIKey(key string) (string, string) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// TestAPIKey returns true if the secret matches the key of the service account
+func TestAPIKey(account *models.ServiceAccount, secret string) bool {
+	if account == nil || len(account.KeyHash) == 0 || len(secret) == 0 {
+		return false
+	}
+
+	hash := []byte(HashClientSecret(secret))
+	return subtle.ConstantTimeCompare(hash, []byte(account.KeyHash)) == 1
+}
+
+// ValidateAdminPermissions checks the permissions can be granted by the principal, who cannot grant
+// permissions they do not have. A description of the problem is returned when they cannot.
+func ValidateAdminPermissions(principal *models.AdminPrincipal, permissions []string) string {
+	for _, permission := range permissions {
+		if !HasScope(models.AdminPermissions, permission) {
+			return fmt.Sprintf("Unknown permission (%s)", permission)
+		}
+		if permission == models.PermissionWildcard && !HasScope(principal.Permissions, models.PermissionWildcard) {
+			return "Cannot grant every permission"
+		}
+		if !principal.HasPermission(permission) {
+			return fmt.Sprintf("Cannot grant a permission you do not have (%s)", permission)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// applicationAuthMethods are the token endpoint authentication methods an administrator can set.
+// An empty method keeps the original behaviour of trusting the X-Application header.
+var applicationAuthMethods = []string{
+	"",
+	models.ClientAuthMethodSecretBasic,
+	models.ClientAuthMethodSecretPost,
+	models.ClientAuthMethodNone,
+	models.ClientAuthMethodTLS,
+	models.ClientAuthMethodSelfSignedTLS,
+	models.ClientAuthMethodPrivateKeyJWT,
+}
+
+// ValidateApplication checks the settings of an Application saved through the admin API. A
+// description of the problem is returned when it is not valid.
+func ValidateApplication(app *models.Application) string {
+	if len(app.Name) == 0 {
+		return "Missing name"
+	}
+
+	switch app.AccessTokenFormat {
+	case "", models.AccessTokenFormatOpaque, models.AccessTokenFormatJWT:
+	default:
+		return fmt.Sprintf("Unsupported access_token_format (%s)", app.AccessTokenFormat)
+	}
+	if len(app.AccessTokenSigningAlgorithm) > 0 && !HasScope(SigningAlgorithms, app.AccessTokenSigningAlgorithm) {
+		return fmt.Sprintf("Unsupported access_token_signing_algorithm (%s)", app.AccessTokenSigningAlgorithm)
+	}
+
+	if !HasScope(applicationAuthMethods, app.TokenEndpointAuthMethod) {
+		return fmt.Sprintf("Unsupported token_endpoint_auth_method (%s)", app.TokenEndpointAuthMethod)
+	}
+	if app.TokenEndpointAuthMethod == models.ClientAuthMethodPrivateKeyJWT && (app.JWKS == nil || len(app.JWKS.Keys) == 0) {
+		return "private_key_jwt requires jwks"
+	}
+	if app.TokenEndpointAuthMethod == models.ClientAuthMethodTLS && len(app.TLSClientAuthSubjectDN) == 0 {
+		return "tls_client_auth requires tls_client_auth_subject_dn"
+	}
+	if app.TokenEndpointAuthMethod == models.ClientAuthMethodSelfSignedTLS && len(app.TLSClientCertificateThumbprints) == 0 {
+		return "self_signed_tls_client_auth requires tls_client_certificate_thumbprints"
+	}
+
+	for _, uri := range app.RedirectURIs {
+		if !isValidRedirectURI(uri) {
+			return fmt.Sprintf("Invalid redirect_uri (%s)", uri)
+		}
+	}
+
+	if app.SAML != nil {
+		if len(app.SAML.EntityID) == 0 {
+			return "Missing saml entity_id"
+		}
+		if len(app.SAML.ACSURLs) == 0 {
+			return "Missing saml acs_urls"
+		}
+		if app.SAML.WantAuthnRequestsSigned && len(app.SAML.Certificate) == 0 {
+			return "saml want_authn_requests_signed requires a certificate"
+		}
+	}
+
+	names := []string{}
+	for _, role := range app.Roles {
+		if role == nil || len(role.Name) == 0 {
+			return "Missing role name"
+		}
+		if HasScope(names, role.Name) {
+			return fmt.Sprintf("Duplicate role (%s)", role.Name)
+		}
+		names = append(names, role.Name)
+	}
+
+	return ""
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/pemiller/authentication/models"
+)
+
+func TestValidateApplicationSAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		saml     *models.SAMLServiceProvider
+		expected string
+	}{
+		{
+			name: "unsigned requests",
+			saml: &models.SAMLServiceProvider{EntityID: "sp", ACSURLs: []string{"https://sp.example.com/acs"}},
+		},
+		{
+			name: "signed requests with a certificate",
+			saml: &models.SAMLServiceProvider{
+				EntityID:                "sp",
+				ACSURLs:                 []string{"https://sp.example.com/acs"},
+				Certificate:             "-----BEGIN CERTIFICATE-----",
+				WantAuthnRequestsSigned: true,
+			},
+		},
+		{
+			name:     "signed requests without a certificate",
+			saml:     &models.SAMLServiceProvider{EntityID: "sp", ACSURLs: []string{"https://sp.example.com/acs"}, WantAuthnRequestsSigned: true},
+			expected: "saml want_authn_requests_signed requires a certificate",
+		},
+		{
+			name:     "missing entity id",
+			saml:     &models.SAMLServiceProvider{ACSURLs: []string{"https://sp.example.com/acs"}},
+			expected: "Missing saml entity_id",
+		},
+		{
+			name:     "missing acs urls",
+			saml:     &models.SAMLServiceProvider{EntityID: "sp"},
+			expected: "Missing saml acs_urls",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := ValidateApplication(&models.Application{Name: "application", SAML: test.saml})
+			if message != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, message)
+			}
+		})
+	}
+}
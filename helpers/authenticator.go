@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+// Authenticator checks the password of a user
+type Authenticator interface {
+	// Authenticate returns what is known about the user, or nil if the password does not match
+	Authenticate(email, password string) (*models.DirectoryIdentity, error)
+}
+
+// passwordAuthenticator checks passwords against the hash stored in User.Password
+type passwordAuthenticator struct {
+	user *models.User
+}
+
+func (a *passwordAuthenticator) Authenticate(email, password string) (*models.DirectoryIdentity, error) {
+	if len(a.user.Password) == 0 {
+		return nil, nil
+	}
+
+	match, err := comparePasswordToHash(a.user.Password, password)
+	if err != nil || !match {
+		return nil, err
+	}
+
+	return &models.DirectoryIdentity{
+		Email:      a.user.Email,
+		Name:       a.user.Name,
+		GivenName:  a.user.GivenName,
+		FamilyName: a.user.FamilyName,
+		Sites:      a.user.SiteRefs,
+	}, nil
+}
+
+// GetAuthenticator returns the Authenticator for a login to the tenant and the Directory it uses, if
+// any. Users that were provisioned by a directory keep using it, and users without one use their
+// stored password. The directory of the site or of the email domain is only used to provision new
+// users. Nil is returned when there is no user and no directory.
+func GetAuthenticator(c context.Context, user *models.User, tenantID, email string, site *models.Site) (Authenticator, *models.Directory, error) {
+	directory, err := getDirectory(c, user, tenantID, email, site)
+	if err != nil {
+		return nil, nil, err
+	}
+	if directory != nil {
+		return &LDAPAuthenticator{Directory: directory}, directory, nil
+	}
+	if user == nil {
+		return nil, nil, nil
+	}
+
+	return &passwordAuthenticator{user: user}, nil, nil
+}
+
+// getDirectory returns the Directory the login is checked against. Directories of other tenants are
+// never used.
+func getDirectory(c context.Context, user *models.User, tenantID, email string, site *models.Site) (*models.Directory, error) {
+	store := datastore.GetFromContext(c)
+
+	var directory *models.Directory
+	var err error
+	switch {
+	case user != nil && len(user.DirectoryID) > 0:
+		directory, err = store.GetDirectory(user.DirectoryID)
+	case user != nil:
+		// a site or domain directory cannot take over a user who signs in with a password
+		return nil, nil
+	case site != nil && len(site.DirectoryID) > 0:
+		directory, err = store.GetDirectory(site.DirectoryID)
+	default:
+		at := strings.LastIndex(email, "@")
+		if at < 0 {
+			return nil, nil
+		}
+		directory, err = store.GetDirectoryByEmailDomain(tenantID, email[at+1:])
+	}
+
+	if err != nil || directory == nil || directory.TenantID != tenantID {
+		return nil, err
+	}
+	return directory, nil
+}
@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb"
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+func TestPasswordAuthenticator(t *testing.T) {
+	hash, err := CryptPassword("jane-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{
+		Email:      "jane@example.com",
+		Password:   hash,
+		Name:       "Jane Doe",
+		GivenName:  "Jane",
+		FamilyName: "Doe",
+		SiteRefs:   []string{"site-1"},
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		stored   string
+		success  bool
+	}{
+		{"correct password", "jane-password", hash, true},
+		{"wrong password", "wrong-password", hash, false},
+		{"user without a password", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user.Password = test.stored
+			authenticator := &passwordAuthenticator{user: user}
+
+			identity, err := authenticator.Authenticate(user.Email, test.password)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.success != (identity != nil) {
+				t.Fatalf("expected success %t, got identity %+v", test.success, identity)
+			}
+			if identity == nil {
+				return
+			}
+
+			expected := &models.DirectoryIdentity{
+				Email:      "jane@example.com",
+				Name:       "Jane Doe",
+				GivenName:  "Jane",
+				FamilyName: "Doe",
+				Sites:      []string{"site-1"},
+			}
+			if !reflect.DeepEqual(identity, expected) {
+				t.Errorf("expected %+v, got %+v", expected, identity)
+			}
+		})
+	}
+}
+
+// testBucket serves the documents of a test Store from memory. Methods the tests do not use are left to
+// the embedded interface and panic.
+type testBucket struct {
+	datastore.Bucket
+	documents map[string]interface{}
+}
+
+func (b *testBucket) Get(key string, valuePtr interface{}) (gocb.Cas, error) {
+	value, found := b.documents[key]
+	if !found {
+		return 0, gocb.ErrKeyNotFound
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return 1, json.Unmarshal(data, valuePtr)
+}
+
+// newTestStoreContext returns a context with a Store that holds the directories
+func newTestStoreContext(directories ...*models.Directory) context.Context {
+	bucket := &testBucket{documents: map[string]interface{}{}}
+	store := datastore.NewStoreWithBucket(cache.New(time.Minute, time.Minute), bucket, "test")
+	for _, directory := range directories {
+		bucket.documents[store.GetDirectoryKey(directory.ID)] = directory
+	}
+
+	return context.WithValue(context.Background(), datastore.ContextKey, store)
+}
+
+func TestGetAuthenticator(t *testing.T) {
+	c := newTestStoreContext(
+		&models.Directory{ID: "directory", TenantID: "tenant"},
+		&models.Directory{ID: "other-directory", TenantID: "other-tenant"},
+	)
+	site := &models.Site{SiteID: "site", TenantID: "tenant", DirectoryID: "directory"}
+	otherSite := &models.Site{SiteID: "other-site", TenantID: "tenant", DirectoryID: "other-directory"}
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		email     string
+		site      *models.Site
+		directory string
+		password  bool
+	}{
+		{
+			name:     "user without a directory",
+			user:     &models.User{Email: "jane", TenantID: "tenant"},
+			email:    "jane",
+			password: true,
+		},
+		{
+			name:     "site directory does not take over a password user",
+			user:     &models.User{Email: "jane@example.com", TenantID: "tenant", IsAdmin: true},
+			email:    "jane@example.com",
+			site:     site,
+			password: true,
+		},
+		{
+			name:      "user provisioned by a directory",
+			user:      &models.User{Email: "jane@example.com", TenantID: "tenant", DirectoryID: "directory"},
+			email:     "jane@example.com",
+			directory: "directory",
+		},
+		{
+			name:     "user linked to the directory of another tenant",
+			user:     &models.User{Email: "jane@example.com", TenantID: "tenant", DirectoryID: "other-directory"},
+			email:    "jane@example.com",
+			password: true,
+		},
+		{
+			name:      "new user of a directory site",
+			email:     "jane",
+			site:      site,
+			directory: "directory",
+		},
+		{
+			name:  "site using the directory of another tenant",
+			email: "jane",
+			site:  otherSite,
+		},
+		{
+			name:  "no user and no directory",
+			email: "jane",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, directory, err := GetAuthenticator(c, test.user, "tenant", test.email, test.site)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(test.directory) > 0 {
+				ldap, ok := authenticator.(*LDAPAuthenticator)
+				if !ok || directory == nil || directory.ID != test.directory || ldap.Directory.ID != test.directory {
+					t.Errorf("expected directory %s, got %T with %+v", test.directory, authenticator, directory)
+				}
+				return
+			}
+			if directory != nil {
+				t.Errorf("expected no directory, got %+v", directory)
+			}
+			if _, ok := authenticator.(*passwordAuthenticator); ok != test.password {
+				t.Errorf("expected the password authenticator %t, got %T", test.password, authenticator)
+			}
+			if !test.password && authenticator != nil {
+				t.Errorf("expected no authenticator, got %T", authenticator)
+			}
+		})
+	}
+}
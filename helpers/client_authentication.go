@@ -0,0 +1,143 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+// maxClientAssertionLifetime limits how far in the future a client assertion may expire, so the
+// replay cache does not have to keep its jti for long
+const maxClientAssertionLifetime = 10 * time.Minute
+
+// clientAssertionClaims are the claims required in a private_key_jwt assertion (RFC 7523 section 3)
+type clientAssertionClaims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	Expires  int64    `json:"exp"`
+	JWTID    string   `json:"jti"`
+}
+
+// VerifyClientCertificate checks that the TLS client certificate of the request is bound to the application.
+// tls_client_auth requires a certificate issued by a trusted CA with the registered subject, and
+// self_signed_tls_client_auth requires one of the registered certificate thumbprints.
+func VerifyClientCertificate(r *http.Request, app *models.Application) error {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return errors.New("no client certificate")
+	}
+	cert := r.TLS.PeerCertificates[0]
+
+	switch app.TokenEndpointAuthMethod {
+	case models.ClientAuthMethodTLS:
+		if config.TLSClientCAs == nil {
+			return errors.New("no client CAs are configured")
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, c := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         config.TLSClientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(app.TLSClientAuthSubjectDN) == 0 || cert.Subject.String() != app.TLSClientAuthSubjectDN {
+			return errors.New("client certificate subject does not match")
+		}
+		return nil
+	case models.ClientAuthMethodSelfSignedTLS:
+		thumbprint := sha256.Sum256(cert.Raw)
+		encoded := base64URLEncode(thumbprint[:])
+		for _, registered := range app.TLSClientCertificateThumbprints {
+			if registered == encoded {
+				return nil
+			}
+		}
+		return errors.New("client certificate thumbprint does not match")
+	default:
+		return errors.New("application does not use certificate authentication")
+	}
+}
+
+// VerifyClientAssertion checks a private_key_jwt assertion against the keys registered for the
+// application. The audience must be one of the audiences, and each assertion can only be used once.
+func VerifyClientAssertion(c context.Context, app *models.Application, assertion string, audiences []string) error {
+	if app.JWKS == nil {
+		return errors.New("application has no registered keys")
+	}
+
+	claims := &clientAssertionClaims{}
+	err := VerifyJWT(assertion, app.JWKS.Keys, claims)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	expires := time.Unix(claims.Expires, 0)
+	switch {
+	case claims.Issuer != app.ID || claims.Subject != app.ID:
+		return errors.New("assertion iss and sub must be the application id")
+	case !now.Before(expires):
+		return errors.New("assertion has expired")
+	case expires.Sub(now) > maxClientAssertionLifetime:
+		return errors.New("assertion expires too far in the future")
+	case len(claims.JWTID) == 0:
+		return errors.New("assertion is missing jti")
+	}
+
+	hasAudience := false
+	for _, aud := range audiences {
+		if claims.Audience.contains(aud) {
+			hasAudience = true
+			break
+		}
+	}
+	if !hasAudience {
+		return errors.New("assertion audience does not match")
+	}
+
+	ok, err := datastore.GetFromContext(c).UseClientAssertion(app.ID, claims.JWTID, expires)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("assertion has already been used")
+	}
+
+	return nil
+}
+
+// GetClientAssertionIssuer returns the unverified iss claim of an assertion, which names the
+// client when the request does not include a client_id
+func GetClientAssertionIssuer(assertion string) string {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64URLDecode(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	claims := &clientAssertionClaims{}
+	if json.Unmarshal(payload, claims) != nil {
+		return ""
+	}
+	return claims.Issuer
+}
@@ -0,0 +1,140 @@
+package helpers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// registrationGrantTypes are the grant types a client can register for
+var registrationGrantTypes = []string{
+	models.GrantTypeAuthorizationCode,
+	models.GrantTypeRefreshToken,
+	models.GrantTypeClientCredentials,
+	models.GrantTypeDeviceCode,
+	models.GrantTypeTokenExchange,
+}
+
+// registrationAuthMethods are the token endpoint authentication methods a client can register with.
+// Certificate thumbprints for self_signed_tls_client_auth are set by an administrator.
+var registrationAuthMethods = []string{
+	models.ClientAuthMethodSecretBasic,
+	models.ClientAuthMethodSecretPost,
+	models.ClientAuthMethodNone,
+	models.ClientAuthMethodTLS,
+	models.ClientAuthMethodPrivateKeyJWT,
+}
+
+// ValidateClientMetadata fills in the defaults of the metadata and checks it can be registered.
+// The OAuth error code and description are returned when it is not valid.
+func ValidateClientMetadata(metadata *models.ClientMetadata) (string, string) {
+	if len(metadata.ClientName) == 0 {
+		return OAuthErrorInvalidClientMetadata, "Missing client_name"
+	}
+
+	if len(metadata.TokenEndpointAuthMethod) == 0 {
+		metadata.TokenEndpointAuthMethod = models.ClientAuthMethodSecretBasic
+	}
+	if !HasScope(registrationAuthMethods, metadata.TokenEndpointAuthMethod) {
+		return OAuthErrorInvalidClientMetadata, "Unsupported token_endpoint_auth_method"
+	}
+	if metadata.TokenEndpointAuthMethod == models.ClientAuthMethodPrivateKeyJWT && (metadata.JWKS == nil || len(metadata.JWKS.Keys) == 0) {
+		return OAuthErrorInvalidClientMetadata, "private_key_jwt requires jwks"
+	}
+	if metadata.TokenEndpointAuthMethod == models.ClientAuthMethodTLS && len(metadata.TLSClientAuthSubjectDN) == 0 {
+		return OAuthErrorInvalidClientMetadata, "tls_client_auth requires tls_client_auth_subject_dn"
+	}
+
+	// the default grant type is authorization_code (RFC 7591 section 2)
+	if len(metadata.GrantTypes) == 0 {
+		metadata.GrantTypes = []string{models.GrantTypeAuthorizationCode}
+	}
+	for _, grantType := range metadata.GrantTypes {
+		if !HasScope(registrationGrantTypes, grantType) {
+			return OAuthErrorInvalidClientMetadata, fmt.Sprintf("Unsupported grant_type (%s)", grantType)
+		}
+		if metadata.TokenEndpointAuthMethod == models.ClientAuthMethodNone && (grantType == models.GrantTypeClientCredentials || grantType == models.GrantTypeTokenExchange) {
+			return OAuthErrorInvalidClientMetadata, fmt.Sprintf("Public clients cannot use %s", grantType)
+		}
+	}
+
+	for _, uri := range metadata.RedirectURIs {
+		if !isValidRedirectURI(uri) {
+			return OAuthErrorInvalidRedirectURI, fmt.Sprintf("Invalid redirect_uri (%s)", uri)
+		}
+	}
+
+	if len(metadata.LogoURI) > 0 {
+		logo, err := url.Parse(metadata.LogoURI)
+		if err != nil || logo.Scheme != "https" || len(logo.Host) == 0 {
+			return OAuthErrorInvalidClientMetadata, "logo_uri must be an https url"
+		}
+	}
+
+	return "", ""
+}
+
+// isValidRedirectURI returns true if the uri is absolute without a fragment, and uses https unless
+// it is on the loopback interface
+func isValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || len(u.Host) == 0 || len(u.Fragment) > 0 {
+		return false
+	}
+
+	if u.Scheme == "https" {
+		return true
+	}
+	if u.Scheme != "http" {
+		return false
+	}
+
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// ApplyClientMetadata copies the registered metadata onto the Application. Settings that are not part
+// of the metadata, such as the access token format, are left as they are.
+func ApplyClientMetadata(app *models.Application, metadata *models.ClientMetadata) {
+	app.Name = metadata.ClientName
+	app.RedirectURIs = metadata.RedirectURIs
+	app.GrantTypes = metadata.GrantTypes
+	app.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+	app.LogoURI = metadata.LogoURI
+	app.Contacts = metadata.Contacts
+	app.JWKS = metadata.JWKS
+	app.TLSClientAuthSubjectDN = metadata.TLSClientAuthSubjectDN
+}
+
+// GetClientMetadata returns the registered metadata of the Application
+func GetClientMetadata(app *models.Application) models.ClientMetadata {
+	return models.ClientMetadata{
+		ClientName:              app.Name,
+		RedirectURIs:            app.RedirectURIs,
+		GrantTypes:              app.GrantTypes,
+		TokenEndpointAuthMethod: app.TokenEndpointAuthMethod,
+		LogoURI:                 app.LogoURI,
+		Contacts:                app.Contacts,
+		JWKS:                    app.JWKS,
+		TLSClientAuthSubjectDN:  app.TLSClientAuthSubjectDN,
+	}
+}
+
+// UsesClientSecret returns true if the token endpoint authentication method needs a client secret
+func UsesClientSecret(method string) bool {
+	return method == models.ClientAuthMethodSecretBasic || method == models.ClientAuthMethodSecretPost
+}
+
+// TestRegistrationAccessToken returns true if the token matches the registration
+func TestRegistrationAccessToken(registration *models.ClientRegistration, token string) bool {
+	if registration == nil || len(token) == 0 {
+		return false
+	}
+
+	hash := []byte(HashClientSecret(token))
+	return subtle.ConstantTimeCompare(hash, []byte(registration.RegistrationAccessTokenHash)) == 1
+}
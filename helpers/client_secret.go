@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// GenerateClientSecret creates a random client secret
+func GenerateClientSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashClientSecret creates a sha of the client secret for storage. Client secrets are
+// generated with 256 bits of entropy so a slow hash like bcrypt is not needed.
+func HashClientSecret(secret string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(secret))
+	return fmt.Sprintf("%x", hasher.Sum(nil))
+}
+
+// TestClientSecret returns true if the provided secret matches one of the unexpired secrets
+func TestClientSecret(secrets *models.ApplicationSecrets, providedSecret string) bool {
+	if secrets == nil || len(providedSecret) == 0 {
+		return false
+	}
+
+	hash := []byte(HashClientSecret(providedSecret))
+	for _, secret := range ActiveClientSecrets(secrets) {
+		if subtle.ConstantTimeCompare(hash, []byte(secret.Hash)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ActiveClientSecrets returns the secrets that have not expired
+func ActiveClientSecrets(secrets *models.ApplicationSecrets) []*models.ApplicationSecret {
+	result := []*models.ApplicationSecret{}
+	if secrets == nil {
+		return result
+	}
+
+	now := time.Now().UTC()
+	for _, secret := range secrets.Secrets {
+		if secret.DateExpires == nil || secret.DateExpires.After(now) {
+			result = append(result, secret)
+		}
+	}
+
+	return result
+}
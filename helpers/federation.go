@@ -0,0 +1,274 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+// upstreamCacheExpiration is how long the discovery document and keys of an upstream provider are kept
+const upstreamCacheExpiration = time.Hour
+
+// upstreamClient is used for every request to an upstream provider
+var upstreamClient = &http.Client{Timeout: 10 * time.Second}
+
+// discovery documents and key sets of upstream providers by url
+var upstreamCache sync.Map
+
+type upstreamCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// federatedIDTokenClaims are the claims read from an upstream ID token
+type federatedIDTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expires       int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified"`
+	Name          string   `json:"name"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+}
+
+// audience is the aud claim, which may be a single string or an array (RFC 7519 section 4.1.3)
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	err := json.Unmarshal(b, &multiple)
+	*a = audience(multiple)
+	return err
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFederation returns the Federation a user signs in through, selected by the site and then by the
+// domain of the email. Nil is returned when the user signs in with a password.
+func GetFederation(c context.Context, email string, site *models.Site) (*models.Federation, error) {
+	store := datastore.GetFromContext(c)
+
+	if site != nil && len(site.FederationID) > 0 {
+		return store.GetFederation(site.FederationID)
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil, nil
+	}
+	return store.GetFederationByEmailDomain(email[at+1:])
+}
+
+// GetFederationCallbackURI returns the redirect uri registered with upstream providers
+func GetFederationCallbackURI(r *http.Request) string {
+	return GetIssuer(r) + "/federation/callback"
+}
+
+// GenerateCodeVerifier creates a random PKCE code verifier (RFC 7636)
+func GenerateCodeVerifier() (string, error) {
+	return generateRandomHex(32)
+}
+
+// BuildFederationAuthorizationURL returns the url of the upstream authorization endpoint the user is sent to
+func BuildFederationAuthorizationURL(federation *models.Federation, request *models.FederationRequest, callbackURI string) (string, error) {
+	upstream, err := getUpstreamConfiguration(federation.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := federation.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile}
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {federation.ClientID},
+		"redirect_uri":          {callbackURI},
+		"scope":                 {FormatScope(scopes)},
+		"state":                 {request.State},
+		"nonce":                 {request.Nonce},
+		"code_challenge":        {CodeChallengeS256(request.CodeVerifier)},
+		"code_challenge_method": {models.CodeChallengeMethodS256},
+	}
+	if len(request.Email) > 0 {
+		query.Set("login_hint", request.Email)
+	}
+
+	separator := "?"
+	if strings.Contains(upstream.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return upstream.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// ExchangeFederationCode redeems the code at the upstream token endpoint and returns the identity in
+// the verified ID token
+func ExchangeFederationCode(federation *models.Federation, request *models.FederationRequest, code, callbackURI string) (*models.FederatedIdentity, error) {
+	upstream, err := getUpstreamConfiguration(federation.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	clientSecret, err := Decrypt(federation.EncryptedClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {models.GrantTypeAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {callbackURI},
+		"code_verifier": {request.CodeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, upstream.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(federation.ClientID), url.QueryEscape(string(clientSecret)))
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream token endpoint returned %d", resp.StatusCode)
+	}
+
+	var token models.TokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	if len(token.IDToken) == 0 {
+		return nil, errors.New("upstream token response is missing id_token")
+	}
+
+	claims, err := verifyFederatedIDToken(upstream, token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case claims.Issuer != upstream.Issuer:
+		return nil, errors.New("id_token issuer does not match")
+	case !claims.Audience.contains(federation.ClientID):
+		return nil, errors.New("id_token audience does not match")
+	case time.Now().Unix() >= claims.Expires:
+		return nil, errors.New("id_token has expired")
+	case claims.Nonce != request.Nonce:
+		return nil, errors.New("id_token nonce does not match")
+	case len(claims.Subject) == 0 || len(claims.Email) == 0:
+		return nil, errors.New("id_token is missing sub or email")
+	case claims.EmailVerified != nil && !*claims.EmailVerified:
+		return nil, errors.New("email is not verified by the upstream provider")
+	}
+
+	return &models.FederatedIdentity{
+		Subject:    claims.Subject,
+		Email:      claims.Email,
+		Name:       claims.Name,
+		GivenName:  claims.GivenName,
+		FamilyName: claims.FamilyName,
+	}, nil
+}
+
+// verifyFederatedIDToken checks the ID token against the upstream keys, fetching them again once in case
+// the upstream provider has rotated its keys
+func verifyFederatedIDToken(upstream *models.OpenIDConfiguration, idToken string) (*federatedIDTokenClaims, error) {
+	claims := &federatedIDTokenClaims{}
+
+	set, err := getUpstreamJWKS(upstream.JWKSURI, false)
+	if err != nil {
+		return nil, err
+	}
+	if VerifyJWT(idToken, set.Keys, claims) == nil {
+		return claims, nil
+	}
+
+	set, err = getUpstreamJWKS(upstream.JWKSURI, true)
+	if err != nil {
+		return nil, err
+	}
+	err = VerifyJWT(idToken, set.Keys, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func getUpstreamConfiguration(issuer string) (*models.OpenIDConfiguration, error) {
+	configuration := &models.OpenIDConfiguration{}
+	err := getUpstreamDocument(strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", configuration, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return configuration, nil
+}
+
+func getUpstreamJWKS(uri string, refresh bool) (*models.JWKSet, error) {
+	set := &models.JWKSet{}
+	err := getUpstreamDocument(uri, set, refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// getUpstreamDocument gets a JSON document from an upstream provider, using the cached copy unless refresh is set
+func getUpstreamDocument(uri string, value interface{}, refresh bool) error {
+	if cached, ok := upstreamCache.Load(uri); ok && !refresh {
+		entry := cached.(*upstreamCacheEntry)
+		if time.Now().Before(entry.expires) {
+			return json.Unmarshal(entry.value.([]byte), value)
+		}
+	}
+
+	resp, err := upstreamClient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", uri, resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&raw)
+	if err != nil {
+		return err
+	}
+
+	upstreamCache.Store(uri, &upstreamCacheEntry{value: []byte(raw), expires: time.Now().Add(upstreamCacheExpiration)})
+	return json.Unmarshal(raw, value)
+}
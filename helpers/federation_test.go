@@ -0,0 +1,367 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	testFederationClientSecret = "upstream-secret"
+	testFederationCallbackURI  = "https://auth.example.com/federation/callback"
+)
+
+// testOIDCProvider is an upstream OpenID Connect provider served by httptest. Codes are handed out by
+// authorize and redeemed at its token endpoint for an ID token signed with its current key.
+type testOIDCProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	clientID string
+
+	mutex sync.Mutex
+	key   *SigningKey
+	jwks  []*models.JWK
+	codes map[string]*testOIDCAuthorization
+}
+
+type testOIDCAuthorization struct {
+	query  url.Values
+	claims map[string]interface{}
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	config.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+
+	p := &testOIDCProvider{
+		t:        t,
+		clientID: "upstream-client",
+		codes:    map[string]*testOIDCAuthorization{},
+	}
+	p.rotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&models.OpenIDConfiguration{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize?prompt=login",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		json.NewEncoder(w).Encode(&models.JWKSet{Keys: p.jwks})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+
+	return p
+}
+
+func (p *testOIDCProvider) Close() {
+	p.server.Close()
+}
+
+// rotateKey signs new ID tokens with a new key, which is the only one published
+func (p *testOIDCProvider) rotateKey() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	generated, err := GenerateSigningKey(AlgorithmRS256)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.key, err = decryptSigningKey(generated)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.jwks = []*models.JWK{generated.PublicKey}
+}
+
+// authorize signs the user in for the authorization url and returns the code sent to the callback.
+// The claims replace the defaults of the ID token, and a nil claim is removed.
+func (p *testOIDCProvider) authorize(authorizationURL string, claims map[string]interface{}) string {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	code := GenerateAuthCode()
+	p.codes[code] = &testOIDCAuthorization{query: parsed.Query(), claims: claims}
+	return code
+}
+
+func (p *testOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if clientID != p.clientID || clientSecret != testFederationClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	authorization, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	if !ok ||
+		r.PostFormValue("grant_type") != models.GrantTypeAuthorizationCode ||
+		r.PostFormValue("redirect_uri") != authorization.query.Get("redirect_uri") ||
+		CodeChallengeS256(r.PostFormValue("code_verifier")) != authorization.query.Get("code_challenge") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":            p.server.URL,
+		"sub":            "upstream-subject",
+		"aud":            p.clientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          authorization.query.Get("nonce"),
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	}
+	for name, value := range authorization.claims {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	idToken, err := SignJWT(p.key, claims)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(&models.TokenResponse{IDToken: idToken, TokenType: "Bearer"})
+}
+
+// federation returns the Federation registered with the provider
+func (p *testOIDCProvider) federation() *models.Federation {
+	secret, err := Encrypt([]byte(testFederationClientSecret))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	return &models.Federation{
+		ID:                    "federation",
+		Issuer:                p.server.URL,
+		ClientID:              p.clientID,
+		EncryptedClientSecret: secret,
+	}
+}
+
+func newTestFederationRequest(t *testing.T) *models.FederationRequest {
+	verifier, err := GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &models.FederationRequest{
+		State:        GenerateAuthCode(),
+		FederationID: "federation",
+		Email:        "jane@example.com",
+		Nonce:        GenerateAuthCode(),
+		CodeVerifier: verifier,
+	}
+}
+
+func TestBuildFederationAuthorizationURL(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	defer provider.Close()
+
+	federation := provider.federation()
+	request := newTestFederationRequest(t)
+
+	authorizationURL, err := BuildFederationAuthorizationURL(federation, request, testFederationCallbackURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(authorizationURL, provider.server.URL+"/authorize?prompt=login&") {
+		t.Errorf("expected the upstream authorization endpoint with its own query, got %s", authorizationURL)
+	}
+
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := url.Values{
+		"prompt":                {"login"},
+		"response_type":         {"code"},
+		"client_id":             {provider.clientID},
+		"redirect_uri":          {testFederationCallbackURI},
+		"scope":                 {"openid email profile"},
+		"state":                 {request.State},
+		"nonce":                 {request.Nonce},
+		"code_challenge":        {CodeChallengeS256(request.CodeVerifier)},
+		"code_challenge_method": {models.CodeChallengeMethodS256},
+		"login_hint":            {"jane@example.com"},
+	}
+	if !reflect.DeepEqual(parsed.Query(), expected) {
+		t.Errorf("expected query %v, got %v", expected, parsed.Query())
+	}
+
+	federation.Scopes = []string{"openid", "email"}
+	request.Email = ""
+	authorizationURL, err = BuildFederationAuthorizationURL(federation, request, testFederationCallbackURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ = url.Parse(authorizationURL)
+	if parsed.Query().Get("scope") != "openid email" || len(parsed.Query().Get("login_hint")) > 0 {
+		t.Errorf("expected the federation's scopes and no login hint, got %v", parsed.Query())
+	}
+}
+
+func TestExchangeFederationCode(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	defer provider.Close()
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		change  func(federation *models.Federation, request *models.FederationRequest)
+		success bool
+	}{
+		{name: "valid id token", success: true},
+		{name: "audience array", claims: map[string]interface{}{"aud": []string{"other", provider.clientID}}, success: true},
+		{name: "email_verified is optional", claims: map[string]interface{}{"email_verified": nil}, success: true},
+		{name: "wrong issuer", claims: map[string]interface{}{"iss": "https://other.example.com"}},
+		{name: "wrong audience", claims: map[string]interface{}{"aud": "other"}},
+		{name: "expired", claims: map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{name: "wrong nonce", claims: map[string]interface{}{"nonce": "other"}},
+		{name: "missing subject", claims: map[string]interface{}{"sub": nil}},
+		{name: "missing email", claims: map[string]interface{}{"email": nil}},
+		{name: "unverified email", claims: map[string]interface{}{"email_verified": false}},
+		{
+			name: "wrong code verifier",
+			change: func(federation *models.Federation, request *models.FederationRequest) {
+				request.CodeVerifier = strings.Repeat("a", 64)
+			},
+		},
+		{
+			name: "wrong client secret",
+			change: func(federation *models.Federation, request *models.FederationRequest) {
+				federation.EncryptedClientSecret, _ = Encrypt([]byte("wrong-secret"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			federation := provider.federation()
+			request := newTestFederationRequest(t)
+
+			authorizationURL, err := BuildFederationAuthorizationURL(federation, request, testFederationCallbackURI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := provider.authorize(authorizationURL, test.claims)
+
+			if test.change != nil {
+				test.change(federation, request)
+			}
+			identity, err := ExchangeFederationCode(federation, request, code, testFederationCallbackURI)
+			if !test.success {
+				if err == nil {
+					t.Errorf("expected an error, got identity %+v", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expected := &models.FederatedIdentity{
+				Subject:    "upstream-subject",
+				Email:      "jane@example.com",
+				Name:       "Jane Doe",
+				GivenName:  "Jane",
+				FamilyName: "Doe",
+			}
+			if !reflect.DeepEqual(identity, expected) {
+				t.Errorf("expected %+v, got %+v", expected, identity)
+			}
+		})
+	}
+}
+
+func TestExchangeFederationCodeSingleUse(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	defer provider.Close()
+
+	federation := provider.federation()
+	request := newTestFederationRequest(t)
+	authorizationURL, err := BuildFederationAuthorizationURL(federation, request, testFederationCallbackURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := provider.authorize(authorizationURL, nil)
+
+	_, err = ExchangeFederationCode(federation, request, code, testFederationCallbackURI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = ExchangeFederationCode(federation, request, code, testFederationCallbackURI)
+	if err == nil {
+		t.Error("expected the code to be rejected the second time")
+	}
+}
+
+func TestExchangeFederationCodeKeyRotation(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	defer provider.Close()
+
+	exchange := func() error {
+		federation := provider.federation()
+		request := newTestFederationRequest(t)
+		authorizationURL, err := BuildFederationAuthorizationURL(federation, request, testFederationCallbackURI)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ExchangeFederationCode(federation, request, provider.authorize(authorizationURL, nil), testFederationCallbackURI)
+		return err
+	}
+
+	// the first exchange caches the published keys
+	if err := exchange(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a token signed with a new key fetches the keys again
+	provider.rotateKey()
+	if err := exchange(); err != nil {
+		t.Fatalf("expected the rotated key to be fetched, got %v", err)
+	}
+
+	// a token signed with a key that is not published is rejected
+	provider.mutex.Lock()
+	published := provider.jwks
+	provider.mutex.Unlock()
+	provider.rotateKey()
+	provider.mutex.Lock()
+	provider.jwks = published
+	provider.mutex.Unlock()
+	if err := exchange(); err == nil {
+		t.Error("expected a token signed with an unpublished key to be rejected")
+	}
+}
@@ -1,8 +1,10 @@
 package helpers
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"strings"
 	"time"
@@ -23,3 +25,57 @@ func GenerateAccessToken(code string) string {
 	hasher.Write([]byte(value))
 	return fmt.Sprintf("%x", hasher.Sum(nil))
 }
+
+// GenerateRefreshToken creates a random refresh token
+func GenerateRefreshToken() (string, error) {
+	return generateRandomHex(32)
+}
+
+// GenerateAuthorizationCode creates a random code for the authorization endpoint
+func GenerateAuthorizationCode() (string, error) {
+	return generateRandomHex(32)
+}
+
+// GenerateDeviceCode creates a random device code
+func GenerateDeviceCode() (string, error) {
+	return generateRandomHex(32)
+}
+
+// userCodeCharset excludes vowels, so no words can be spelled, and characters that are easily confused
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// GenerateUserCode creates a short random code for a user to type, formatted as XXXX-XXXX
+func GenerateUserCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, 9)
+	for i, v := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		// 256 is not a multiple of 20 so this is very slightly biased, which is acceptable for a short lived code
+		code = append(code, userCodeCharset[int(v)%len(userCodeCharset)])
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode converts a user code as typed by a user to the format it was generated in
+func NormalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func generateRandomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -9,9 +9,11 @@ import (
 
 // Authorization Types
 const (
-	AuthTypeToken = "Token"
-	AuthTypeCode  = "Code"
-	AuthTypeBasic = "Basic"
+	AuthTypeToken  = "Token"
+	AuthTypeCode   = "Code"
+	AuthTypeBasic  = "Basic"
+	AuthTypeBearer = "Bearer"
+	AuthTypeAPIKey = "ApiKey"
 )
 
 // ParseAuthorizationHeader returns the value of the authorization header if it matches the type
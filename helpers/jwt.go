@@ -0,0 +1,262 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// JWS signing algorithms
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+// SigningKey is a decrypted private key used to sign JWTs
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.Signer
+}
+
+// SignJWT serializes the claims and signs them with the SigningKey using JWS compact serialization
+func SignJWT(key *SigningKey, claims interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": key.Algorithm,
+		"typ": "JWT",
+		"kid": key.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64URLEncode(header) + "." + base64URLEncode(payload)
+	signature, err := signJWS(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64URLEncode(signature), nil
+}
+
+func signJWS(key *SigningKey, signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+
+	switch key.Algorithm {
+	case AlgorithmRS256:
+		return key.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case AlgorithmES256:
+		ecKey, ok := key.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key %s is not an EC key", key.ID)
+		}
+
+		// JWS uses the fixed width concatenation of r and s rather than ASN.1 (RFC 7518 section 3.4)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		return append(padBytes(r.Bytes(), 32), padBytes(s.Bytes(), 32)...), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm (%s)", key.Algorithm)
+	}
+}
+
+// VerifyJWT checks the signature of the JWT against the key in the set matching its kid and
+// unmarshals the claims. Registered claims such as exp are left to the caller to validate.
+func VerifyJWT(token string, keys []*models.JWK, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errInvalidJWT
+	}
+
+	headerBytes, err := base64URLDecode(parts[0])
+	if err != nil {
+		return errInvalidJWT
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = json.Unmarshal(headerBytes, &header)
+	if err != nil {
+		return errInvalidJWT
+	}
+
+	var jwk *models.JWK
+	for _, key := range keys {
+		if key.Kid == header.Kid && (len(key.Alg) == 0 || key.Alg == header.Alg) {
+			jwk = key
+			break
+		}
+	}
+	if jwk == nil {
+		return fmt.Errorf("no key found for kid (%s)", header.Kid)
+	}
+
+	signature, err := base64URLDecode(parts[2])
+	if err != nil {
+		return errInvalidJWT
+	}
+
+	err = verifyJWS(header.Alg, jwk, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return err
+	}
+
+	payload, err := base64URLDecode(parts[1])
+	if err != nil {
+		return errInvalidJWT
+	}
+
+	return json.Unmarshal(payload, claims)
+}
+
+// IsJWT returns true if the token has the three part structure of a JWS compact serialization
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func verifyJWS(algorithm string, jwk *models.JWK, signingInput, signature []byte) error {
+	pub, err := jwkPublicKey(jwk)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(signingInput)
+
+	switch algorithm {
+	case AlgorithmRS256:
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errInvalidJWT
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature)
+	case AlgorithmES256:
+		ecKey, ok := pub.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errInvalidJWT
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errInvalidJWT
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signing algorithm (%s)", algorithm)
+	}
+}
+
+// jwkPublicKey converts a public JWK into a public key
+func jwkPublicKey(jwk *models.JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64URLDecode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64URLDecode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if jwk.Crv != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("unsupported curve (%s)", jwk.Crv)
+		}
+		x, err := base64URLDecode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64URLDecode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type (%s)", jwk.Kty)
+	}
+}
+
+// publicJWK returns the public key as a JWK without kid, alg or use
+func publicJWK(pub crypto.PublicKey) (*models.JWK, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return &models.JWK{
+			Kty: "RSA",
+			N:   base64URLEncode(k.N.Bytes()),
+			E:   base64URLEncode(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		return &models.JWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   base64URLEncode(padBytes(k.X.Bytes(), 32)),
+			Y:   base64URLEncode(padBytes(k.Y.Bytes(), 32)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type (%T)", pub)
+	}
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of the required members of the public JWK
+func jwkThumbprint(jwk *models.JWK) string {
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y)
+	default:
+		return ""
+	}
+
+	digest := sha256.Sum256([]byte(members))
+	return base64URLEncode(digest[:])
+}
+
+func base64URLEncode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func base64URLDecode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+var errInvalidJWT = errors.New("invalid JWT")
+
+// padBytes left pads the big endian value with zeros to the size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -0,0 +1,148 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// ldapTimeout limits how long a login waits on a directory
+const ldapTimeout = 10 * time.Second
+
+// LDAPAuthenticator checks passwords by binding to an LDAP or Active Directory server. The user entry
+// is found with the directory's service account and then bound to with the password.
+type LDAPAuthenticator struct {
+	Directory *models.Directory
+}
+
+// Authenticate finds the user entry by email and binds to it with the password
+func (a *LDAPAuthenticator) Authenticate(email, password string) (*models.DirectoryIdentity, error) {
+	// an empty password is an unauthenticated bind, which most servers accept
+	if len(password) == 0 {
+		return nil, nil
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if len(a.Directory.BindDN) > 0 {
+		bindPassword, err := Decrypt(a.Directory.EncryptedBindPassword)
+		if err != nil {
+			return nil, err
+		}
+		err = conn.Bind(a.Directory.BindDN, string(bindPassword))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := a.findUser(conn, email)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &models.DirectoryIdentity{
+		Email:      email,
+		Name:       entry.GetAttributeValue("displayName"),
+		GivenName:  entry.GetAttributeValue("givenName"),
+		FamilyName: entry.GetAttributeValue("sn"),
+		Sites:      a.mapGroupsToSites(entry.GetAttributeValues("memberOf")),
+	}
+	if len(identity.Name) == 0 {
+		identity.Name = entry.GetAttributeValue("cn")
+	}
+
+	return identity, nil
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.Directory.URL)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.Directory.StartTLS {
+		err = conn.StartTLS(nil)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// findUser returns the only entry matching the user filter, or nil if there is not exactly one
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, email string) (*ldap.Entry, error) {
+	filter := a.Directory.UserFilter
+	if len(filter) == 0 {
+		filter = models.DefaultDirectoryUserFilter
+	}
+	filter = strings.Replace(filter, "{email}", ldap.EscapeFilter(email), -1)
+
+	request := ldap.NewSearchRequest(
+		a.Directory.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter,
+		[]string{"dn", "cn", "displayName", "givenName", "sn", "memberOf"},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, errors.New("user filter matched more than one entry")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, nil
+	}
+
+	return result.Entries[0], nil
+}
+
+// mapGroupsToSites returns the sites of every group the user is a member of
+func (a *LDAPAuthenticator) mapGroupsToSites(groups []string) []string {
+	sites := []string{}
+	seen := map[string]bool{}
+
+	for _, group := range groups {
+		groupDN, err := ldap.ParseDN(group)
+		if err != nil {
+			continue
+		}
+
+		for mappedGroup, mappedSites := range a.Directory.GroupSites {
+			mappedDN, err := ldap.ParseDN(mappedGroup)
+			if err != nil || !mappedDN.Equal(groupDN) {
+				continue
+			}
+
+			for _, site := range mappedSites {
+				if !seen[site] {
+					seen[site] = true
+					sites = append(sites, site)
+				}
+			}
+		}
+	}
+
+	return sites
+}
@@ -0,0 +1,354 @@
+package helpers
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+const (
+	testServiceDN       = "cn=service,dc=example,dc=com"
+	testServicePassword = "service-password"
+	testUserDN          = "uid=jane,ou=people,dc=example,dc=com"
+	testUserPassword    = "jane-password"
+)
+
+// testLDAPEntry is an entry served by testLDAPServer. Binding to it needs the password.
+type testLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testLDAPServer is an in-process LDAP server that answers simple binds and searches with AND and
+// equality filters, which is all LDAPAuthenticator uses
+type testLDAPServer struct {
+	listener net.Listener
+	entries  []*testLDAPEntry
+}
+
+func newTestLDAPServer(t *testing.T, entries ...*testLDAPEntry) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &testLDAPServer{listener: listener, entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *testLDAPServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if s.bind(op.Children[1].Data.String(), op.Children[2].Data.String()) {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(testLDAPResult(messageID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			for _, entry := range s.entries {
+				if testLDAPFilterMatches(op.Children[6], entry) {
+					conn.Write(testLDAPSearchEntry(messageID, entry).Bytes())
+				}
+			}
+			conn.Write(testLDAPResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func (s *testLDAPServer) bind(dn, password string) bool {
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) && len(password) > 0 && entry.password == password {
+			return true
+		}
+	}
+	return false
+}
+
+func testLDAPFilterMatches(filter *ber.Packet, entry *testLDAPEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !testLDAPFilterMatches(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterEqualityMatch:
+		attribute := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		for name, values := range entry.attributes {
+			if !strings.EqualFold(name, attribute) {
+				continue
+			}
+			for _, v := range values {
+				if strings.EqualFold(v, value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func testLDAPResult(messageID int64, tag ber.Tag, code uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return testLDAPMessage(messageID, result)
+}
+
+func testLDAPSearchEntry(messageID int64, entry *testLDAPEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+
+	return testLDAPMessage(messageID, result)
+}
+
+func testLDAPMessage(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func newTestDirectory(t *testing.T) (*models.Directory, *testLDAPServer) {
+	config.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+	bindPassword, err := Encrypt([]byte(testServicePassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestLDAPServer(t,
+		&testLDAPEntry{
+			dn:       testServiceDN,
+			password: testServicePassword,
+			attributes: map[string][]string{
+				"objectClass": {"applicationProcess"},
+				"cn":          {"service"},
+			},
+		},
+		&testLDAPEntry{
+			dn:       testUserDN,
+			password: testUserPassword,
+			attributes: map[string][]string{
+				"objectClass": {"person"},
+				"mail":        {"jane@example.com"},
+				"cn":          {"jane"},
+				"displayName": {"Jane Doe"},
+				"givenName":   {"Jane"},
+				"sn":          {"Doe"},
+				"memberOf": {
+					"cn=Sales,ou=groups,dc=example,dc=com",
+					"cn=Support,ou=groups,dc=example,dc=com",
+					"cn=Everyone,ou=groups,dc=example,dc=com",
+				},
+			},
+		},
+	)
+
+	directory := &models.Directory{
+		ID:                    "directory",
+		URL:                   server.URL(),
+		BindDN:                testServiceDN,
+		EncryptedBindPassword: bindPassword,
+		BaseDN:                "dc=example,dc=com",
+	}
+	return directory, server
+}
+
+func TestLDAPAuthenticatorBind(t *testing.T) {
+	directory, server := newTestDirectory(t)
+	defer server.Close()
+	authenticator := &LDAPAuthenticator{Directory: directory}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		success  bool
+	}{
+		{"correct password", "jane@example.com", testUserPassword, true},
+		{"email is not case sensitive", "Jane@Example.com", testUserPassword, true},
+		{"wrong password", "jane@example.com", "wrong-password", false},
+		{"empty password", "jane@example.com", "", false},
+		{"unknown user", "john@example.com", testUserPassword, false},
+		{"filter characters are escaped", "*", testUserPassword, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := authenticator.Authenticate(test.email, test.password)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.success != (identity != nil) {
+				t.Fatalf("expected success %t, got identity %+v", test.success, identity)
+			}
+			if identity == nil {
+				return
+			}
+
+			expected := &models.DirectoryIdentity{
+				Email:      test.email,
+				Name:       "Jane Doe",
+				GivenName:  "Jane",
+				FamilyName: "Doe",
+				Sites:      []string{},
+			}
+			if !reflect.DeepEqual(identity, expected) {
+				t.Errorf("expected %+v, got %+v", expected, identity)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticatorServiceAccount(t *testing.T) {
+	directory, server := newTestDirectory(t)
+	defer server.Close()
+
+	wrongPassword, err := Encrypt([]byte("wrong-password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory.EncryptedBindPassword = wrongPassword
+
+	authenticator := &LDAPAuthenticator{Directory: directory}
+	identity, err := authenticator.Authenticate("jane@example.com", testUserPassword)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Fatalf("expected invalid credentials for the service account, got %v", err)
+	}
+	if identity != nil {
+		t.Errorf("expected no identity, got %+v", identity)
+	}
+}
+
+func TestLDAPAuthenticatorUnreachable(t *testing.T) {
+	directory, server := newTestDirectory(t)
+	server.Close()
+
+	authenticator := &LDAPAuthenticator{Directory: directory}
+	_, err := authenticator.Authenticate("jane@example.com", testUserPassword)
+	if err == nil {
+		t.Fatal("expected an error when the directory cannot be reached")
+	}
+}
+
+func TestLDAPAuthenticatorGroupSites(t *testing.T) {
+	directory, server := newTestDirectory(t)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		groupSites map[string][]string
+		expected   []string
+	}{
+		{
+			name:     "no mapped groups",
+			expected: []string{},
+		},
+		{
+			name: "mapped group",
+			groupSites: map[string][]string{
+				"cn=Sales,ou=groups,dc=example,dc=com": {"site-1", "site-2"},
+			},
+			expected: []string{"site-1", "site-2"},
+		},
+		{
+			name: "group dn is compared by value",
+			groupSites: map[string][]string{
+				"CN=Sales, OU=groups, DC=example, DC=com": {"site-1"},
+			},
+			expected: []string{"site-1"},
+		},
+		{
+			name: "sites of several groups are not repeated",
+			groupSites: map[string][]string{
+				"cn=Sales,ou=groups,dc=example,dc=com":   {"site-1", "site-2"},
+				"cn=Support,ou=groups,dc=example,dc=com": {"site-2", "site-3"},
+			},
+			expected: []string{"site-1", "site-2", "site-3"},
+		},
+		{
+			name: "groups the user is not a member of",
+			groupSites: map[string][]string{
+				"cn=Admins,ou=groups,dc=example,dc=com": {"site-1"},
+				"not a dn":                              {"site-2"},
+			},
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory.GroupSites = test.groupSites
+			authenticator := &LDAPAuthenticator{Directory: directory}
+
+			identity, err := authenticator.Authenticate("jane@example.com", testUserPassword)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if identity == nil {
+				t.Fatal("expected an identity")
+			}
+
+			sites := append([]string{}, identity.Sites...)
+			sort.Strings(sites)
+			if !reflect.DeepEqual(sites, test.expected) {
+				t.Errorf("expected sites %v, got %v", test.expected, sites)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package helpers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// OAuth 2.0 error codes (RFC 6749 section 5.2)
+const (
+	OAuthErrorInvalidRequest       = "invalid_request"
+	OAuthErrorInvalidClient        = "invalid_client"
+	OAuthErrorInvalidGrant         = "invalid_grant"
+	OAuthErrorUnauthorizedClient   = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrorServerError          = "server_error"
+	OAuthErrorInvalidScope         = "invalid_scope"
+
+	// authorization endpoint (RFC 6749 section 4.1.2.1)
+	OAuthErrorUnsupportedResponseType = "unsupported_response_type"
+
+	// token exchange (RFC 8693 section 2.2.2)
+	OAuthErrorInvalidTarget = "invalid_target"
+
+	// bearer token usage (RFC 6750 section 3.1)
+	OAuthErrorInvalidToken = "invalid_token"
+
+	// dynamic client registration (RFC 7591 section 3.2.2)
+	OAuthErrorInvalidRedirectURI    = "invalid_redirect_uri"
+	OAuthErrorInvalidClientMetadata = "invalid_client_metadata"
+
+	// device authorization grant (RFC 8628 section 3.5)
+	OAuthErrorAuthorizationPending = "authorization_pending"
+	OAuthErrorSlowDown             = "slow_down"
+	OAuthErrorAccessDenied         = "access_denied"
+	OAuthErrorExpiredToken         = "expired_token"
+)
+
+// PrepareOAuthErrorResponse places the error code and description into a JSON interface
+// in the format defined by RFC 6749
+func PrepareOAuthErrorResponse(code, description string) gin.H {
+	resp := gin.H{
+		"error": code,
+	}
+
+	if len(description) > 0 {
+		resp["error_description"] = description
+	}
+
+	return resp
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/models"
+)
+
+// GetIssuer returns the issuer identifier. When no issuer is configured it is built from the request.
+func GetIssuer(r *http.Request) string {
+	if len(config.Issuer) > 0 {
+		return config.Issuer
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// BuildUserInfo returns the claims about the user that are allowed by the scopes
+func BuildUserInfo(user *models.User, scopes []string) models.UserInfo {
+	info := models.UserInfo{
+		Subject: user.ID,
+	}
+
+	if HasScope(scopes, models.ScopeEmail) {
+		verified := user.IsValidated
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+
+	if HasScope(scopes, models.ScopeProfile) {
+		info.Name = user.Name
+		info.GivenName = user.GivenName
+		info.FamilyName = user.FamilyName
+	}
+
+	return info
+}
+
+// GetAuthTime returns the time the user last authenticated from their list of logins
+func GetAuthTime(user *models.User, authCode *models.AuthCode) time.Time {
+	if len(user.Logins) > 0 {
+		return user.Logins[0].Time
+	}
+
+	return authCode.DateCreated
+}
@@ -1,7 +1,10 @@
 package helpers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -10,29 +13,35 @@ import (
 	"github.com/pemiller/authentication/models"
 )
 
-// TestPassword compares provided password to password in the User document
-func TestPassword(c *gin.Context, user *models.User, providedPassword string) bool {
-	var match bool
-	if len(user.Password) > 0 {
-		match, _ = comparePasswordToHash(user.Password, providedPassword)
+// PasswordChangeRequiredMessage is the error description used when a token is requested with an AuthCode
+// whose password does not meet the tenant's password policy
+const PasswordChangeRequiredMessage = "Password must be changed to meet the tenant's password policy"
+
+// TestPassword checks the provided password with the Authenticator and returns what it knows about the user.
+// Failed attempts are counted against the email in the tenant.
+func TestPassword(c *gin.Context, authenticator Authenticator, tenantID, email, providedPassword string) (*models.DirectoryIdentity, bool) {
+	identity, err := authenticator.Authenticate(email, providedPassword)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, PrepareErrorResponse("Unable to check password", err))
+		return nil, false
 	}
 
-	if !match {
-		locked, err := datastore.GetFromContext(c).IncrLoginFailCount(user.Email)
+	if identity == nil {
+		locked, err := datastore.GetFromContext(c).IncrLoginFailCount(tenantID, email)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, PrepareErrorResponse("Unable to update failed login", err))
-			return false
+			return nil, false
 		}
 		if locked {
 			c.String(http.StatusUnauthorized, "Locked")
-			return false
+			return nil, false
 		}
 
 		c.Status(http.StatusUnauthorized)
-		return false
+		return nil, false
 	}
 
-	return true
+	return identity, true
 }
 
 func comparePasswordToHash(storedPass, providedPass string) (bool, error) {
@@ -49,3 +58,39 @@ func CryptPassword(pass string) (string, error) {
 
 	return string(bytes), nil
 }
+
+// ValidatePassword returns an error describing the first rule of the policy the password does not meet
+func ValidatePassword(policy *models.PasswordPolicy, password string) error {
+	if policy == nil {
+		return nil
+	}
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", policy.MinLength)
+	}
+
+	var upper, lower, number, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			number = true
+		default:
+			symbol = true
+		}
+	}
+
+	switch {
+	case policy.RequireUppercase && !upper:
+		return errors.New("Password must contain an uppercase letter")
+	case policy.RequireLowercase && !lower:
+		return errors.New("Password must contain a lowercase letter")
+	case policy.RequireNumber && !number:
+		return errors.New("Password must contain a number")
+	case policy.RequireSymbol && !symbol:
+		return errors.New("Password must contain a symbol")
+	}
+	return nil
+}
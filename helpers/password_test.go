@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/pemiller/authentication/models"
+)
+
+func TestValidatePassword(t *testing.T) {
+	policy := &models.PasswordPolicy{
+		MinLength:        8,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireNumber:    true,
+		RequireSymbol:    true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   *models.PasswordPolicy
+		password string
+		expected string
+	}{
+		{"no policy", nil, "a", ""},
+		{"meets the policy", policy, "Passw0rd!", ""},
+		{"too short", policy, "Pa0!", "Password must be at least 8 characters"},
+		{"length counts characters", &models.PasswordPolicy{MinLength: 4}, "ééé", "Password must be at least 4 characters"},
+		{"missing uppercase", policy, "passw0rd!", "Password must contain an uppercase letter"},
+		{"missing lowercase", policy, "PASSW0RD!", "Password must contain a lowercase letter"},
+		{"missing number", policy, "Password!", "Password must contain a number"},
+		{"missing symbol", policy, "Passw0rd", "Password must contain a symbol"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePassword(test.policy, test.password)
+			message := ""
+			if err != nil {
+				message = err.Error()
+			}
+			if message != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"regexp"
+)
+
+// codeVerifierPattern matches the characters and length allowed in a PKCE code verifier and in an
+// S256 code challenge (RFC 7636 section 4.1)
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// CodeChallengeS256 returns the S256 code challenge of the PKCE code verifier (RFC 7636 section 4.2)
+func CodeChallengeS256(verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	return base64URLEncode(challenge[:])
+}
+
+// IsValidCodeChallenge returns true if the value can be an S256 code challenge
+func IsValidCodeChallenge(challenge string) bool {
+	return codeVerifierPattern.MatchString(challenge)
+}
+
+// VerifyCodeChallenge returns true if the code verifier matches the S256 code challenge
+func VerifyCodeChallenge(challenge, verifier string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(CodeChallengeS256(verifier)), []byte(challenge)) == 1
+}
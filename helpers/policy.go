@@ -0,0 +1,231 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// EvaluatePolicy applies the rules of the policy to the input. Every deny rule that matches is given
+// as a reason, otherwise the allow rules that match, otherwise the default effect. A nil policy allows.
+func EvaluatePolicy(policy *models.Policy, input *models.PolicyInput) *models.PolicyDecision {
+	if policy == nil {
+		return &models.PolicyDecision{Allowed: true, Reasons: []string{"No policy"}}
+	}
+
+	attributes := map[string][]string{}
+	for k, v := range input.Attributes {
+		attributes[k] = v
+	}
+	now := input.Time
+	if location, err := time.LoadLocation(policy.TimeZone); err == nil {
+		now = now.In(location)
+	}
+	attributes["request.time"] = []string{now.Format("15:04")}
+	attributes["request.weekday"] = []string{now.Format("Mon")}
+
+	denied := []string{}
+	allowed := []string{}
+	for _, rule := range policy.Rules {
+		if !matchesPolicyRule(rule, attributes) {
+			continue
+		}
+
+		reason := rule.Reason
+		if len(reason) == 0 {
+			reason = fmt.Sprintf("Rule %s", rule.Name)
+		}
+		if rule.Effect == models.PolicyEffectDeny {
+			denied = append(denied, reason)
+		} else {
+			allowed = append(allowed, reason)
+		}
+	}
+
+	decision := &models.PolicyDecision{PolicyVersion: policy.Version}
+	switch {
+	case len(denied) > 0:
+		decision.Reasons = denied
+	case len(allowed) > 0:
+		decision.Allowed = true
+		decision.Reasons = allowed
+	default:
+		decision.Allowed = policy.DefaultEffect != models.PolicyEffectDeny
+		decision.Reasons = []string{fmt.Sprintf("Default %s", policy.DefaultEffect)}
+	}
+	return decision
+}
+
+// matchesPolicyRule returns true if every condition of the rule matches
+func matchesPolicyRule(rule *models.PolicyRule, attributes map[string][]string) bool {
+	for _, condition := range rule.Conditions {
+		if !matchesPolicyCondition(condition, attributes[condition.Attribute]) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesPolicyCondition(condition *models.PolicyCondition, values []string) bool {
+	switch condition.Operator {
+	case models.PolicyOperatorIn:
+		return anyPolicyValue(values, condition.Values, func(v, expected string) bool { return strings.EqualFold(v, expected) })
+	case models.PolicyOperatorNotIn:
+		return !anyPolicyValue(values, condition.Values, func(v, expected string) bool { return strings.EqualFold(v, expected) })
+	case models.PolicyOperatorCIDR:
+		return anyPolicyValue(values, condition.Values, containsIP)
+	case models.PolicyOperatorNotCIDR:
+		return !anyPolicyValue(values, condition.Values, containsIP)
+	case models.PolicyOperatorBetween:
+		return len(values) > 0 && isTimeBetween(values[0], condition.Values[0], condition.Values[1])
+	case models.PolicyOperatorNotBetween:
+		return len(values) > 0 && !isTimeBetween(values[0], condition.Values[0], condition.Values[1])
+	}
+	return false
+}
+
+// anyPolicyValue returns true if any of the attribute values matches any of the expected values
+func anyPolicyValue(values, expected []string, match func(string, string) bool) bool {
+	for _, v := range values {
+		for _, e := range expected {
+			if match(v, e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsIP returns true if the ip is in the cidr, or equal to it when it is a single address
+func containsIP(ip, cidr string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	if !strings.Contains(cidr, "/") {
+		other := net.ParseIP(cidr)
+		return other != nil && other.Equal(parsed)
+	}
+
+	_, network, err := net.ParseCIDR(cidr)
+	return err == nil && network.Contains(parsed)
+}
+
+// isTimeBetween compares HH:MM times. The start is included and the end is not, and a start after
+// the end is a range that crosses midnight.
+func isTimeBetween(value, start, end string) bool {
+	if start <= end {
+		return value >= start && value < end
+	}
+	return value >= start || value < end
+}
+
+// ValidatePolicy checks that the policy can be evaluated
+func ValidatePolicy(policy *models.Policy) error {
+	if policy.DefaultEffect != models.PolicyEffectAllow && policy.DefaultEffect != models.PolicyEffectDeny {
+		return errors.New("default_effect must be allow or deny")
+	}
+	if _, err := time.LoadLocation(policy.TimeZone); err != nil {
+		return fmt.Errorf("unknown time_zone (%s)", policy.TimeZone)
+	}
+
+	for i, rule := range policy.Rules {
+		if len(rule.Name) == 0 {
+			rule.Name = strconv.Itoa(i + 1)
+		}
+		if rule.Effect != models.PolicyEffectAllow && rule.Effect != models.PolicyEffectDeny {
+			return fmt.Errorf("rule %s: effect must be allow or deny", rule.Name)
+		}
+		if len(rule.Conditions) == 0 {
+			return fmt.Errorf("rule %s: at least one condition is required", rule.Name)
+		}
+
+		for _, condition := range rule.Conditions {
+			err := validatePolicyCondition(condition)
+			if err != nil {
+				return fmt.Errorf("rule %s: %v", rule.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validatePolicyCondition(condition *models.PolicyCondition) error {
+	if len(condition.Attribute) == 0 {
+		return errors.New("condition is missing attribute")
+	}
+
+	switch condition.Operator {
+	case models.PolicyOperatorIn, models.PolicyOperatorNotIn:
+		if len(condition.Values) == 0 {
+			return fmt.Errorf("%s requires values", condition.Operator)
+		}
+	case models.PolicyOperatorCIDR, models.PolicyOperatorNotCIDR:
+		if len(condition.Values) == 0 {
+			return fmt.Errorf("%s requires values", condition.Operator)
+		}
+		for _, v := range condition.Values {
+			if _, _, err := net.ParseCIDR(v); err != nil && net.ParseIP(v) == nil {
+				return fmt.Errorf("invalid ip or cidr (%s)", v)
+			}
+		}
+	case models.PolicyOperatorBetween, models.PolicyOperatorNotBetween:
+		if len(condition.Values) != 2 {
+			return fmt.Errorf("%s requires a start and end time", condition.Operator)
+		}
+		for _, v := range condition.Values {
+			if _, err := time.Parse("15:04", v); err != nil || len(v) != 5 {
+				return fmt.Errorf("invalid time (%s), use HH:MM", v)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operator (%s)", condition.Operator)
+	}
+
+	return nil
+}
+
+// NewPolicyInput collects the attributes of the user, site and token that policies can refer to.
+// The user is nil for application tokens.
+func NewPolicyInput(user *models.User, site *models.Site, authCode *models.AuthCode, accessToken *models.AccessToken, ip string) *models.PolicyInput {
+	attributes := map[string][]string{
+		"site.id":              {site.SiteID},
+		"site.url":             {site.SiteURL},
+		"site.number":          {site.SiteNumber},
+		"token.application_id": {accessToken.ApplicationID},
+		"token.auth_type":      {string(authCode.AuthType)},
+		"token.scopes":         GetAccessTokenScopes(accessToken, authCode),
+		"token.roles":          accessToken.Roles,
+		"token.impersonated":   {strconv.FormatBool(len(accessToken.ImpersonatorID) > 0)},
+	}
+	if len(ip) > 0 {
+		attributes["request.ip"] = []string{ip}
+	}
+	for k, v := range site.Attributes {
+		attributes["site.attributes."+k] = []string{v}
+	}
+
+	if user != nil {
+		attributes["user.id"] = []string{user.ID}
+		attributes["user.email"] = []string{user.Email}
+		if at := strings.LastIndex(user.Email, "@"); at >= 0 {
+			attributes["user.email_domain"] = []string{strings.ToLower(user.Email[at+1:])}
+		}
+		attributes["user.is_validated"] = []string{strconv.FormatBool(user.IsValidated)}
+		for k, v := range user.Attributes {
+			attributes["user.attributes."+k] = []string{v}
+		}
+	}
+
+	return &models.PolicyInput{
+		Attributes: attributes,
+		Time:       time.Now().UTC(),
+	}
+}
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// BuildRequestSigningString returns the value a request signature is computed over. Each part is on
+// its own line: method, request uri with query, hex SHA-256 of the body, timestamp, nonce and application id.
+func BuildRequestSigningString(method, requestURI string, body []byte, timestamp, nonce, applicationID string) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		requestURI,
+		hex.EncodeToString(bodyHash[:]),
+		timestamp,
+		nonce,
+		applicationID,
+	}, "\n")
+}
+
+// SignRequest returns the base64 encoded HMAC-SHA256 of the signing string
+func SignRequest(secret []byte, signingString string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestRequestSignature compares the signature to the expected one in constant time
+func TestRequestSignature(secret []byte, signingString, signature string) bool {
+	return hmac.Equal([]byte(SignRequest(secret, signingString)), []byte(signature))
+}
@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"github.com/pemiller/authentication/models"
+)
+
+// GetRoles returns the names of the roles assigned for the application on the site
+func GetRoles(assignments *models.RoleAssignments, applicationID, siteID string) []string {
+	roles := []string{}
+	if assignments == nil {
+		return roles
+	}
+
+	for _, assignment := range assignments.Assignments {
+		if assignment.ApplicationID == applicationID && assignment.SiteID == siteID && !HasScope(roles, assignment.Role) {
+			roles = append(roles, assignment.Role)
+		}
+	}
+	return roles
+}
+
+// GetRole returns the role of the application defined by the name, or nil if there is no such role
+func GetRole(app *models.Application, name string) *models.Role {
+	for _, role := range app.Roles {
+		if role.Name == name {
+			return role
+		}
+	}
+	return nil
+}
+
+// HasPermission returns true if one of the roles grants the permission. Roles the application no
+// longer defines grant nothing.
+func HasPermission(app *models.Application, roles []string, permission string) bool {
+	for _, name := range roles {
+		role := GetRole(app, name)
+		if role == nil {
+			continue
+		}
+		if HasScope(role.Permissions, permission) || HasScope(role.Permissions, models.PermissionWildcard) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+// SAML namespaces and algorithm identifiers
+const (
+	samlNamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlNamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlNamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	xmlDSigNamespace       = "http://www.w3.org/2000/09/xmldsig#"
+	xmlDSigExcC14N         = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	xmlDSigEnveloped       = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	xmlDSigRSASHA256       = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	xmlDSigSHA256          = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+	// SAMLBindingRedirect is the HTTP-Redirect binding
+	SAMLBindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	// SAMLBindingPOST is the HTTP-POST binding
+	SAMLBindingPOST = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// samlAssertionLifetime is how long a service provider may accept an assertion for
+const samlAssertionLifetime = 5 * time.Minute
+
+// self signed certificates by key id, they are deterministic so they only need to be built once
+var samlCertificates sync.Map
+
+// SAMLSigningKey is a signing key with the certificate that is published for it in the metadata
+type SAMLSigningKey struct {
+	*SigningKey
+	Certificate []byte
+}
+
+// GetSAMLEntityID returns the entity id of the identity provider
+func GetSAMLEntityID(issuer string) string {
+	return issuer + "/saml/metadata"
+}
+
+// ParseSAMLAuthnRequest decodes a SAMLRequest parameter. Requests sent with the redirect binding are deflated.
+func ParseSAMLAuthnRequest(encoded string, deflated bool) (*models.SAMLAuthnRequest, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if deflated {
+		b, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	request := &models.SAMLAuthnRequest{}
+	err = xml.Unmarshal(b, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(request.ID) == 0 || len(request.Issuer) == 0 {
+		return nil, errors.New("AuthnRequest is missing ID or Issuer")
+	}
+
+	return request, nil
+}
+
+// VerifySAMLRedirectSignature checks the signature of a request sent with the redirect binding against
+// the certificate of the service provider. The signed value is built from the query exactly as it was
+// encoded by the service provider (SAML bindings section 3.4.4.1).
+func VerifySAMLRedirectSignature(rawQuery, certificate string) error {
+	values := map[string]string{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) == 2 {
+			values[pair[0]] = pair[1]
+		}
+	}
+
+	sigAlg, err := url.QueryUnescape(values["SigAlg"])
+	if err != nil || sigAlg != xmlDSigRSASHA256 {
+		return errors.New("unsupported signature algorithm")
+	}
+
+	signature, err := url.QueryUnescape(values["Signature"])
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+
+	signed := "SAMLRequest=" + values["SAMLRequest"]
+	if relayState, ok := values["RelayState"]; ok {
+		signed += "&RelayState=" + relayState
+	}
+	signed += "&SigAlg=" + values["SigAlg"]
+
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return errors.New("invalid service provider certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("service provider certificate is not an RSA key")
+	}
+
+	hash := sha256.Sum256([]byte(signed))
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig)
+}
+
+// GetSAMLSigningKey returns the active RS256 key and its certificate
+func GetSAMLSigningKey(c context.Context) (*SAMLSigningKey, error) {
+	keys, err := getSAMLSigningKeys(c, models.SigningKeyStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no active signing key for %s", AlgorithmRS256)
+	}
+
+	return keys[0], nil
+}
+
+// GetSAMLCertificates returns the certificates of the next and active RS256 keys, so service providers
+// already trust the next key when it becomes active
+func GetSAMLCertificates(c context.Context) ([][]byte, error) {
+	keys, err := getSAMLSigningKeys(c, models.SigningKeyStatusNext, models.SigningKeyStatusActive)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := [][]byte{}
+	for _, key := range keys {
+		certs = append(certs, key.Certificate)
+	}
+
+	return certs, nil
+}
+
+func getSAMLSigningKeys(c context.Context, statuses ...models.SigningKeyStatus) ([]*SAMLSigningKey, error) {
+	keys, err := datastore.GetFromContext(c).GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*SAMLSigningKey{}
+	for _, key := range keys {
+		if key.Algorithm != AlgorithmRS256 || !hasSigningKeyStatus(key, statuses) {
+			continue
+		}
+
+		signingKey, err := decryptSigningKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := samlCertificate(key, signingKey)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &SAMLSigningKey{SigningKey: signingKey, Certificate: cert})
+	}
+
+	return result, nil
+}
+
+func hasSigningKeyStatus(key *models.SigningKey, statuses []models.SigningKeyStatus) bool {
+	for _, status := range statuses {
+		if key.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// samlCertificate builds a self signed certificate for the key. Everything in it is derived from the
+// key, and RSA signatures are deterministic, so every instance of the service builds the same certificate.
+func samlCertificate(key *models.SigningKey, signingKey *SigningKey) ([]byte, error) {
+	if cached, ok := samlCertificates.Load(key.ID); ok {
+		return cached.([]byte), nil
+	}
+
+	serial := sha256.Sum256([]byte(key.ID))
+	notBefore := key.DateCreated.Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(serial[:16]),
+		Subject:      pkix.Name{CommonName: config.ServiceName},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, signingKey.Key.Public(), signingKey.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	samlCertificates.Store(key.ID, cert)
+	return cert, nil
+}
+
+// BuildSAMLMetadata returns the metadata document of the identity provider
+func BuildSAMLMetadata(issuer string, certs [][]byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<md:EntityDescriptor xmlns:md="%s" entityID="%s">`, samlNamespaceMetadata, escapeXMLAttr(GetSAMLEntityID(issuer)))
+	fmt.Fprintf(&b, `<md:IDPSSODescriptor protocolSupportEnumeration="%s" WantAuthnRequestsSigned="false">`, samlNamespaceProtocol)
+	for _, cert := range certs {
+		fmt.Fprintf(&b, `<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="%s"><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`,
+			xmlDSigNamespace, base64.StdEncoding.EncodeToString(cert))
+	}
+	fmt.Fprintf(&b, `<md:NameIDFormat>%s</md:NameIDFormat>`, models.SAMLNameIDFormatPersistent)
+	fmt.Fprintf(&b, `<md:NameIDFormat>%s</md:NameIDFormat>`, models.SAMLNameIDFormatEmailAddress)
+	for _, binding := range []string{SAMLBindingRedirect, SAMLBindingPOST} {
+		fmt.Fprintf(&b, `<md:SingleSignOnService Binding="%s" Location="%s"/>`, binding, escapeXMLAttr(issuer+"/saml/sso"))
+	}
+	b.WriteString(`</md:IDPSSODescriptor></md:EntityDescriptor>`)
+	return b.String()
+}
+
+// BuildSAMLResponse returns a base64 encoded Response with a signed assertion about the user.
+// The attributes are the user's email and names, and the ids of the sites they can access.
+func BuildSAMLResponse(issuer string, key *SAMLSigningKey, sp *models.SAMLServiceProvider, request *models.SAMLRequest, user *models.User, sites []string, authTime time.Time) (string, error) {
+	now := time.Now().UTC()
+	entityID := GetSAMLEntityID(issuer)
+
+	responseID, err := generateSAMLID()
+	if err != nil {
+		return "", err
+	}
+	assertionID, err := generateSAMLID()
+	if err != nil {
+		return "", err
+	}
+
+	nameIDFormat := models.SAMLNameIDFormatPersistent
+	nameID := user.ID
+	if sp.NameIDFormat == models.SAMLNameIDFormatEmailAddress {
+		nameIDFormat = models.SAMLNameIDFormatEmailAddress
+		nameID = user.Email
+	}
+
+	// the assertion is written in exclusive canonical form so it can be digested as it is
+	var subject strings.Builder
+	fmt.Fprintf(&subject, `<saml:Subject><saml:NameID Format="%s">%s</saml:NameID>`, nameIDFormat, escapeXMLText(nameID))
+	fmt.Fprintf(&subject, `<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="%s" Recipient="%s"></saml:SubjectConfirmationData></saml:SubjectConfirmation></saml:Subject>`,
+		escapeXMLAttr(request.RequestID), formatSAMLTime(now.Add(samlAssertionLifetime)), escapeXMLAttr(request.ACSURL))
+	fmt.Fprintf(&subject, `<saml:Conditions NotBefore="%s" NotOnOrAfter="%s"><saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`,
+		formatSAMLTime(now.Add(-time.Minute)), formatSAMLTime(now.Add(samlAssertionLifetime)), escapeXMLText(sp.EntityID))
+	fmt.Fprintf(&subject, `<saml:AuthnStatement AuthnInstant="%s" SessionIndex="%s"><saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef></saml:AuthnContext></saml:AuthnStatement>`,
+		formatSAMLTime(authTime), assertionID)
+	subject.WriteString(`<saml:AttributeStatement>`)
+	writeSAMLAttribute(&subject, "email", user.Email)
+	writeSAMLAttribute(&subject, "name", user.Name)
+	writeSAMLAttribute(&subject, "given_name", user.GivenName)
+	writeSAMLAttribute(&subject, "family_name", user.FamilyName)
+	writeSAMLAttribute(&subject, "sites", sites...)
+	subject.WriteString(`</saml:AttributeStatement>`)
+
+	assertionStart := fmt.Sprintf(`<saml:Assertion xmlns:saml="%s" ID="%s" IssueInstant="%s" Version="2.0">`, samlNamespaceAssertion, assertionID, formatSAMLTime(now))
+	issuerElement := fmt.Sprintf(`<saml:Issuer>%s</saml:Issuer>`, escapeXMLText(entityID))
+	assertionEnd := `</saml:Assertion>`
+
+	digest := sha256.Sum256([]byte(assertionStart + issuerElement + subject.String() + assertionEnd))
+	signedInfo := fmt.Sprintf(`<ds:SignedInfo xmlns:ds="%s"><ds:CanonicalizationMethod Algorithm="%s"></ds:CanonicalizationMethod><ds:SignatureMethod Algorithm="%s"></ds:SignatureMethod><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="%s"></ds:Transform><ds:Transform Algorithm="%s"></ds:Transform></ds:Transforms><ds:DigestMethod Algorithm="%s"></ds:DigestMethod><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		xmlDSigNamespace, xmlDSigExcC14N, xmlDSigRSASHA256, assertionID, xmlDSigEnveloped, xmlDSigExcC14N, xmlDSigSHA256, base64.StdEncoding.EncodeToString(digest[:]))
+
+	hash := sha256.Sum256([]byte(signedInfo))
+	sig, err := key.Key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="%s">%s<ds:SignatureValue>%s</ds:SignatureValue><ds:KeyInfo><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></ds:Signature>`,
+		xmlDSigNamespace, signedInfo, base64.StdEncoding.EncodeToString(sig), base64.StdEncoding.EncodeToString(key.Certificate))
+
+	var response strings.Builder
+	fmt.Fprintf(&response, `<samlp:Response xmlns:samlp="%s" Destination="%s" ID="%s" InResponseTo="%s" IssueInstant="%s" Version="2.0">`,
+		samlNamespaceProtocol, escapeXMLAttr(request.ACSURL), responseID, escapeXMLAttr(request.RequestID), formatSAMLTime(now))
+	fmt.Fprintf(&response, `<saml:Issuer xmlns:saml="%s">%s</saml:Issuer>`, samlNamespaceAssertion, escapeXMLText(entityID))
+	response.WriteString(`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"></samlp:StatusCode></samlp:Status>`)
+	response.WriteString(assertionStart + issuerElement + signature + subject.String() + assertionEnd)
+	response.WriteString(`</samlp:Response>`)
+
+	return base64.StdEncoding.EncodeToString([]byte(response.String())), nil
+}
+
+func writeSAMLAttribute(b *strings.Builder, name string, values ...string) {
+	if len(values) == 0 || (len(values) == 1 && len(values[0]) == 0) {
+		return
+	}
+
+	fmt.Fprintf(b, `<saml:Attribute Name="%s" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:basic">`, name)
+	for _, value := range values {
+		fmt.Fprintf(b, `<saml:AttributeValue>%s</saml:AttributeValue>`, escapeXMLText(value))
+	}
+	b.WriteString(`</saml:Attribute>`)
+}
+
+// generateSAMLID creates a random id, which must not start with a digit
+func generateSAMLID() (string, error) {
+	id, err := generateRandomHex(20)
+	if err != nil {
+		return "", err
+	}
+	return "_" + id, nil
+}
+
+func formatSAMLTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// escapeXMLText escapes character data the way canonical XML does
+func escapeXMLText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(s)
+}
+
+// escapeXMLAttr escapes an attribute value the way canonical XML does
+func escapeXMLAttr(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;").Replace(s)
+}
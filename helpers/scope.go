@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"strings"
+
+	"github.com/pemiller/authentication/models"
+)
+
+// ParseScope splits a space delimited scope string into a list of scopes, removing duplicates
+func ParseScope(scope string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// FormatScope joins a list of scopes into a space delimited scope string
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// GetAccessTokenScopes returns the scopes granted to the AccessToken. Tokens that were not narrowed
+// when they were issued have the scopes of their AuthCode.
+func GetAccessTokenScopes(accessToken *models.AccessToken, authCode *models.AuthCode) []string {
+	if accessToken.Scopes != nil {
+		return accessToken.Scopes
+	}
+	return authCode.Scopes
+}
+
+// GetUndeclaredScope returns the first scope that the application has not declared, or an empty string
+// if the application may request all of them. The OpenID Connect scopes can always be requested.
+func GetUndeclaredScope(app *models.Application, scopes []string) string {
+	for _, scope := range scopes {
+		switch scope {
+		case models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile:
+			continue
+		}
+		if !HasScope(app.Scopes, scope) {
+			return scope
+		}
+	}
+	return ""
+}
+
+// NarrowScopes returns the requested scopes if every one of them was granted, or the granted scopes
+// when nothing was requested. False is returned if a requested scope was not granted.
+func NarrowScopes(granted, requested []string) ([]string, bool) {
+	if len(requested) == 0 {
+		return granted, true
+	}
+
+	for _, scope := range requested {
+		if !HasScope(granted, scope) {
+			return nil, false
+		}
+	}
+	return requested, true
+}
+
+// HasScope returns true if the scope is in the list of scopes
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package helpers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+// SigningAlgorithms are the algorithms a signing key is kept active for
+var SigningAlgorithms = []string{AlgorithmRS256, AlgorithmES256}
+
+// decrypted private keys by key id, so the master key is only used once per key and process
+var decryptedKeys sync.Map
+
+// GenerateSigningKey creates a new key pair for the algorithm with the private key encrypted by the master key
+func GenerateSigningKey(algorithm string) (*models.SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm (%s)", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := Encrypt(der)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := publicJWK(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	jwk.Kid = jwkThumbprint(jwk)
+	jwk.Alg = algorithm
+	jwk.Use = "sig"
+
+	return &models.SigningKey{
+		ID:                  jwk.Kid,
+		Algorithm:           algorithm,
+		Status:              models.SigningKeyStatusNext,
+		EncryptedPrivateKey: encrypted,
+		PublicKey:           jwk,
+		DateCreated:         time.Now().UTC(),
+	}, nil
+}
+
+// GetActiveSigningKey returns the active key for the algorithm, decrypted and ready to sign with
+func GetActiveSigningKey(c context.Context, algorithm string) (*SigningKey, error) {
+	keys, err := datastore.GetFromContext(c).GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if key.Algorithm == algorithm && key.Status == models.SigningKeyStatusActive {
+			return decryptSigningKey(key)
+		}
+	}
+
+	return nil, fmt.Errorf("no active signing key for %s", algorithm)
+}
+
+// GetPublishedJWKS returns the public keys of every next, active and retired signing key
+func GetPublishedJWKS(c context.Context) (*models.JWKSet, error) {
+	keys, err := datastore.GetFromContext(c).GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &models.JWKSet{Keys: []*models.JWK{}}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.PublicKey)
+	}
+
+	return set, nil
+}
+
+func decryptSigningKey(key *models.SigningKey) (*SigningKey, error) {
+	if cached, ok := decryptedKeys.Load(key.ID); ok {
+		return cached.(*SigningKey), nil
+	}
+
+	der, err := Decrypt(key.EncryptedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %s cannot sign", key.ID)
+	}
+
+	result := &SigningKey{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		Key:       signer,
+	}
+	decryptedKeys.Store(key.ID, result)
+	return result, nil
+}
@@ -0,0 +1,28 @@
+package helpers
+
+import (
+	"context"
+
+	"github.com/pemiller/authentication/datastore"
+)
+
+// SiteUnavailableMessage is the error description used when a token is requested for an unavailable site
+const SiteUnavailableMessage = "Site is unavailable"
+
+// SiteNotAllowedMessage is the error description used when an application requests a token for a site
+// outside its allowed sites
+const SiteNotAllowedMessage = "Application may not issue tokens for the site"
+
+// IsTokenSiteAvailable returns false if the site a token was issued for has been deleted or is not
+// available. Tokens without a site are not affected.
+func IsTokenSiteAvailable(c context.Context, siteID string) (bool, error) {
+	if len(siteID) == 0 {
+		return true, nil
+	}
+
+	site, err := datastore.GetFromContext(c).GetCurrentSite(siteID)
+	if err != nil || site == nil {
+		return false, err
+	}
+	return site.IsAvailable(), nil
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/pemiller/authentication/datastore"
+)
+
+// Start runs every scheduled job in the background
+func Start(store *datastore.Store) {
+	go schedule(store, "rotate signing keys", time.Minute, RotateSigningKeys)
+	go schedule(store, "refresh revocation list", 10*time.Second, (*datastore.Store).RefreshRevocationList)
+}
+
+// schedule runs the job on a fixed interval, logging any error it returns
+func schedule(store *datastore.Store, name string, interval time.Duration, job func(*datastore.Store) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := job(store)
+		if err != nil {
+			log.Printf("job %s failed: %v", name, err)
+		}
+	}
+}
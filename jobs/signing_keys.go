@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+// RotateSigningKeys keeps an active signing key for each algorithm. The next key is published one
+// overlap period before the active key reaches the rotation interval and is promoted once both have
+// passed. Retired keys are deleted once every token they signed has expired.
+func RotateSigningKeys(store *datastore.Store) error {
+	return withSigningKeyLock(store, func(keys []*models.SigningKey) error {
+		now := time.Now().UTC()
+
+		for _, algorithm := range helpers.SigningAlgorithms {
+			var active, next *models.SigningKey
+			for _, key := range keys {
+				if key.Algorithm != algorithm {
+					continue
+				}
+
+				switch key.Status {
+				case models.SigningKeyStatusActive:
+					active = key
+				case models.SigningKeyStatusNext:
+					next = key
+				case models.SigningKeyStatusRetired:
+					if key.DateRetired == nil || now.Sub(*key.DateRetired) > getRetiredKeyRetention() {
+						err := store.DeleteSigningKey(key.ID)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			// nothing can be signed without an active key so there is no need to wait for the overlap
+			if active == nil {
+				err := activateSigningKey(store, algorithm, nil, next, now)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			activeAge := now.Sub(*active.DateActivated)
+			if next == nil && activeAge >= config.KeyRotationInterval-config.KeyRotationOverlap {
+				key, err := helpers.GenerateSigningKey(algorithm)
+				if err != nil {
+					return err
+				}
+
+				err = store.UpsertSigningKey(key)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if next != nil && activeAge >= config.KeyRotationInterval && now.Sub(next.DateCreated) >= config.KeyRotationOverlap {
+				err := activateSigningKey(store, algorithm, active, next, now)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// RotateSigningKeysNow immediately replaces the active key for every algorithm, for use when a key
+// may have been compromised. The replaced keys are retired and stay published until they expire, or
+// are deleted straight away when compromised is set so the tokens they signed stop verifying.
+func RotateSigningKeysNow(store *datastore.Store, compromised bool) error {
+	return withSigningKeyLock(store, func(keys []*models.SigningKey) error {
+		now := time.Now().UTC()
+
+		for _, algorithm := range helpers.SigningAlgorithms {
+			var active *models.SigningKey
+			for _, key := range keys {
+				if key.Algorithm == algorithm && key.Status == models.SigningKeyStatusActive {
+					active = key
+				}
+			}
+
+			err := activateSigningKey(store, algorithm, active, nil, now)
+			if err != nil {
+				return err
+			}
+
+			if compromised && active != nil {
+				err = store.DeleteSigningKey(active.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// withSigningKeyLock runs fn with the current signing keys while holding the rotation lock.
+// If another instance holds the lock, fn is not run.
+func withSigningKeyLock(store *datastore.Store, fn func([]*models.SigningKey) error) error {
+	locked, err := store.LockSigningKeyRotation()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer store.UnlockSigningKeyRotation()
+
+	// another instance may have rotated the keys since they were cached
+	store.DeleteSigningKeysFromCache()
+	keys, err := store.GetSigningKeys()
+	if err != nil {
+		return err
+	}
+
+	return fn(keys)
+}
+
+// activateSigningKey retires the active key, if any, and activates the next key. A new key is
+// generated when there is no next key.
+func activateSigningKey(store *datastore.Store, algorithm string, active, next *models.SigningKey, now time.Time) error {
+	if next == nil {
+		key, err := helpers.GenerateSigningKey(algorithm)
+		if err != nil {
+			return err
+		}
+		next = key
+	}
+
+	next.Status = models.SigningKeyStatusActive
+	next.DateActivated = &now
+	err := store.UpsertSigningKey(next)
+	if err != nil {
+		return err
+	}
+
+	if active == nil {
+		return nil
+	}
+
+	active.Status = models.SigningKeyStatusRetired
+	active.DateRetired = &now
+	return store.UpsertSigningKey(active)
+}
+
+// getRetiredKeyRetention returns how long a retired key stays published. It is never shorter
+// than the lifetime of the tokens it signed.
+func getRetiredKeyRetention() time.Duration {
+	if config.AccessTokenTTL > config.KeyRotationOverlap {
+		return config.AccessTokenTTL
+	}
+
+	return config.KeyRotationOverlap
+}
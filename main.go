@@ -1,32 +1,74 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
 	"github.com/pemiller/authentication/handlers/routes"
+	"github.com/pemiller/authentication/jobs"
 	"github.com/pemiller/authentication/middleware"
+	"github.com/pemiller/authentication/models"
 
 	"github.com/gin-gonic/gin"
+	cache "github.com/patrickmn/go-cache"
 )
 
 func main() {
 	config.Parse()
 
+	store, err := datastore.NewStore(cache.New(5*time.Minute, 10*time.Minute), config.ServiceName, config.CouchbaseConnection)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// make sure there are active signing keys and a revocation list before serving any requests
+	err = jobs.RotateSigningKeys(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = store.RefreshRevocationList()
+	if err != nil {
+		log.Fatal(err)
+	}
+	jobs.Start(store)
+
 	r := gin.Default()
-	r.Use(middleware.SetupDataStore())
+	r.Use(middleware.SetupDataStore(store))
 	registerRoutes(r)
 
-	err := r.Run(config.Address)
+	server := &http.Server{Addr: config.Address, Handler: r}
+	if config.TLSCertFile != "" {
+		// client certificates are requested from every caller and checked against the application they claim to be
+		server.TLSConfig = &tls.Config{ClientAuth: tls.RequestClientCert}
+		err = server.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 func registerRoutes(e *gin.Engine) {
+	e.GET("/.well-known/openid-configuration", routes.GetOpenIDConfiguration)
+	e.GET("/.well-known/jwks.json", routes.GetJWKS)
+	e.GET("/userinfo", middleware.ProcessBearerToken, routes.GetUserInfo)
+	e.POST("/userinfo", middleware.ProcessBearerToken, routes.GetUserInfo)
+
+	e.GET("/federation/callback", routes.FederationCallback)
+
+	saml := e.Group("/saml")
+	saml.GET("/metadata", routes.GetSAMLMetadata)
+	saml.GET("/sso", routes.SAMLSingleSignOn)
+	saml.POST("/sso", routes.SAMLSingleSignOn)
+
 	api := e.Group("/api")
 
-	app := api.Group("/", middleware.ProcessApplicationHeader)
+	app := api.Group("/", middleware.VerifyRequestSignature, middleware.ProcessApplicationHeader)
 	app.POST("/code", routes.CreateAuthCode)
 	app.GET("/code", middleware.ProcessAuthCodeHeader, routes.GetAuthCode)
 	app.DELETE("/code", middleware.ProcessAuthCodeHeader, routes.DeleteAuthCode)
@@ -34,6 +76,95 @@ func registerRoutes(e *gin.Engine) {
 	app.POST("/token", middleware.ProcessAuthCodeHeader, routes.CreateAccessToken)
 	app.GET("/token", middleware.ProcessAccessTokenHeader, routes.GetAccessToken)
 	app.DELETE("/token", middleware.ProcessAccessTokenHeader, routes.DeleteAccessToken)
-	//TODO: restrict this to internal ips only
-	app.POST("/token/application", routes.CreateApplicationAccessToken)
+	app.POST("/token/refresh", routes.RefreshAccessToken)
+	app.DELETE("/user/sessions", middleware.ProcessAccessTokenHeader, routes.DeleteUserSessions)
+	app.GET("/device", middleware.ProcessAuthCodeHeader, routes.GetDeviceCode)
+	app.POST("/device", middleware.ProcessAuthCodeHeader, routes.VerifyDeviceCode)
+	app.POST("/saml/response", middleware.ProcessAuthCodeHeader, routes.CreateSAMLResponse)
+	app.POST("/authorization/response", middleware.ProcessAuthCodeHeader, routes.CreateAuthorizationResponse)
+	if !config.DisableApplicationHeaderToken {
+		// unauthenticated application tokens, superseded by the client_credentials grant
+		app.POST("/token/application", routes.CreateApplicationAccessToken)
+	}
+
+	app.GET("/application/secret", middleware.RequireClientSecret, routes.GetApplicationSecrets)
+	app.POST("/application/secret", middleware.RequireClientSecret, routes.CreateApplicationSecret)
+	app.DELETE("/application/secret/:id", middleware.RequireClientSecret, routes.DeleteApplicationSecret)
+	app.GET("/application/signing-key", middleware.RequireClientAuthentication, routes.GetApplicationSigningKeys)
+	app.POST("/application/signing-key", middleware.RequireClientAuthentication, routes.CreateApplicationSigningKey)
+	app.DELETE("/application/signing-key/:id", middleware.RequireClientAuthentication, routes.DeleteApplicationSigningKey)
+	app.GET("/application/policy", middleware.RequireClientAuthentication, routes.GetPolicy)
+	app.PUT("/application/policy", middleware.RequireClientAuthentication, routes.UpsertPolicy)
+	app.POST("/authorize", middleware.ProcessAccessTokenHeader, routes.Authorize)
+
+	// admin requests are authenticated by the admin principal rather than the application header
+	admin := api.Group("/admin", middleware.AuditAdminRequest, middleware.ProcessAdminPrincipal)
+	usersRead := middleware.RequireAdminPermission(models.AdminPermissionUsersRead)
+	usersWrite := middleware.RequireAdminPermission(models.AdminPermissionUsersWrite)
+	groupsRead := middleware.RequireAdminPermission(models.AdminPermissionGroupsRead)
+	groupsWrite := middleware.RequireAdminPermission(models.AdminPermissionGroupsWrite)
+	appsRead := middleware.RequireAdminPermission(models.AdminPermissionAppsRead)
+	appsWrite := middleware.RequireAdminPermission(models.AdminPermissionAppsWrite)
+	sitesRead := middleware.RequireAdminPermission(models.AdminPermissionSitesRead)
+	sitesWrite := middleware.RequireAdminPermission(models.AdminPermissionSitesWrite)
+	tenantsRead := middleware.RequireAdminPermission(models.AdminPermissionTenantsRead)
+	tenantsWrite := middleware.RequireAdminPermission(models.AdminPermissionTenantsWrite)
+	accountsRead := middleware.RequireAdminPermission(models.AdminPermissionServiceAccountsRead)
+	accountsWrite := middleware.RequireAdminPermission(models.AdminPermissionServiceAccountsWrite)
+
+	admin.DELETE("/user/:id/tokens", usersWrite, routes.DeleteUserTokens)
+	admin.PUT("/user/:id/admin", usersWrite, routes.UpdateUserAdmin)
+	admin.POST("/keys/rotate", middleware.RequireSuperAdmin, middleware.RequireAdminPermission(models.AdminPermissionKeysWrite), routes.RotateSigningKeys)
+	admin.PUT("/directory/:id", middleware.RequireSuperAdmin, middleware.RequireAdminPermission(models.AdminPermissionDirectoriesWrite), routes.UpsertDirectory)
+	admin.PUT("/federation/:id", middleware.RequireSuperAdmin, middleware.RequireAdminPermission(models.AdminPermissionFederationsWrite), routes.UpsertFederation)
+	admin.POST("/user/:id/impersonate", middleware.RequireAdminPermission(models.AdminPermissionUsersImpersonate), routes.ImpersonateUser)
+	admin.GET("/user/:id/roles", usersRead, routes.GetUserRoles)
+	admin.POST("/user/:id/roles", usersWrite, routes.AddUserRole)
+	admin.DELETE("/user/:id/roles", usersWrite, routes.DeleteUserRole)
+	admin.GET("/audit", middleware.RequireAdminPermission(models.AdminPermissionAuditRead), routes.GetAuditEvents)
+	admin.POST("/registration-token", appsWrite, routes.CreateInitialAccessToken)
+	admin.POST("/group", groupsWrite, routes.CreateGroup)
+	admin.GET("/group/:id", groupsRead, routes.GetGroup)
+	admin.PUT("/group/:id", groupsWrite, routes.UpdateGroup)
+	admin.DELETE("/group/:id", groupsWrite, routes.DeleteGroup)
+	admin.GET("/group/:id/members", groupsRead, routes.GetGroupMembers)
+	admin.PUT("/group/:id/members/:user_id", groupsWrite, routes.AddGroupMember)
+	admin.DELETE("/group/:id/members/:user_id", groupsWrite, routes.DeleteGroupMember)
+	admin.POST("/tenant", middleware.RequireSuperAdmin, tenantsWrite, routes.CreateTenant)
+	admin.GET("/tenant/:id", tenantsRead, routes.GetTenant)
+	admin.PUT("/tenant/:id", tenantsWrite, routes.UpdateTenant)
+	admin.GET("/application", appsRead, routes.ListApplications)
+	admin.POST("/application", appsWrite, routes.CreateApplication)
+	admin.GET("/application/:id", appsRead, routes.GetApplication)
+	admin.PUT("/application/:id", appsWrite, routes.UpdateApplication)
+	admin.DELETE("/application/:id", appsWrite, routes.DeleteApplication)
+	admin.POST("/application/:id/secret", appsWrite, routes.CreateAdminApplicationSecret)
+	admin.POST("/application/:id/signing-key", appsWrite, routes.CreateAdminApplicationSigningKey)
+	admin.GET("/application/:id/policy", appsRead, routes.GetAdminPolicy)
+	admin.PUT("/application/:id/policy", appsWrite, routes.UpsertAdminPolicy)
+	admin.GET("/site", sitesRead, routes.ListSites)
+	admin.POST("/site", sitesWrite, routes.CreateSite)
+	admin.GET("/site/:id", sitesRead, routes.GetSite)
+	admin.PUT("/site/:id", sitesWrite, routes.UpdateSite)
+	admin.DELETE("/site/:id", sitesWrite, routes.DeleteSite)
+	admin.GET("/service-account", accountsRead, routes.ListServiceAccounts)
+	admin.POST("/service-account", accountsWrite, routes.CreateServiceAccount)
+	admin.GET("/service-account/:id", accountsRead, routes.GetServiceAccount)
+	admin.PUT("/service-account/:id", accountsWrite, routes.UpdateServiceAccount)
+	admin.DELETE("/service-account/:id", accountsWrite, routes.DeleteServiceAccount)
+	admin.POST("/service-account/:id/key", accountsWrite, routes.RotateServiceAccountKey)
+
+	oauth := e.Group("/oauth")
+	oauth.GET("/authorize", routes.StartAuthorization)
+	oauth.POST("/authorize", routes.StartAuthorization)
+	oauth.POST("/token", middleware.ProcessClientCredentials, routes.CreateOAuthToken)
+	oauth.POST("/device_authorization", middleware.ProcessClientCredentials, routes.CreateDeviceCode)
+	oauth.POST("/introspect", middleware.ProcessClientCredentials, middleware.RequireConfidentialClient, routes.IntrospectToken)
+	oauth.POST("/revoke", middleware.ProcessClientCredentials, routes.RevokeToken)
+	oauth.GET("/revoked", middleware.ProcessClientCredentials, middleware.RequireConfidentialClient, routes.GetRevokedTokens)
+	oauth.POST("/permission", middleware.ProcessClientCredentials, middleware.RequireConfidentialClient, routes.CheckPermission)
+	oauth.POST("/register", routes.RegisterClient)
+	oauth.GET("/register/:client_id", routes.GetClientRegistration)
+	oauth.PUT("/register/:client_id", routes.UpdateClientRegistration)
+	oauth.DELETE("/register/:client_id", routes.DeleteClientRegistration)
 }
@@ -3,6 +3,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -16,44 +17,100 @@ const AccessTokenHeaderKey = "X-Access-Token"
 const accessTokenContextKey = "access_token"
 
 // ProcessAccessTokenHeader checks if the access token header is set in the request with auth type "Token"
-// and if so, gets the AccessToken object for that key from the datastore and inserts it into the context
+// or "Bearer" and if so, gets the AccessToken object for that key from the datastore and inserts it into the context
 func ProcessAccessTokenHeader(c *gin.Context) {
+	accessToken, authCode, ok := loadAccessToken(c)
+	if !ok {
+		return
+	}
+
+	app := GetApplication(c)
+	if app.ID != authCode.ApplicationID {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("AuthCode did not match application", nil))
+		return
+	}
+
+	c.Set(authCodeContextKey, authCode)
+	c.Set(accessTokenContextKey, accessToken)
+	c.Header(AccessTokenHeaderKey, accessToken.Token)
+	c.Next()
+}
+
+// ProcessBearerToken works like ProcessAccessTokenHeader for endpoints such as userinfo that are
+// called without the application header, so the token is not matched to an application
+func ProcessBearerToken(c *gin.Context) {
+	accessToken, authCode, ok := loadAccessToken(c)
+	if !ok {
+		return
+	}
+
+	c.Set(authCodeContextKey, authCode)
+	c.Set(accessTokenContextKey, accessToken)
+	c.Next()
+}
+
+// loadAccessToken gets the AccessToken in the authorization header and the AuthCode it was created from.
+// The request is aborted and false is returned if either cannot be found.
+func loadAccessToken(c *gin.Context) (*models.AccessToken, *models.AuthCode, bool) {
 	token, err := helpers.ParseAuthorizationHeader(c.Request, helpers.AuthTypeToken)
+	if len(token) == 0 {
+		token, err = helpers.ParseAuthorizationHeader(c.Request, helpers.AuthTypeBearer)
+	}
 	if len(token) == 0 {
 		c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse(fmt.Sprintf("Request header is missing authorization with type %s", helpers.AuthTypeToken), nil))
-		return
+		return nil, nil, false
+	}
+
+	// JWT access tokens carry everything needed in their claims so there is no datastore lookup
+	if helpers.IsJWT(token) {
+		accessToken, authCode, err := helpers.ParseAccessTokenJWT(c, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to verify AccessToken", err))
+			return nil, nil, false
+		}
+		if accessToken == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Invalid AccessToken", nil))
+			return nil, nil, false
+		}
+
+		return accessToken, authCode, true
 	}
 
 	accessToken, err := datastore.GetFromContext(c).GetAccessToken(token)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get AccessToken", err))
-		return
+		return nil, nil, false
 	}
 	if accessToken == nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Cannot find AccessToken", nil))
-		return
+		return nil, nil, false
+	}
+	if !accessToken.DateExpires.IsZero() && accessToken.DateExpires.Before(time.Now().UTC()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("AccessToken has expired", nil))
+		return nil, nil, false
+	}
+
+	available, err := helpers.IsTokenSiteAvailable(c, accessToken.SiteID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get site", err))
+		return nil, nil, false
+	}
+	if !available {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse(helpers.SiteUnavailableMessage, nil))
+		return nil, nil, false
 	}
 
 	authCode, err := datastore.GetFromContext(c).GetAuthCode(accessToken.AuthCode)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get AuthCode", err))
-		return
+		return nil, nil, false
 	}
 	if authCode == nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Cannot find AuthCode", nil))
-		return
-	}
-
-	app := GetApplication(c)
-	if app.ID != authCode.ApplicationID {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("AuthCode did not match application", nil))
-		return
+		return nil, nil, false
 	}
 
-	c.Set(authCodeContextKey, authCode)
-	c.Set(accessTokenContextKey, accessToken)
-	c.Header(AccessTokenHeaderKey, accessToken.Token)
-	c.Next()
+	return accessToken, authCode, true
 }
 
 // GetAccessToken gets the AccessToken object from the context
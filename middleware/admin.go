@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+const adminContextKey = "admin"
+
+// ProcessAdminPrincipal authenticates the administrator making an admin API request and inserts the
+// AdminPrincipal into the context. Service accounts send an admin API key with auth type "ApiKey",
+// admin users send their access token like ProcessAccessTokenHeader. The application of a user's
+// token is inserted into the context, so the X-Application header is not needed.
+func ProcessAdminPrincipal(c *gin.Context) {
+	var principal *models.AdminPrincipal
+	var ok bool
+	if key, _ := helpers.ParseAuthorizationHeader(c.Request, helpers.AuthTypeAPIKey); len(key) > 0 {
+		principal, ok = loadServiceAccountPrincipal(c, key)
+	} else {
+		principal, ok = loadUserPrincipal(c)
+	}
+	if !ok {
+		return
+	}
+
+	c.Set(adminContextKey, principal)
+	c.Next()
+}
+
+// loadServiceAccountPrincipal gets the ServiceAccount of the admin API key. The request is aborted
+// and false is returned if the key is not valid.
+func loadServiceAccountPrincipal(c *gin.Context, key string) (*models.AdminPrincipal, bool) {
+	id, secret := helpers.ParseAPIKey(key)
+	if len(id) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Invalid API key", nil))
+		return nil, false
+	}
+
+	account, err := datastore.GetFromContext(c).GetServiceAccount(id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get service account", err))
+		return nil, false
+	}
+	if !helpers.TestAPIKey(account, secret) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Invalid API key", nil))
+		return nil, false
+	}
+
+	return &models.AdminPrincipal{
+		ID:          account.ID,
+		Type:        models.AdminPrincipalTypeServiceAccount,
+		TenantID:    account.TenantID,
+		Permissions: account.Permissions,
+	}, true
+}
+
+// loadUserPrincipal gets the user who owns the access token in the authorization header, who must be an
+// administrator. The request is aborted and false is returned if they are not.
+func loadUserPrincipal(c *gin.Context) (*models.AdminPrincipal, bool) {
+	accessToken, authCode, ok := loadAccessToken(c)
+	if !ok {
+		return nil, false
+	}
+	if len(authCode.UserID) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Admin access requires a user token", nil))
+		return nil, false
+	}
+	if len(accessToken.ImpersonatorID) > 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Admin access is not allowed while impersonating", nil))
+		return nil, false
+	}
+
+	store := datastore.GetFromContext(c)
+	app, err := store.GetApplication(authCode.ApplicationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Error getting application from datastore", err))
+		return nil, false
+	}
+	if app == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Cannot find application", nil))
+		return nil, false
+	}
+	// clients that still send the application header must send the application of the token
+	if header := c.Request.Header.Get(applicationHeaderKey); len(header) > 0 && header != app.ID {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("AuthCode did not match application", nil))
+		return nil, false
+	}
+
+	user, err := store.GetUser(authCode.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get user", err))
+		return nil, false
+	}
+	if user == nil || !user.IsAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Admin access required", nil))
+		return nil, false
+	}
+
+	c.Set(applicationContextKey, app)
+	c.Set(authCodeContextKey, authCode)
+	c.Set(accessTokenContextKey, accessToken)
+	return &models.AdminPrincipal{
+		ID:          user.ID,
+		Type:        models.AdminPrincipalTypeUser,
+		TenantID:    user.TenantID,
+		Permissions: user.AdminPermissions,
+	}, true
+}
+
+// RequireAdminPermission returns a handler that checks the administrator in the context was granted
+// the permission. It must run after ProcessAdminPrincipal.
+func RequireAdminPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetAdmin(c).HasPermission(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Admin permission required ("+permission+")", nil))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSuperAdmin checks that the administrator in the context does not belong to a tenant.
+// It is used for settings shared by every tenant and must run after ProcessAdminPrincipal.
+func RequireSuperAdmin(c *gin.Context) {
+	if !GetAdmin(c).IsSuperAdmin() {
+		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Super admin access required", nil))
+		return
+	}
+
+	c.Next()
+}
+
+// GetAdmin gets the administrator from the context
+func GetAdmin(c *gin.Context) *models.AdminPrincipal {
+	result, _ := c.Value(adminContextKey).(*models.AdminPrincipal)
+	return result
+}
+
+// CanAdminTenant returns true if the administrator in the context may manage the tenant. Super admins
+// may manage every tenant, other admins only their own.
+func CanAdminTenant(c *gin.Context, tenantID string) bool {
+	admin := GetAdmin(c)
+	return admin != nil && (admin.IsSuperAdmin() || admin.TenantID == tenantID)
+}
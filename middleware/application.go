@@ -14,8 +14,15 @@ import (
 const applicationHeaderKey = "X-Application"
 const applicationContextKey = "application"
 
+// ClientAssertionHeaderKey carries the private_key_jwt assertion of applications that require one
+const ClientAssertionHeaderKey = "X-Client-Assertion"
+
+// ClientSecretHeaderKey carries the client secret of applications registered for a secret method
+const ClientSecretHeaderKey = "X-Client-Secret"
+
 // ProcessApplicationHeader checks if the application header is set in the request and if so,
-// gets the application object for that key from the datastore and inserts it into the context
+// gets the application object for that key from the datastore and inserts it into the context.
+// Applications with a token_endpoint_auth_method must also authenticate with it.
 func ProcessApplicationHeader(c *gin.Context) {
 	headerValue := c.Request.Header.Get(applicationHeaderKey)
 	if len(headerValue) == 0 {
@@ -26,16 +33,44 @@ func ProcessApplicationHeader(c *gin.Context) {
 	app, err := datastore.GetFromContext(c).GetApplication(headerValue)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Error getting application from datastore", err))
+		return
 	}
 	if app == nil {
 		c.AbortWithStatusJSON(http.StatusForbidden, helpers.PrepareErrorResponse("Cannot find application", nil))
 		return
 	}
 
+	ok, err := authenticateApplication(c, app)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Error getting client secrets from datastore", err))
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Application authentication failed", nil))
+		return
+	}
+
 	c.Set(applicationContextKey, app)
+	c.Set(clientAuthMethodContextKey, app.TokenEndpointAuthMethod)
 	c.Next()
 }
 
+// authenticateApplication checks the secret, certificate or assertion required by the application's
+// token_endpoint_auth_method. Applications without one and public clients only send the header.
+func authenticateApplication(c *gin.Context, app *models.Application) (bool, error) {
+	switch app.TokenEndpointAuthMethod {
+	case "", models.ClientAuthMethodNone:
+		return true, nil
+	case models.ClientAuthMethodSecretBasic, models.ClientAuthMethodSecretPost:
+		return testClientSecret(c, app, c.Request.Header.Get(ClientSecretHeaderKey))
+	case models.ClientAuthMethodPrivateKeyJWT:
+		issuer := helpers.GetIssuer(c.Request)
+		return helpers.VerifyClientAssertion(c, app, c.Request.Header.Get(ClientAssertionHeaderKey), []string{issuer, issuer + "/api"}) == nil, nil
+	default:
+		return helpers.VerifyClientCertificate(c.Request, app) == nil, nil
+	}
+}
+
 // GetApplication gets the Application object from the context
 func GetApplication(c *gin.Context) *models.Application {
 	result, _ := c.Value(applicationContextKey).(*models.Application)
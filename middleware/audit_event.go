@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/models"
+)
+
+const auditRecordedContextKey = "audit_recorded"
+
+// AuditAdminRequest saves an AuditEvent for every admin API request, including reads and requests
+// that were denied. Requests whose handler saved a more detailed event are not saved twice. It must
+// run before ProcessAdminPrincipal, so requests rejected there are saved without an administrator.
+func AuditAdminRequest(c *gin.Context) {
+	c.Next()
+
+	if _, recorded := c.Get(auditRecordedContextKey); recorded {
+		return
+	}
+
+	status := c.Writer.Status()
+	action := models.AuditActionAdminRequest
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		action = models.AuditActionAdminDenied
+	}
+
+	// the response has been written, so a failure can only be logged
+	err := RecordAuditEvent(c, &models.AuditEvent{
+		Action: action,
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+		Status: status,
+	})
+	if err != nil {
+		log.Printf("unable to save audit event for %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+}
+
+// RecordAuditEvent saves the AuditEvent for the administrator and application making the request. The
+// event belongs to the administrator's tenant unless the caller set it. Events of requests that were
+// not authenticated have no administrator.
+func RecordAuditEvent(c *gin.Context, event *models.AuditEvent) error {
+	event.ID = uuid.New().String()
+	if admin := GetAdmin(c); admin != nil {
+		event.AdminID = admin.ID
+		event.AdminType = admin.Type
+		if len(event.TenantID) == 0 {
+			event.TenantID = admin.TenantID
+		}
+	}
+	if app := GetApplication(c); app != nil {
+		event.ApplicationID = app.ID
+	}
+	event.IP = c.ClientIP()
+	event.DateCreated = time.Now().UTC()
+
+	err := datastore.GetFromContext(c).InsertAuditEvent(event)
+	if err != nil {
+		return err
+	}
+
+	c.Set(auditRecordedContextKey, true)
+	return nil
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+const clientAuthMethodContextKey = "client_auth_method"
+
+// ProcessClientCredentials authenticates the client using client_secret_basic, client_secret_post,
+// a TLS client certificate or a private_key_jwt assertion and, if successful, inserts the Application
+// object into the context. Public clients registered with the "none" method only need to send their client_id.
+func ProcessClientCredentials(c *gin.Context) {
+	clientID, credential, method := getClientCredentials(c)
+	if len(clientID) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidClient, "Client authentication is missing"))
+		return
+	}
+
+	app, err := datastore.GetFromContext(c).GetApplication(clientID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Error getting application from datastore"))
+		return
+	}
+	if app == nil {
+		abortInvalidClient(c, method)
+		return
+	}
+
+	// a client_id without a secret is either a public client or a client authenticating with its certificate
+	if len(credential) == 0 && method == models.ClientAuthMethodSecretPost {
+		method = models.ClientAuthMethodNone
+		if app.TokenEndpointAuthMethod == models.ClientAuthMethodTLS || app.TokenEndpointAuthMethod == models.ClientAuthMethodSelfSignedTLS {
+			method = app.TokenEndpointAuthMethod
+		}
+	}
+
+	ok, err := authenticateClient(c, app, credential, method)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorServerError, "Error getting client secrets from datastore"))
+		return
+	}
+	if !ok {
+		abortInvalidClient(c, method)
+		return
+	}
+
+	c.Set(applicationContextKey, app)
+	c.Set(clientAuthMethodContextKey, method)
+	c.Next()
+}
+
+// RequireConfidentialClient rejects public clients that did not authenticate with a credential.
+// It must run after ProcessClientCredentials.
+func RequireConfidentialClient(c *gin.Context) {
+	if GetClientAuthMethod(c) == models.ClientAuthMethodNone {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidClient, "Client authentication is required"))
+		return
+	}
+
+	c.Next()
+}
+
+// GetClientAuthMethod gets the method the client authenticated with from the context
+func GetClientAuthMethod(c *gin.Context) string {
+	result, _ := c.Value(clientAuthMethodContextKey).(string)
+	return result
+}
+
+// RequireClientSecret requires the Application already in the context to authenticate with one of
+// its client secrets. An application without a secret is given its first one through the admin API.
+func RequireClientSecret(c *gin.Context) {
+	app := GetApplication(c)
+
+	secrets, err := datastore.GetFromContext(c).GetApplicationSecrets(app.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Error getting client secrets from datastore", err))
+		return
+	}
+
+	clientID, clientSecret, _ := getClientCredentials(c)
+	if clientID != app.ID || !helpers.TestClientSecret(secrets, clientSecret) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Invalid client credentials", nil))
+		return
+	}
+
+	c.Next()
+}
+
+// RequireClientAuthentication requires the Application already in the context to have proven its
+// identity with the method it is registered for, or else with one of its client secrets. It must run
+// after ProcessApplicationHeader.
+func RequireClientAuthentication(c *gin.Context) {
+	switch GetClientAuthMethod(c) {
+	case "", models.ClientAuthMethodNone:
+		RequireClientSecret(c)
+	default:
+		c.Next()
+	}
+}
+
+// getClientCredentials returns the client id, secret and authentication method used in the request.
+// The basic authorization header takes precedence over credentials in the form body.
+func getClientCredentials(c *gin.Context) (string, string, string) {
+	headerValue, err := helpers.ParseAuthorizationHeader(c.Request, helpers.AuthTypeBasic)
+	if err == nil {
+		username, password, err := helpers.DecodeBasicCredentials(headerValue)
+		if err != nil {
+			return "", "", models.ClientAuthMethodSecretBasic
+		}
+
+		// RFC 6749 section 2.3.1 requires the values to be form encoded before they are base64 encoded
+		clientID, err := url.QueryUnescape(username)
+		if err != nil {
+			return "", "", models.ClientAuthMethodSecretBasic
+		}
+		clientSecret, err := url.QueryUnescape(password)
+		if err != nil {
+			return "", "", models.ClientAuthMethodSecretBasic
+		}
+
+		return clientID, clientSecret, models.ClientAuthMethodSecretBasic
+	}
+
+	if c.PostForm("client_assertion_type") == models.ClientAssertionTypeJWTBearer {
+		assertion := c.PostForm("client_assertion")
+		clientID := c.PostForm("client_id")
+		if len(clientID) == 0 {
+			clientID = helpers.GetClientAssertionIssuer(assertion)
+		}
+		return clientID, assertion, models.ClientAuthMethodPrivateKeyJWT
+	}
+
+	return c.PostForm("client_id"), c.PostForm("client_secret"), models.ClientAuthMethodSecretPost
+}
+
+// authenticateClient checks the credential with the method the client used, which must be the method
+// registered for the application. Applications without a method may use either secret method.
+func authenticateClient(c *gin.Context, app *models.Application, credential, method string) (bool, error) {
+	if len(app.TokenEndpointAuthMethod) > 0 && method != app.TokenEndpointAuthMethod {
+		return false, nil
+	}
+
+	switch method {
+	case models.ClientAuthMethodNone:
+		return app.TokenEndpointAuthMethod == models.ClientAuthMethodNone, nil
+	case models.ClientAuthMethodTLS, models.ClientAuthMethodSelfSignedTLS:
+		return helpers.VerifyClientCertificate(c.Request, app) == nil, nil
+	case models.ClientAuthMethodPrivateKeyJWT:
+		issuer := helpers.GetIssuer(c.Request)
+		return helpers.VerifyClientAssertion(c, app, credential, []string{issuer, issuer + c.Request.URL.Path}) == nil, nil
+	default:
+		return testClientSecret(c, app, credential)
+	}
+}
+
+func testClientSecret(c *gin.Context, app *models.Application, clientSecret string) (bool, error) {
+	secrets, err := datastore.GetFromContext(c).GetApplicationSecrets(app.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return helpers.TestClientSecret(secrets, clientSecret), nil
+}
+
+func abortInvalidClient(c *gin.Context, method string) {
+	if method == models.ClientAuthMethodSecretBasic {
+		c.Header("WWW-Authenticate", `Basic realm="`+config.ServiceName+`"`)
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareOAuthErrorResponse(helpers.OAuthErrorInvalidClient, "Client authentication failed"))
+}
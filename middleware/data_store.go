@@ -1,27 +1,15 @@
 package middleware
 
 import (
-	"log"
-	"time"
-
-	"github.com/pemiller/authentication/config"
 	"github.com/pemiller/authentication/datastore"
 
 	"github.com/gin-gonic/gin"
-	cache "github.com/patrickmn/go-cache"
 )
 
-// SetupDataStore creates a Store struct that contains pointers to the couchbase document store
-// and the cache service and then puts it in the context
-func SetupDataStore() gin.HandlerFunc {
-	cache := cache.New(5*time.Minute, 10*time.Minute)
-
+// SetupDataStore puts the Store in the context of every request. The same Store is used for every
+// request, so its cache and revocation list are shared.
+func SetupDataStore(store *datastore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		store, err := datastore.NewStore(cache, config.ServiceName, config.CouchbaseConnection)
-		if err != nil {
-			log.Fatal(err)
-		}
-
 		c.Set(datastore.ContextKey, store)
 		c.Next()
 	}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pemiller/authentication/datastore"
+
+	"github.com/couchbase/gocb"
+	"github.com/gin-gonic/gin"
+	cache "github.com/patrickmn/go-cache"
+)
+
+// testBucket keeps documents in memory as JSON. Methods the tests do not use are left to the
+// embedded interface and panic.
+type testBucket struct {
+	datastore.Bucket
+	documents map[string][]byte
+}
+
+func newTestStore() (*datastore.Store, *testBucket) {
+	bucket := &testBucket{documents: map[string][]byte{}}
+	return datastore.NewStoreWithBucket(cache.New(time.Minute, time.Minute), bucket, "test"), bucket
+}
+
+func (b *testBucket) Get(key string, valuePtr interface{}) (gocb.Cas, error) {
+	data, found := b.documents[key]
+	if !found {
+		return 0, gocb.ErrKeyNotFound
+	}
+	return 1, json.Unmarshal(data, valuePtr)
+}
+
+func (b *testBucket) Insert(key string, value interface{}, expiry uint32) (gocb.Cas, error) {
+	if _, found := b.documents[key]; found {
+		return 0, gocb.ErrKeyExists
+	}
+	return b.Upsert(key, value, expiry)
+}
+
+func (b *testBucket) Upsert(key string, value interface{}, expiry uint32) (gocb.Cas, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	b.documents[key] = data
+	return 1, nil
+}
+
+func TestSetupDataStoreSharesRevocations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, bucket := newTestStore()
+
+	r := gin.New()
+	r.Use(SetupDataStore(store))
+	r.DELETE("/token/:id", func(c *gin.Context) {
+		err := datastore.GetFromContext(c).RevokeJWTID(c.Param("id"), time.Now().UTC().Add(time.Hour))
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/token/:id", func(c *gin.Context) {
+		if datastore.GetFromContext(c).IsJWTRevoked(c.Param("id"), "application", "site", time.Now().UTC()) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	request := func(method, path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	if code := request(http.MethodGet, "/token/jwt-id"); code != http.StatusOK {
+		t.Fatalf("expected the token to be accepted before it is revoked, got %d", code)
+	}
+	if code := request(http.MethodDelete, "/token/jwt-id"); code != http.StatusNoContent {
+		t.Fatalf("expected the token to be revoked, got %d", code)
+	}
+	if code := request(http.MethodGet, "/token/jwt-id"); code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked token to be rejected on the next request, got %d", code)
+	}
+	if code := request(http.MethodGet, "/token/other-id"); code != http.StatusOK {
+		t.Errorf("expected other tokens to be accepted, got %d", code)
+	}
+	if len(bucket.documents) != 1 {
+		t.Errorf("expected the revoked token to be saved, got %d documents", len(bucket.documents))
+	}
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/datastore"
+	"github.com/pemiller/authentication/helpers"
+)
+
+// Headers of a signed request
+const (
+	SignatureHeaderKey          = "X-Signature"
+	SignatureKeyIDHeaderKey     = "X-Signature-Key-ID"
+	SignatureTimestampHeaderKey = "X-Signature-Timestamp"
+	SignatureNonceHeaderKey     = "X-Signature-Nonce"
+)
+
+// maxSignatureClockSkew is how far the timestamp of a signed request may be from the current time.
+// Nonces are kept for longer than this so a replay is always detected.
+const maxSignatureClockSkew = 5 * time.Minute
+
+// VerifyRequestSignature checks the HMAC signature of a request from the application in the X-Application
+// header. Unsigned requests are passed on unless the application requires signed requests. It must run
+// before ProcessApplicationHeader.
+func VerifyRequestSignature(c *gin.Context) {
+	appID := c.Request.Header.Get(applicationHeaderKey)
+	if len(appID) == 0 {
+		c.Next()
+		return
+	}
+
+	signature := c.Request.Header.Get(SignatureHeaderKey)
+	if len(signature) == 0 {
+		app, err := datastore.GetFromContext(c).GetApplication(appID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Error getting application from datastore", err))
+			return
+		}
+		if app != nil && app.RequireSignedRequests {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Request signature is required", nil))
+			return
+		}
+
+		c.Next()
+		return
+	}
+
+	timestamp := c.Request.Header.Get(SignatureTimestampHeaderKey)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Invalid request signature timestamp", nil))
+		return
+	}
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > maxSignatureClockSkew || skew < -maxSignatureClockSkew {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Request signature has expired", nil))
+		return
+	}
+
+	nonce := c.Request.Header.Get(SignatureNonceHeaderKey)
+	if len(nonce) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Request signature is missing a nonce", nil))
+		return
+	}
+
+	secret, err := getRequestSigningSecret(c, appID, c.Request.Header.Get(SignatureKeyIDHeaderKey))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to get signing key", err))
+		return
+	}
+	if secret == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Unknown signing key", nil))
+		return
+	}
+
+	// the body is read to hash it and then put back for the handlers, up to the configured size so a
+	// large body cannot use up memory before the signature is checked
+	var body []byte
+	if c.Request.Body != nil {
+		body, err = ioutil.ReadAll(io.LimitReader(c.Request.Body, config.MaxSignedRequestBody+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, helpers.PrepareErrorResponse("Unable to read body", err))
+			return
+		}
+		if int64(len(body)) > config.MaxSignedRequestBody {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, helpers.PrepareErrorResponse("Signed request body is too large", nil))
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	signingString := helpers.BuildRequestSigningString(c.Request.Method, c.Request.URL.RequestURI(), body, timestamp, nonce, appID)
+	if !helpers.TestRequestSignature(secret, signingString, signature) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Invalid request signature", nil))
+		return
+	}
+
+	// the nonce is only recorded once the signature is valid, so it cannot be used up by someone else
+	ok, err := datastore.GetFromContext(c).UseRequestNonce(appID, nonce)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, helpers.PrepareErrorResponse("Unable to save request nonce", err))
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, helpers.PrepareErrorResponse("Request has already been used", nil))
+		return
+	}
+
+	c.Next()
+}
+
+// getRequestSigningSecret returns the decrypted signing secret defined by the id, or nil if the
+// application has no such key
+func getRequestSigningSecret(c *gin.Context, appID, keyID string) ([]byte, error) {
+	keys, err := datastore.GetFromContext(c).GetApplicationSigningKeys(appID)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+
+	for _, key := range keys.Keys {
+		if key.ID == keyID {
+			return helpers.Decrypt(key.EncryptedSecret)
+		}
+	}
+
+	return nil, nil
+}
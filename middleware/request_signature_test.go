@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pemiller/authentication/config"
+	"github.com/pemiller/authentication/helpers"
+	"github.com/pemiller/authentication/models"
+)
+
+func TestVerifyRequestSignatureBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+	config.MaxSignedRequestBody = 16
+
+	secret := []byte("signing-secret")
+	encrypted, err := helpers.Encrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, bucket := newTestStore()
+	bucket.Upsert(store.GetApplicationSigningKeysKey("application"), &models.ApplicationSigningKeys{
+		ApplicationID: "application",
+		Keys:          []*models.ApplicationSigningKey{{ID: "key", EncryptedSecret: encrypted}},
+	}, 0)
+
+	r := gin.New()
+	r.Use(SetupDataStore(store))
+	r.POST("/api/token", VerifyRequestSignature, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"body within the limit", "0123456789abcdef", http.StatusOK},
+		{"body over the limit", "0123456789abcdefg", http.StatusRequestEntityTooLarge},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := "nonce-" + strconv.Itoa(i)
+			signingString := helpers.BuildRequestSigningString(http.MethodPost, "/api/token", []byte(test.body), timestamp, nonce, "application")
+
+			request := httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader(test.body))
+			request.Header.Set(applicationHeaderKey, "application")
+			request.Header.Set(SignatureHeaderKey, helpers.SignRequest(secret, signingString))
+			request.Header.Set(SignatureKeyIDHeaderKey, "key")
+			request.Header.Set(SignatureTimestampHeaderKey, timestamp)
+			request.Header.Set(SignatureNonceHeaderKey, nonce)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			if w.Code != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, w.Code)
+			}
+		})
+	}
+}
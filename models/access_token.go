@@ -4,12 +4,20 @@ import "time"
 
 // AccessToken ...
 type AccessToken struct {
-	Token         string          `json:"token"`
-	Type          AccessTokenType `json:"type"`
-	ApplicationID string          `json:"application_id"`
-	AuthCode      string          `json:"auth_code"`
-	SiteID        string          `json:"site_id"`
-	DateCreated   time.Time       `json:"date_created"`
+	Token          string          `json:"token"`
+	JWTID          string          `json:"jwt_id,omitempty"`
+	Type           AccessTokenType `json:"type"`
+	ApplicationID  string          `json:"application_id"`
+	UserID         string          `json:"user_id,omitempty"`
+	AuthCode       string          `json:"auth_code"`
+	SiteID         string          `json:"site_id"`
+	FamilyID       string          `json:"family_id,omitempty"`
+	Scopes         []string        `json:"scopes,omitempty"`
+	Roles          []string        `json:"roles,omitempty"`
+	Actor          *Actor          `json:"act,omitempty"`
+	ImpersonatorID string          `json:"impersonator_id,omitempty"`
+	DateCreated    time.Time       `json:"date_created"`
+	DateExpires    time.Time       `json:"date_expires"`
 }
 
 // AccessTokenType is a specific string type
@@ -0,0 +1,21 @@
+package models
+
+// AccessTokenClaims are the claims in a JWT access token
+type AccessTokenClaims struct {
+	Issuer         string          `json:"iss"`
+	Subject        string          `json:"sub"`
+	Audience       string          `json:"aud"`
+	Expires        int64           `json:"exp"`
+	IssuedAt       int64           `json:"iat"`
+	JWTID          string          `json:"jti"`
+	ClientID       string          `json:"client_id"`
+	Type           AccessTokenType `json:"token_type"`
+	Email          string          `json:"email,omitempty"`
+	SiteID         string          `json:"site_id"`
+	AuthType       AuthTypeValue   `json:"auth_type"`
+	FamilyID       string          `json:"family_id,omitempty"`
+	Scope          string          `json:"scope,omitempty"`
+	Roles          []string        `json:"roles,omitempty"`
+	Actor          *Actor          `json:"act,omitempty"`
+	ImpersonatorID string          `json:"impersonator_id,omitempty"`
+}
@@ -5,6 +5,9 @@ import "time"
 // AccessTokenDetailed ...
 type AccessTokenDetailed struct {
 	Token               string        `json:"token"`
+	RefreshToken        string        `json:"refresh_token,omitempty"`
+	IDToken             string        `json:"id_token,omitempty"`
+	DateExpires         time.Time     `json:"date_expires"`
 	UserID              string        `json:"user_id"`
 	Email               string        `json:"email"`
 	IsValidated         bool          `json:"is_validated"`
@@ -13,4 +16,7 @@ type AccessTokenDetailed struct {
 	Status              LoginStatus   `json:"status"`
 	AuthType            AuthTypeValue `json:"auth_type"`
 	Application         *Application  `json:"application"`
+	Scopes              []string      `json:"scopes,omitempty"`
+	Roles               []string      `json:"roles,omitempty"`
+	ImpersonatorID      string        `json:"impersonator_id,omitempty"`
 }
@@ -0,0 +1,12 @@
+package models
+
+// Actor is the party acting on behalf of the subject of a token (RFC 8693 section 4.1). A token that
+// has been exchanged more than once nests the earlier actors.
+type Actor struct {
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+// TokenTypeAccessToken is the token type identifier of access tokens (RFC 8693 section 3)
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
@@ -0,0 +1,84 @@
+package models
+
+import "strings"
+
+// AdminPrincipal is the administrator making an admin API request, either a user flagged as an admin
+// or a service account authenticated with an admin API key
+type AdminPrincipal struct {
+	ID          string             `json:"id"`
+	Type        AdminPrincipalType `json:"type"`
+	TenantID    string             `json:"tenant_id,omitempty"`
+	Permissions []string           `json:"permissions"`
+}
+
+// AdminPrincipalType is a specific string type
+type AdminPrincipalType string
+
+// Possible types of admin principals represented as strings
+const (
+	AdminPrincipalTypeUser           AdminPrincipalType = "User"
+	AdminPrincipalTypeServiceAccount AdminPrincipalType = "ServiceAccount"
+)
+
+// Admin API permissions. Each write permission also grants the matching read permission and the
+// wildcard grants every permission.
+const (
+	AdminPermissionUsersRead            = "users:read"
+	AdminPermissionUsersWrite           = "users:write"
+	AdminPermissionUsersImpersonate     = "users:impersonate"
+	AdminPermissionGroupsRead           = "groups:read"
+	AdminPermissionGroupsWrite          = "groups:write"
+	AdminPermissionAppsRead             = "apps:read"
+	AdminPermissionAppsWrite            = "apps:write"
+	AdminPermissionSitesRead            = "sites:read"
+	AdminPermissionSitesWrite           = "sites:write"
+	AdminPermissionTenantsRead          = "tenants:read"
+	AdminPermissionTenantsWrite         = "tenants:write"
+	AdminPermissionServiceAccountsRead  = "service_accounts:read"
+	AdminPermissionServiceAccountsWrite = "service_accounts:write"
+	AdminPermissionAuditRead            = "audit:read"
+	AdminPermissionKeysWrite            = "keys:write"
+	AdminPermissionDirectoriesWrite     = "directories:write"
+	AdminPermissionFederationsWrite     = "federations:write"
+)
+
+// AdminPermissions are the permissions that can be granted to an admin principal
+var AdminPermissions = []string{
+	PermissionWildcard,
+	AdminPermissionUsersRead,
+	AdminPermissionUsersWrite,
+	AdminPermissionUsersImpersonate,
+	AdminPermissionGroupsRead,
+	AdminPermissionGroupsWrite,
+	AdminPermissionAppsRead,
+	AdminPermissionAppsWrite,
+	AdminPermissionSitesRead,
+	AdminPermissionSitesWrite,
+	AdminPermissionTenantsRead,
+	AdminPermissionTenantsWrite,
+	AdminPermissionServiceAccountsRead,
+	AdminPermissionServiceAccountsWrite,
+	AdminPermissionAuditRead,
+	AdminPermissionKeysWrite,
+	AdminPermissionDirectoriesWrite,
+	AdminPermissionFederationsWrite,
+}
+
+// IsSuperAdmin returns true if the principal administers the whole deployment. Principals that belong
+// to a tenant can only administer that tenant.
+func (p *AdminPrincipal) IsSuperAdmin() bool {
+	return len(p.TenantID) == 0
+}
+
+// HasPermission returns true if the principal was granted the permission
+func (p *AdminPrincipal) HasPermission(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == PermissionWildcard || granted == permission {
+			return true
+		}
+		if strings.HasSuffix(permission, ":read") && granted == strings.TrimSuffix(permission, ":read")+":write" {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,70 @@ package models
 
 // Application represents an application for which this authentication service controls access
 type Application struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID                          string               `json:"id"`
+	Name                        string               `json:"name"`
+	TenantID                    string               `json:"tenant_id,omitempty"`
+	AccessTokenFormat           string               `json:"access_token_format,omitempty"`
+	AccessTokenSigningAlgorithm string               `json:"access_token_signing_algorithm,omitempty"`
+	TokenEndpointAuthMethod     string               `json:"token_endpoint_auth_method,omitempty"`
+	SAML                        *SAMLServiceProvider `json:"saml,omitempty"`
+	RedirectURIs                []string             `json:"redirect_uris,omitempty"`
+	GrantTypes                  []string             `json:"grant_types,omitempty"`
+	LogoURI                     string               `json:"logo_uri,omitempty"`
+	Contacts                    []string             `json:"contacts,omitempty"`
+
+	// Scopes are the api scopes, such as billing:read, that the application may request for its tokens
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Roles can be assigned to users per site and are included in their tokens
+	Roles []*Role `json:"roles,omitempty"`
+
+	// AllowedSites are the ids of the sites the application may issue tokens for. The tenant's
+	// allowed_sites are used when it is empty, and every site of the tenant when both are.
+	AllowedSites []string `json:"allowed_sites,omitempty"`
+
+	// RestrictSites limits the application to its AllowedSites even when the list is empty, which
+	// is how registered clients start out without any sites
+	RestrictSites bool `json:"restrict_sites,omitempty"`
+
+	// credentials for the tls_client_auth, self_signed_tls_client_auth and private_key_jwt methods
+	TLSClientAuthSubjectDN          string   `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientCertificateThumbprints []string `json:"tls_client_certificate_thumbprints,omitempty"`
+	JWKS                            *JWKSet  `json:"jwks,omitempty"`
+
+	// RequireSignedRequests rejects /api requests that are not signed with one of the application's signing keys
+	RequireSignedRequests bool `json:"require_signed_requests,omitempty"`
+
+	// TokenExchangeAudiences are the applications this application may exchange tokens for,
+	// including itself. Token exchange is not allowed when it is empty.
+	TokenExchangeAudiences []string `json:"token_exchange_audiences,omitempty"`
+}
+
+// ApplicationResponse is returned when an administrator saves an Application. The client secret is
+// only set when one was created for the application and is not available again.
+type ApplicationResponse struct {
+	*Application
+	ClientSecret string `json:"client_secret,omitempty"`
 }
+
+// Access token formats. Opaque tokens are looked up in the datastore and are the default,
+// JWT access tokens are signed and can be verified offline against the published keys.
+const (
+	AccessTokenFormatOpaque = "opaque"
+	AccessTokenFormatJWT    = "jwt"
+)
+
+// Client authentication methods supported at the token endpoint. Public clients, such as devices
+// and CLIs that cannot keep a secret, use "none" and only send their client_id. The certificate
+// (RFC 8705) and private_key_jwt (RFC 7523) methods are also required by the X-Application header.
+const (
+	ClientAuthMethodSecretBasic   = "client_secret_basic"
+	ClientAuthMethodSecretPost    = "client_secret_post"
+	ClientAuthMethodNone          = "none"
+	ClientAuthMethodTLS           = "tls_client_auth"
+	ClientAuthMethodSelfSignedTLS = "self_signed_tls_client_auth"
+	ClientAuthMethodPrivateKeyJWT = "private_key_jwt"
+)
+
+// ClientAssertionTypeJWTBearer is the client_assertion_type of private_key_jwt assertions
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ApplicationSecrets holds the hashed client secrets issued to an Application
+type ApplicationSecrets struct {
+	ApplicationID string               `json:"application_id"`
+	Secrets       []*ApplicationSecret `json:"secrets"`
+}
+
+// ApplicationSecret is a single client secret. Only the hash of the secret is stored.
+type ApplicationSecret struct {
+	ID          string     `json:"id"`
+	Hash        string     `json:"hash"`
+	Description string     `json:"description,omitempty"`
+	DateCreated time.Time  `json:"date_created"`
+	DateExpires *time.Time `json:"date_expires,omitempty"`
+}
+
+// ApplicationSecretResponse is returned when a secret is created and is the only time
+// the plain text secret is available
+type ApplicationSecretResponse struct {
+	ID          string     `json:"id"`
+	Secret      string     `json:"secret,omitempty"`
+	Description string     `json:"description,omitempty"`
+	DateCreated time.Time  `json:"date_created"`
+	DateExpires *time.Time `json:"date_expires,omitempty"`
+}
+
+// CreateApplicationSecretRequest ...
+type CreateApplicationSecretRequest struct {
+	Description string `json:"description"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
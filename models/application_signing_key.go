@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ApplicationSigningKeys holds the shared secrets an Application signs its requests with
+type ApplicationSigningKeys struct {
+	ApplicationID string                   `json:"application_id"`
+	Keys          []*ApplicationSigningKey `json:"keys"`
+}
+
+// ApplicationSigningKey is a single request signing secret. The secret is stored encrypted because
+// it is needed to check signatures.
+type ApplicationSigningKey struct {
+	ID              string    `json:"id"`
+	EncryptedSecret string    `json:"encrypted_secret"`
+	Description     string    `json:"description,omitempty"`
+	DateCreated     time.Time `json:"date_created"`
+}
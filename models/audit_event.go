@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// AuditEvent records an action an administrator took, such as signing in as another user
+type AuditEvent struct {
+	ID            string             `json:"id"`
+	Action        AuditAction        `json:"action"`
+	AdminID       string             `json:"admin_id"`
+	AdminType     AdminPrincipalType `json:"admin_type,omitempty"`
+	TenantID      string             `json:"tenant_id,omitempty"`
+	ApplicationID string             `json:"application_id,omitempty"`
+	UserID        string             `json:"user_id,omitempty"`
+	SiteID        string             `json:"site_id,omitempty"`
+	Reason        string             `json:"reason,omitempty"`
+	Method        string             `json:"method,omitempty"`
+	Path          string             `json:"path,omitempty"`
+	Status        int                `json:"status,omitempty"`
+	IP            string             `json:"ip,omitempty"`
+	DateCreated   time.Time          `json:"date_created"`
+}
+
+// AuditAction is a specific string type
+type AuditAction string
+
+// Possible audited actions represented as strings
+const (
+	AuditActionImpersonate AuditAction = "Impersonate"
+	// AuditActionAdminRequest records an admin API request
+	AuditActionAdminRequest AuditAction = "AdminRequest"
+	// AuditActionAdminDenied records an admin API request that was not authenticated or not permitted
+	AuditActionAdminDenied AuditAction = "AdminDenied"
+)
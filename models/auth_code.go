@@ -10,6 +10,11 @@ type AuthCode struct {
 	ApplicationID string        `json:"application_id"`
 	AuthType      AuthTypeValue `json:"auth_type"`
 	Sites         []string      `json:"sites"`
+	Scopes        []string      `json:"scopes,omitempty"`
+	Nonce         string        `json:"nonce,omitempty"`
 	IP            string        `json:"ip"`
 	DateCreated   time.Time     `json:"date_created"`
+
+	// PasswordChangeRequired is set when the password used to sign in does not meet the tenant's policy
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
 }
@@ -7,6 +7,10 @@ type AuthCodeDetailed struct {
 	Status      LoginStatus   `json:"status"`
 	Sites       []*Site       `json:"sites"`
 	Application *Application  `json:"application"`
+
+	// PromptMFA asks the application to prompt the user for a second factor. It is advisory and is not
+	// checked when tokens are issued.
+	PromptMFA bool `json:"prompt_mfa,omitempty"`
 }
 
 // LoginStatus ...
@@ -18,4 +22,7 @@ const (
 	LoginStatusExpired         = "PasswordExpired"
 	LoginStatusNotValidated    = "NotValidated"
 	LoginStatusSiteUnavailable = "SiteUnavailable"
+
+	// LoginStatusPasswordChangeRequired is used when the password does not meet the tenant's password policy
+	LoginStatusPasswordChangeRequired = "PasswordChangeRequired"
 )
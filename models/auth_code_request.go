@@ -2,5 +2,11 @@ package models
 
 // CreateAuthCodeRequest ...
 type CreateAuthCodeRequest struct {
-	IP string `json:"ip"`
+	IP    string `json:"ip"`
+	Scope string `json:"scope"`
+	Nonce string `json:"nonce"`
+
+	// used when the user is sent to an upstream provider to sign in
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
 }
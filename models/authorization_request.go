@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// OAuthAuthorizeRequest is the query, or form, sent to the OAuth 2.0 authorization endpoint
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// AuthorizationRequest is an OAuth 2.0 authorization request waiting for the user to sign in
+type AuthorizationRequest struct {
+	ID            string    `json:"id"`
+	ApplicationID string    `json:"application_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	State         string    `json:"state,omitempty"`
+	Scopes        []string  `json:"scopes,omitempty"`
+	Nonce         string    `json:"nonce,omitempty"`
+	CodeChallenge string    `json:"code_challenge"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// AuthorizationCode is the short lived code returned to the client by the authorization endpoint. It can
+// only be exchanged once, by the client it was issued to, with the same redirect uri and the PKCE code
+// verifier of the request.
+type AuthorizationCode struct {
+	Code          string    `json:"code"`
+	AuthCode      string    `json:"auth_code"`
+	ApplicationID string    `json:"application_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	CodeChallenge string    `json:"code_challenge"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// CreateAuthorizationResponseRequest is the body sent by the login page once the user has signed in
+type CreateAuthorizationResponseRequest struct {
+	AuthorizationRequest string `json:"authorization_request"`
+}
+
+// AuthorizationResponse is the redirect uri, with the code and state, the login page must send the user to
+type AuthorizationResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// CodeChallengeMethodS256 is the only PKCE code challenge method supported (RFC 7636 section 4.2)
+const CodeChallengeMethodS256 = "S256"
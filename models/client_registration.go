@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// ClientMetadata is the metadata a client sends to register itself (RFC 7591 section 2)
+type ClientMetadata struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	Contacts                []string `json:"contacts,omitempty"`
+	JWKS                    *JWKSet  `json:"jwks,omitempty"`
+	TLSClientAuthSubjectDN  string   `json:"tls_client_auth_subject_dn,omitempty"`
+}
+
+// ClientRegistrationRequest is the body used to update a registration (RFC 7592 section 2.2)
+type ClientRegistrationRequest struct {
+	ClientMetadata
+	ClientID string `json:"client_id"`
+}
+
+// ClientRegistrationResponse is returned when a client is registered or its registration is read
+// (RFC 7591 section 3.2.1). The client secret and registration access token are only returned
+// when they are created.
+type ClientRegistrationResponse struct {
+	ClientMetadata
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// ClientRegistration records an Application created by dynamic client registration. Only the hash
+// of the registration access token is stored.
+type ClientRegistration struct {
+	ApplicationID               string    `json:"application_id"`
+	RegistrationAccessTokenHash string    `json:"registration_access_token_hash"`
+	DateCreated                 time.Time `json:"date_created"`
+}
+
+// InitialAccessToken allows a client to register itself while open registration is disabled.
+// Only the hash of the token is stored.
+type InitialAccessToken struct {
+	Hash        string     `json:"hash"`
+	Description string     `json:"description,omitempty"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	CreatedBy   string     `json:"created_by"`
+	DateCreated time.Time  `json:"date_created"`
+	DateExpires *time.Time `json:"date_expires,omitempty"`
+}
+
+// CreateInitialAccessTokenRequest ...
+type CreateInitialAccessTokenRequest struct {
+	Description string `json:"description"`
+	TenantID    string `json:"tenant_id"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// InitialAccessTokenResponse is returned when an initial access token is created and is the only
+// time the plain text token is available
+type InitialAccessTokenResponse struct {
+	Token       string     `json:"token"`
+	Description string     `json:"description,omitempty"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	DateCreated time.Time  `json:"date_created"`
+	DateExpires *time.Time `json:"date_expires,omitempty"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// DeviceCode is a pending device authorization grant (RFC 8628)
+type DeviceCode struct {
+	DeviceCode     string           `json:"device_code"`
+	UserCode       string           `json:"user_code"`
+	ApplicationID  string           `json:"application_id"`
+	Scopes         []string         `json:"scopes,omitempty"`
+	Status         DeviceCodeStatus `json:"status"`
+	UserID         string           `json:"user_id,omitempty"`
+	AuthCode       string           `json:"auth_code,omitempty"`
+	SiteID         string           `json:"site_id,omitempty"`
+	Interval       int              `json:"interval"`
+	DateLastPolled *time.Time       `json:"date_last_polled,omitempty"`
+	DateCreated    time.Time        `json:"date_created"`
+	DateExpires    time.Time        `json:"date_expires"`
+}
+
+// DeviceCodeStatus is the state of a DeviceCode
+type DeviceCodeStatus string
+
+// DeviceCodeStatus values
+const (
+	DeviceCodeStatusPending  DeviceCodeStatus = "pending"
+	DeviceCodeStatusApproved DeviceCodeStatus = "approved"
+	DeviceCodeStatusDenied   DeviceCodeStatus = "denied"
+)
+
+// DeviceAuthorizationRequest is the form posted by a device to start the grant
+type DeviceAuthorizationRequest struct {
+	Scope string `form:"scope"`
+}
+
+// DeviceAuthorizationResponse is returned to the device (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceCodeDetailed is shown to the user before they approve or deny the device
+type DeviceCodeDetailed struct {
+	UserCode    string       `json:"user_code"`
+	Application *Application `json:"application"`
+	Scopes      []string     `json:"scopes"`
+	DateExpires time.Time    `json:"date_expires"`
+}
+
+// DeviceVerificationRequest is the body sent when the user approves or denies a device
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code"`
+	Site     string `json:"site"`
+	Approve  bool   `json:"approve"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// Directory is an LDAP or Active Directory server that verifies the passwords of users instead of
+// User.Password. A directory provisions the new users of its tenant whose email is in one of its
+// domains or who sign in to a site that uses it, and is used for the users it has provisioned.
+type Directory struct {
+	ID                    string              `json:"id"`
+	TenantID              string              `json:"tenant_id,omitempty"`
+	Name                  string              `json:"name"`
+	URL                   string              `json:"url"`
+	StartTLS              bool                `json:"start_tls,omitempty"`
+	BindDN                string              `json:"bind_dn,omitempty"`
+	EncryptedBindPassword string              `json:"encrypted_bind_password,omitempty"`
+	BaseDN                string              `json:"base_dn"`
+	UserFilter            string              `json:"user_filter,omitempty"`
+	EmailDomains          []string            `json:"email_domains,omitempty"`
+	GroupSites            map[string][]string `json:"group_sites,omitempty"`
+}
+
+// DefaultDirectoryUserFilter finds the user entry by email. {email} is replaced with the escaped email.
+const DefaultDirectoryUserFilter = "(&(objectClass=person)(mail={email}))"
+
+// DirectoryIdentity is what an authenticator knows about a user after checking their password
+type DirectoryIdentity struct {
+	Email      string   `json:"email"`
+	Name       string   `json:"name,omitempty"`
+	GivenName  string   `json:"given_name,omitempty"`
+	FamilyName string   `json:"family_name,omitempty"`
+	Sites      []string `json:"sites,omitempty"`
+}
+
+// UpsertDirectoryRequest is the body used to save a Directory. The bind password is encrypted before it is stored.
+type UpsertDirectoryRequest struct {
+	TenantID     string              `json:"tenant_id,omitempty"`
+	Name         string              `json:"name"`
+	URL          string              `json:"url"`
+	StartTLS     bool                `json:"start_tls,omitempty"`
+	BindDN       string              `json:"bind_dn,omitempty"`
+	BindPassword string              `json:"bind_password,omitempty"`
+	BaseDN       string              `json:"base_dn"`
+	UserFilter   string              `json:"user_filter,omitempty"`
+	EmailDomains []string            `json:"email_domains,omitempty"`
+	GroupSites   map[string][]string `json:"group_sites,omitempty"`
+}
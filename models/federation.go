@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Federation is an upstream OpenID Connect provider that users of a site or email domain sign in with
+type Federation struct {
+	ID                    string   `json:"id"`
+	Name                  string   `json:"name"`
+	Issuer                string   `json:"issuer"`
+	ClientID              string   `json:"client_id"`
+	EncryptedClientSecret string   `json:"encrypted_client_secret,omitempty"`
+	Scopes                []string `json:"scopes,omitempty"`
+	EmailDomains          []string `json:"email_domains,omitempty"`
+}
+
+// UpsertFederationRequest is the body used to save a Federation. The client secret is encrypted before it is stored.
+type UpsertFederationRequest struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	EmailDomains []string `json:"email_domains,omitempty"`
+}
+
+// FederationRequest is a sign in that has been sent to an upstream provider, keyed by the state parameter
+type FederationRequest struct {
+	State         string    `json:"state"`
+	FederationID  string    `json:"federation_id"`
+	ApplicationID string    `json:"application_id"`
+	Email         string    `json:"email"`
+	Nonce         string    `json:"nonce"`
+	CodeVerifier  string    `json:"code_verifier"`
+	RedirectURI   string    `json:"redirect_uri"`
+	ClientState   string    `json:"client_state,omitempty"`
+	Scopes        []string  `json:"scopes,omitempty"`
+	ClientNonce   string    `json:"client_nonce,omitempty"`
+	IP            string    `json:"ip,omitempty"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// FederatedIdentity is what the upstream provider asserted about the user in its ID token
+type FederatedIdentity struct {
+	Subject    string
+	Email      string
+	Name       string
+	GivenName  string
+	FamilyName string
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Group gives every member access to its sites and its roles. Members are listed in User.Groups.
+type Group struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	Sites       []string          `json:"sites"`
+	Roles       []*RoleAssignment `json:"roles,omitempty"`
+	DateCreated time.Time         `json:"date_created"`
+}
+
+// UpsertGroupRequest is the body used to save a Group. Sites can be ids or urls. The tenant can only
+// be chosen by a super admin creating the group, other groups belong to the admin's tenant.
+type UpsertGroupRequest struct {
+	TenantID    string                   `json:"tenant_id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Sites       []string                 `json:"sites"`
+	Roles       []*RoleAssignmentRequest `json:"roles"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// ImpersonationRequest is the body used by an administrator to get an AccessToken for a user
+type ImpersonationRequest struct {
+	Site   string `json:"site"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,33 @@
+package models
+
+// IntrospectionRequest is the form posted to the token introspection endpoint (RFC 7662)
+type IntrospectionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+// IntrospectionResponse describes the state of a token (RFC 7662 section 2.2)
+type IntrospectionResponse struct {
+	Active         bool          `json:"active"`
+	Scope          string        `json:"scope,omitempty"`
+	ClientID       string        `json:"client_id,omitempty"`
+	Username       string        `json:"username,omitempty"`
+	TokenType      string        `json:"token_type,omitempty"`
+	Exp            int64         `json:"exp,omitempty"`
+	Iat            int64         `json:"iat,omitempty"`
+	Sub            string        `json:"sub,omitempty"`
+	Iss            string        `json:"iss,omitempty"`
+	AuthType       AuthTypeValue `json:"auth_type,omitempty"`
+	SiteID         string        `json:"site_id,omitempty"`
+	SiteURL        string        `json:"site_url,omitempty"`
+	SiteName       string        `json:"site_name,omitempty"`
+	Roles          []string      `json:"roles,omitempty"`
+	Act            *Actor        `json:"act,omitempty"`
+	ImpersonatorID string        `json:"impersonator_id,omitempty"`
+}
+
+// Token type hints (RFC 7009 section 2.1)
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// Policy is a versioned set of rules an application applies to every user token it issues, and to
+// the decisions made by its authorize endpoint. A new version is saved every time it is changed.
+type Policy struct {
+	ApplicationID string        `json:"application_id"`
+	Version       int           `json:"version"`
+	DefaultEffect PolicyEffect  `json:"default_effect"`
+	TimeZone      string        `json:"time_zone,omitempty"`
+	Rules         []*PolicyRule `json:"rules"`
+	DateCreated   time.Time     `json:"date_created"`
+}
+
+// PolicyRule applies its effect when every one of its conditions matches. Deny rules take precedence
+// over allow rules, and the default effect applies when no rule matches.
+type PolicyRule struct {
+	Name       string             `json:"name"`
+	Effect     PolicyEffect       `json:"effect"`
+	Reason     string             `json:"reason,omitempty"`
+	Conditions []*PolicyCondition `json:"conditions"`
+}
+
+// PolicyCondition compares an attribute, such as user.attributes.department or request.ip, with the values
+type PolicyCondition struct {
+	Attribute string         `json:"attribute"`
+	Operator  PolicyOperator `json:"operator"`
+	Values    []string       `json:"values"`
+}
+
+// PolicyEffect is a specific string type
+type PolicyEffect string
+
+// Possible effects of a PolicyRule represented as strings
+const (
+	PolicyEffectAllow PolicyEffect = "allow"
+	PolicyEffectDeny  PolicyEffect = "deny"
+)
+
+// PolicyOperator is a specific string type
+type PolicyOperator string
+
+// Possible operators of a PolicyCondition represented as strings. An attribute with several values,
+// such as token.roles, is in the values if any of its values are. Between compares HH:MM times and
+// includes ranges that cross midnight.
+const (
+	PolicyOperatorIn         PolicyOperator = "in"
+	PolicyOperatorNotIn      PolicyOperator = "not_in"
+	PolicyOperatorCIDR       PolicyOperator = "cidr"
+	PolicyOperatorNotCIDR    PolicyOperator = "not_cidr"
+	PolicyOperatorBetween    PolicyOperator = "between"
+	PolicyOperatorNotBetween PolicyOperator = "not_between"
+)
+
+// PolicyInput holds the attributes a Policy is evaluated against. The request.time and request.weekday
+// attributes are added from Time in the time zone of the policy.
+type PolicyInput struct {
+	Attributes map[string][]string
+	Time       time.Time
+}
+
+// PolicyDecision is the result of evaluating a Policy
+type PolicyDecision struct {
+	Allowed       bool     `json:"allowed"`
+	Reasons       []string `json:"reasons"`
+	PolicyVersion int      `json:"policy_version,omitempty"`
+}
+
+// UpsertPolicyRequest is the body used to save a new version of a Policy
+type UpsertPolicyRequest struct {
+	DefaultEffect PolicyEffect  `json:"default_effect"`
+	TimeZone      string        `json:"time_zone"`
+	Rules         []*PolicyRule `json:"rules"`
+}
+
+// AuthorizeRequest is the optional body sent to the authorize endpoint. The site defaults to the
+// site of the token and the ip to the ip the user signed in from.
+type AuthorizeRequest struct {
+	Site string `json:"site"`
+	IP   string `json:"ip"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// RefreshToken is exchanged for a new AccessToken and RefreshToken. Each refresh token can only be used once.
+type RefreshToken struct {
+	Token         string     `json:"token"`
+	FamilyID      string     `json:"family_id"`
+	ApplicationID string     `json:"application_id"`
+	AuthCode      string     `json:"auth_code"`
+	SiteID        string     `json:"site_id"`
+	Scopes        []string   `json:"scopes,omitempty"`
+	IsUsed        bool       `json:"is_used"`
+	DateCreated   time.Time  `json:"date_created"`
+	DateUsed      *time.Time `json:"date_used,omitempty"`
+}
+
+// RefreshTokenFamily tracks every token issued from a single grant so that they can all be
+// revoked if a refresh token that was already used is presented again
+type RefreshTokenFamily struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	ApplicationID string    `json:"application_id"`
+	AuthCode      string    `json:"auth_code"`
+	SiteID        string    `json:"site_id"`
+	RefreshTokens []string  `json:"refresh_tokens"`
+	AccessTokens  []string  `json:"access_tokens"`
+	JWTIDs        []string  `json:"jwt_ids,omitempty"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// RefreshTokenRequest ...
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	IP           string `json:"ip"`
+}
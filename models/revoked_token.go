@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken records a JWT access token that was revoked before it expired. Entries with an
+// application or site id revoke every JWT access token issued to it up to DateRevoked.
+type RevokedToken struct {
+	JWTID         string     `json:"jwt_id,omitempty"`
+	ApplicationID string     `json:"application_id,omitempty"`
+	SiteID        string     `json:"site_id,omitempty"`
+	DateRevoked   *time.Time `json:"date_revoked,omitempty"`
+	DateExpires   time.Time  `json:"date_expires"`
+}
@@ -0,0 +1,46 @@
+package models
+
+// Role is a named set of permissions defined by an application, such as an editor who can
+// documents:write. The permission "*" grants every permission.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// PermissionWildcard grants every permission of the application
+const PermissionWildcard = "*"
+
+// RoleAssignments holds every role assigned to a user
+type RoleAssignments struct {
+	UserID      string            `json:"user_id"`
+	Assignments []*RoleAssignment `json:"assignments"`
+}
+
+// RoleAssignment gives a user one of an application's roles on a site
+type RoleAssignment struct {
+	ApplicationID string `json:"application_id"`
+	SiteID        string `json:"site_id"`
+	Role          string `json:"role"`
+}
+
+// RoleAssignmentRequest is the body used to assign or remove a role. The site can be an id or url.
+type RoleAssignmentRequest struct {
+	ApplicationID string `json:"application_id"`
+	Site          string `json:"site"`
+	Role          string `json:"role"`
+}
+
+// PermissionRequest is the form posted to check whether a token has a permission on a site
+type PermissionRequest struct {
+	Token      string `form:"token"`
+	Permission string `form:"permission"`
+	Site       string `form:"site"`
+}
+
+// PermissionResponse is the result of a PermissionRequest
+type PermissionResponse struct {
+	Allowed bool     `json:"allowed"`
+	SiteID  string   `json:"site_id,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+}
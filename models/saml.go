@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// SAMLServiceProvider is the SAML 2.0 configuration of an Application acting as a service provider
+type SAMLServiceProvider struct {
+	EntityID                string   `json:"entity_id"`
+	ACSURLs                 []string `json:"acs_urls"`
+	Certificate             string   `json:"certificate,omitempty"`
+	WantAuthnRequestsSigned bool     `json:"want_authn_requests_signed,omitempty"`
+	NameIDFormat            string   `json:"name_id_format,omitempty"`
+}
+
+// SAML name identifier formats. Persistent name ids are the user id and are the default.
+const (
+	SAMLNameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	SAMLNameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// SAMLAuthnRequest is the part of a SAML AuthnRequest that is read by the identity provider
+type SAMLAuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+}
+
+// SAMLRequest is an AuthnRequest waiting for the user to sign in
+type SAMLRequest struct {
+	ID            string    `json:"id"`
+	RequestID     string    `json:"request_id"`
+	ApplicationID string    `json:"application_id"`
+	ACSURL        string    `json:"acs_url"`
+	RelayState    string    `json:"relay_state,omitempty"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// CreateSAMLResponseRequest is the body sent by the login page once the user has signed in
+type CreateSAMLResponseRequest struct {
+	SAMLRequest string `json:"saml_request"`
+}
+
+// SAMLResponse is the signed response the login page must post to the service provider
+type SAMLResponse struct {
+	ACSURL       string `json:"acs_url"`
+	SAMLResponse string `json:"saml_response"`
+	RelayState   string `json:"relay_state,omitempty"`
+}
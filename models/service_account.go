@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// ServiceAccount is an admin principal for automation that calls the admin API with an API key instead
+// of a user's access token. Only the hash of the key is stored.
+type ServiceAccount struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	Permissions    []string  `json:"permissions"`
+	KeyHash        string    `json:"key_hash"`
+	DateCreated    time.Time `json:"date_created"`
+	DateKeyCreated time.Time `json:"date_key_created"`
+}
+
+// ServiceAccountResponse is returned by the admin API without the key hash. The API key is only set
+// when a key is created and is not available again.
+type ServiceAccountResponse struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	Permissions    []string  `json:"permissions"`
+	APIKey         string    `json:"api_key,omitempty"`
+	DateCreated    time.Time `json:"date_created"`
+	DateKeyCreated time.Time `json:"date_key_created"`
+}
+
+// UpsertServiceAccountRequest is the body used to save a ServiceAccount. The tenant can only be chosen
+// by a super admin creating the account, other accounts belong to the admin's tenant.
+type UpsertServiceAccountRequest struct {
+	TenantID    string   `json:"tenant_id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
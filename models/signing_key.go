@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// SigningKey is a key pair used to sign tokens. The private key is encrypted with the master key.
+type SigningKey struct {
+	ID                  string           `json:"id"`
+	Algorithm           string           `json:"algorithm"`
+	Status              SigningKeyStatus `json:"status"`
+	EncryptedPrivateKey string           `json:"encrypted_private_key"`
+	PublicKey           *JWK             `json:"public_key"`
+	DateCreated         time.Time        `json:"date_created"`
+	DateActivated       *time.Time       `json:"date_activated,omitempty"`
+	DateRetired         *time.Time       `json:"date_retired,omitempty"`
+}
+
+// SigningKeyStatus is a specific string type
+type SigningKeyStatus string
+
+// Possible states of a signing key. Next keys are published before they are used so that verifiers
+// already have them when they become active, and retired keys stay published until every token
+// they signed has expired.
+const (
+	SigningKeyStatusNext    SigningKeyStatus = "Next"
+	SigningKeyStatusActive  SigningKeyStatus = "Active"
+	SigningKeyStatusRetired SigningKeyStatus = "Retired"
+)
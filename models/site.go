@@ -1,10 +1,55 @@
 package models
 
+import "time"
+
 // Site represents subdivision of access within an application
 type Site struct {
-	SiteID     string `json:"site_id"`
-	SiteName   string `json:"site_name"`
-	SiteNumber string `json:"site_number"`
-	SiteURL    string `json:"site_url"`
-	IsActive   bool   `json:"is_active"`
+	SiteID       string `json:"site_id"`
+	SiteName     string `json:"site_name"`
+	SiteNumber   string `json:"site_number"`
+	SiteURL      string `json:"site_url"`
+	TenantID     string `json:"tenant_id,omitempty"`
+	IsActive     bool   `json:"is_active"`
+	DirectoryID  string `json:"directory_id,omitempty"`
+	FederationID string `json:"federation_id,omitempty"`
+
+	// Attributes, such as region, can be used by application policies
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// MaintenanceWindow makes the site unavailable for a scheduled period without revoking its tokens
+	MaintenanceWindow *MaintenanceWindow `json:"maintenance_window,omitempty"`
+}
+
+// MaintenanceWindow is a period when a site is unavailable
+type MaintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// IsAvailable returns true if the site is active and not in its maintenance window. Tokens are not
+// issued or accepted for sites that are unavailable.
+func (s *Site) IsAvailable() bool {
+	if !s.IsActive {
+		return false
+	}
+	if s.MaintenanceWindow == nil {
+		return true
+	}
+
+	now := time.Now().UTC()
+	return now.Before(s.MaintenanceWindow.Start) || !now.Before(s.MaintenanceWindow.End)
+}
+
+// UpsertSiteRequest is the body used to save a Site. Sites are active unless is_active is false. The
+// tenant can only be chosen by a super admin creating the site, other sites belong to the admin's tenant.
+type UpsertSiteRequest struct {
+	TenantID          string             `json:"tenant_id"`
+	SiteName          string             `json:"site_name"`
+	SiteNumber        string             `json:"site_number"`
+	SiteURL           string             `json:"site_url"`
+	IsActive          *bool              `json:"is_active"`
+	DirectoryID       string             `json:"directory_id"`
+	FederationID      string             `json:"federation_id"`
+	Attributes        map[string]string  `json:"attributes"`
+	MaintenanceWindow *MaintenanceWindow `json:"maintenance_window"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Tenant is an organization that owns its own sites, users and applications. Sites, users and
+// applications without a tenant belong to the deployment and are only visible to each other.
+type Tenant struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Settings    *TenantSettings `json:"settings,omitempty"`
+	DateCreated time.Time       `json:"date_created"`
+}
+
+// TenantSettings override the deployment's defaults for the users and applications of a tenant
+type TenantSettings struct {
+	PasswordPolicy *PasswordPolicy `json:"password_policy,omitempty"`
+
+	// PromptMFA is advisory. It asks applications to prompt the tenant's users for a second factor, which
+	// this service does not verify and does not require before issuing tokens.
+	PromptMFA bool `json:"prompt_mfa,omitempty"`
+
+	// token lifetimes in seconds. They can only shorten the deployment's lifetimes.
+	AccessTokenTTL  int `json:"access_token_ttl,omitempty"`
+	RefreshTokenTTL int `json:"refresh_token_ttl,omitempty"`
+
+	// AllowedSites are the ids of the sites applications without their own allowed_sites may issue tokens for
+	AllowedSites []string `json:"allowed_sites,omitempty"`
+}
+
+// PasswordPolicy lists the rules a password must meet
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length,omitempty"`
+	RequireUppercase bool `json:"require_uppercase,omitempty"`
+	RequireLowercase bool `json:"require_lowercase,omitempty"`
+	RequireNumber    bool `json:"require_number,omitempty"`
+	RequireSymbol    bool `json:"require_symbol,omitempty"`
+}
+
+// UpsertTenantRequest is the body used to save a Tenant
+type UpsertTenantRequest struct {
+	Name     string          `json:"name"`
+	Settings *TenantSettings `json:"settings"`
+}
@@ -0,0 +1,38 @@
+package models
+
+// TokenRequest is the form posted to the OAuth 2.0 token endpoint
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	RefreshToken string `form:"refresh_token"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	DeviceCode   string `form:"device_code"`
+
+	// token exchange (RFC 8693 section 2.1)
+	SubjectToken       string `form:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"`
+	ActorToken         string `form:"actor_token"`
+	ActorTokenType     string `form:"actor_token_type"`
+	RequestedTokenType string `form:"requested_token_type"`
+	Audience           string `form:"audience"`
+	Scope              string `form:"scope"`
+	Site               string `form:"site"`
+	IP                 string `form:"ip"`
+}
+
+// CreateAccessTokenRequest is the optional body used to narrow the scopes of a new AccessToken
+type CreateAccessTokenRequest struct {
+	Scope string `json:"scope"`
+}
+
+// Supported OAuth 2.0 grant types
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
@@ -0,0 +1,18 @@
+package models
+
+// TokenResponse is the OAuth 2.0 access token response
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	SiteID       string `json:"site_id,omitempty"`
+
+	// token exchange (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// TokenTypeBearer is the only token type issued by the token endpoint
+const TokenTypeBearer = "Bearer"
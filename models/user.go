@@ -1,20 +1,48 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // User ...
 type User struct {
-	ID          string                 `json:"id"`
-	Email       string                 `json:"email"`
-	Password    string                 `json:"pass"`
-	Code        string                 `json:"code"`
-	IsValidated bool                   `json:"is_validated"`
+	ID          string `json:"id"`
+	Email       string `json:"email"`
+	Name        string `json:"name,omitempty"`
+	GivenName   string `json:"given_name,omitempty"`
+	FamilyName  string `json:"family_name,omitempty"`
+	Password    string `json:"pass"`
+	Code        string `json:"code"`
+	IsValidated bool   `json:"is_validated"`
+	IsAdmin     bool   `json:"is_admin,omitempty"`
+	TenantID    string `json:"tenant_id,omitempty"`
+
+	// AdminPermissions limit what an admin can do in the admin API. Admins without any cannot do anything.
+	AdminPermissions []string `json:"admin_permissions,omitempty"`
+
 	SiteRefs    []string               `json:"site_refs,omitempty"`
+	Groups      []string               `json:"groups,omitempty"`
+	DirectoryID string                 `json:"directory_id,omitempty"`
+	Federations map[string]string      `json:"federations,omitempty"`
+	Attributes  map[string]string      `json:"attributes,omitempty"`
 	SiteLogins  map[string]*SiteLogins `json:"site_logins,omitempty"`
 	Logins      []*LoginTime           `json:"logins,omitempty"`
 	DateExpires *time.Time             `json:"date_expires,omitempty"`
 }
 
+// IsSuperAdmin returns true if the user administers the whole deployment. Admins that belong to a
+// tenant can only administer that tenant.
+func (u *User) IsSuperAdmin() bool {
+	return u.IsAdmin && len(u.TenantID) == 0
+}
+
+// UpdateAdminRequest is the body used to grant or remove a user's admin access
+type UpdateAdminRequest struct {
+	IsAdmin     bool     `json:"is_admin"`
+	Permissions []string `json:"permissions"`
+}
+
 // SiteLogins ...
 type SiteLogins struct {
 	Logins []*LoginTime `json:"logins,omitempty"`
@@ -34,4 +62,19 @@ type AuthTypeValue string
 const (
 	AuthTypeUser        AuthTypeValue = "User"
 	AuthTypeApplication AuthTypeValue = "Application"
+	// AuthTypeImpersonation is used when an administrator signs in as the user
+	AuthTypeImpersonation AuthTypeValue = "Impersonation"
 )
+
+// authTypeFederationPrefix starts the AuthTypeValue of users who signed in through a Federation
+const authTypeFederationPrefix = "Federation:"
+
+// FederationAuthType returns the AuthTypeValue naming the federation a user signed in through
+func FederationAuthType(federationID string) AuthTypeValue {
+	return AuthTypeValue(authTypeFederationPrefix + federationID)
+}
+
+// IsUser returns true if a user signed in, either with a password or through a federation
+func (a AuthTypeValue) IsUser() bool {
+	return a == AuthTypeUser || strings.HasPrefix(string(a), authTypeFederationPrefix)
+}
@@ -0,0 +1,12 @@
+package models
+
+// UserTokens indexes the AuthCodes, AccessTokens and RefreshTokenFamilies issued to a user
+// so that they can all be revoked without scanning the bucket
+type UserTokens struct {
+	AuthCodes            []string `json:"auth_codes"`
+	AccessTokens         []string `json:"access_tokens"`
+	RefreshTokenFamilies []string `json:"refresh_token_families"`
+
+	// JWTIDs hold the id and expiry of each JWT access token, since those tokens are not stored
+	JWTIDs []string `json:"jwt_ids,omitempty"`
+}